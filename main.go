@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"mime"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,7 +22,10 @@ import (
 	"github.com/yumyai/ggtable/logger"
 	"github.com/yumyai/ggtable/pkg/db"
 	"github.com/yumyai/ggtable/pkg/handler"
+	"github.com/yumyai/ggtable/pkg/middle"
 	"github.com/yumyai/ggtable/pkg/model"
+	"github.com/yumyai/ggtable/pkg/render"
+	"github.com/yumyai/ggtable/pkg/webhook"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -40,6 +47,27 @@ type AppConfig struct {
 	Addr     string // listen addr, default 0.0.0.0:8080
 	Verbose  bool   // -v
 	Sorted   string
+
+	SequenceBackend string // GGTABLE_SEQUENCE_BACKEND: "blastdbcmd" or "fasta"
+	SequenceCacheMB int    // GGTABLE_SEQUENCE_CACHE_MB: memory for fetched sequences, 0 disables the cache
+	BlastdbcmdProcs int    // GGTABLE_BLASTDBCMD_PROCS: concurrent blastdbcmd processes, 0 for no limit
+
+	JobDB        string        // GGTABLE_JOB_DB; "memory" keeps BLAST jobs in memory only
+	JobRetention time.Duration // GGTABLE_JOB_RETENTION
+
+	BlastWorkers   int           // GGTABLE_BLAST_WORKERS: concurrent BLAST processes
+	BlastThreads   int           // GGTABLE_BLAST_THREADS: -num_threads per process
+	BlastQueueSize int           // GGTABLE_BLAST_QUEUE: jobs allowed to wait for a worker
+	BlastTimeout   time.Duration // GGTABLE_BLAST_TIMEOUT: per-job time limit, 0 for none
+	BlastQueries   int           // GGTABLE_BLAST_MAX_QUERIES: sequences per search, 0 for no limit
+	BlastCache     bool          // GGTABLE_BLAST_CACHE: reuse results of identical searches
+	FormatterProcs int           // GGTABLE_BLAST_FORMATTER_PROCS: blast_formatter processes for report downloads, 0 for no limit
+
+	WebhookSecret       string // GGTABLE_WEBHOOK_SECRET: signs completion webhooks; empty disables them
+	WebhookAllowPrivate bool   // GGTABLE_WEBHOOK_ALLOW_PRIVATE: allow webhooks to loopback and private addresses
+	PublicURL           string // GGTABLE_PUBLIC_URL: base URL for links sent in webhooks
+
+	NCBIBlast bool // GGTABLE_NCBI_BLAST: offer links that send sequences to NCBI BLAST
 }
 
 // ParseConfig loads .env (if present), uses env as defaults, and then parses flags.
@@ -53,13 +81,49 @@ func ParseConfig() AppConfig {
 		Subtitle: getenv("GGSUBTITLE", ""),
 		Addr:     getenv("GGTABLE_ADDR", "0.0.0.0:8080"),
 		Sorted:   getenv("GGSORTED", ""),
+		JobDB:    getenv("GGTABLE_JOB_DB", ""),
+
+		SequenceBackend: getenv("GGTABLE_SEQUENCE_BACKEND", "blastdbcmd"),
+		SequenceCacheMB: getenvInt("GGTABLE_SEQUENCE_CACHE_MB", 64),
+		BlastdbcmdProcs: getenvInt("GGTABLE_BLASTDBCMD_PROCS", 8),
+
+		BlastWorkers:   getenvInt("GGTABLE_BLAST_WORKERS", 2),
+		BlastThreads:   getenvInt("GGTABLE_BLAST_THREADS", 1),
+		BlastQueueSize: getenvInt("GGTABLE_BLAST_QUEUE", 20),
+		BlastQueries:   getenvInt("GGTABLE_BLAST_MAX_QUERIES", 100),
+		BlastCache:     getenvBool("GGTABLE_BLAST_CACHE", true),
+		FormatterProcs: getenvInt("GGTABLE_BLAST_FORMATTER_PROCS", 2),
+
+		WebhookSecret:       getenv("GGTABLE_WEBHOOK_SECRET", ""),
+		WebhookAllowPrivate: getenvBool("GGTABLE_WEBHOOK_ALLOW_PRIVATE", false),
+		PublicURL:           getenv("GGTABLE_PUBLIC_URL", ""),
+
+		NCBIBlast: getenvBool("GGTABLE_NCBI_BLAST", true),
 	}
 
+	cfg.JobRetention = getenvDuration("GGTABLE_JOB_RETENTION", db.DefaultJobRetention)
+	cfg.BlastTimeout = getenvDuration("GGTABLE_BLAST_TIMEOUT", 30*time.Minute)
+
 	flag.BoolVar(&cfg.Verbose, "v", false, "Enable verbose (debug) logging")
 	flag.StringVar(&cfg.DataDir, "data", cfg.DataDir, "Path to data directory (default from $GGTABLE_DATA)")
 	flag.StringVar(&cfg.Title, "title", cfg.Title, "Application title (default from $GGTITLE)")
 	flag.StringVar(&cfg.Subtitle, "subtitle", cfg.Subtitle, "Application subtitle (default from $GGSUBTITLE)")
 	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "HTTP listen address")
+	flag.StringVar(&cfg.SequenceBackend, "sequence-backend", cfg.SequenceBackend, "Where sequences are read from: \"blastdbcmd\" (the BLAST databases) or \"fasta\" (faidx-indexed FASTA under <data>/db/fasta, no BLAST+ needed) (from $GGTABLE_SEQUENCE_BACKEND)")
+	flag.IntVar(&cfg.SequenceCacheMB, "sequence-cache-mb", cfg.SequenceCacheMB, "Megabytes of fetched sequences kept in memory; 0 disables the cache (from $GGTABLE_SEQUENCE_CACHE_MB)")
+	flag.IntVar(&cfg.BlastdbcmdProcs, "blastdbcmd-procs", cfg.BlastdbcmdProcs, "Number of blastdbcmd processes run at once to fetch sequences; 0 for no limit (from $GGTABLE_BLASTDBCMD_PROCS)")
+	flag.StringVar(&cfg.JobDB, "job-db", cfg.JobDB, "BLAST job database file, or \"memory\" (default <data>/jobs/blast_jobs.db, from $GGTABLE_JOB_DB)")
+	flag.DurationVar(&cfg.JobRetention, "job-retention", cfg.JobRetention, "How long finished BLAST jobs are kept; 0 keeps them forever (from $GGTABLE_JOB_RETENTION)")
+	flag.IntVar(&cfg.BlastWorkers, "blast-workers", cfg.BlastWorkers, "Number of BLAST processes run at once (from $GGTABLE_BLAST_WORKERS)")
+	flag.IntVar(&cfg.BlastThreads, "blast-threads", cfg.BlastThreads, "Threads per BLAST process (from $GGTABLE_BLAST_THREADS)")
+	flag.IntVar(&cfg.BlastQueueSize, "blast-queue", cfg.BlastQueueSize, "Number of BLAST jobs allowed to wait; more are rejected with 503 (from $GGTABLE_BLAST_QUEUE)")
+	flag.DurationVar(&cfg.BlastTimeout, "blast-timeout", cfg.BlastTimeout, "Time limit for a single BLAST job; 0 for none (from $GGTABLE_BLAST_TIMEOUT)")
+	flag.BoolVar(&cfg.BlastCache, "blast-cache", cfg.BlastCache, "Reuse the result of an identical earlier BLAST search (from $GGTABLE_BLAST_CACHE)")
+	flag.IntVar(&cfg.FormatterProcs, "blast-formatter-procs", cfg.FormatterProcs, "Number of blast_formatter processes run at once for report downloads; 0 for no limit (from $GGTABLE_BLAST_FORMATTER_PROCS)")
+	flag.BoolVar(&cfg.WebhookAllowPrivate, "webhook-allow-private", cfg.WebhookAllowPrivate, "Allow completion webhooks to loopback, private and link-local addresses (from $GGTABLE_WEBHOOK_ALLOW_PRIVATE)")
+	flag.StringVar(&cfg.PublicURL, "public-url", cfg.PublicURL, "Base URL of this server, for links in completion webhooks (from $GGTABLE_PUBLIC_URL)")
+	flag.BoolVar(&cfg.NCBIBlast, "ncbi-blast", cfg.NCBIBlast, "Offer links that send gene and region sequences to NCBI BLAST; turn off for air-gapped or unpublished data (from $GGTABLE_NCBI_BLAST)")
+	flag.IntVar(&cfg.BlastQueries, "blast-max-queries", cfg.BlastQueries, "Query sequences allowed in one BLAST search; 0 for no limit (from $GGTABLE_BLAST_MAX_QUERIES)")
 
 	flag.Parse()
 	return cfg
@@ -101,6 +165,11 @@ func run(cfg AppConfig) error {
 	protDB := path.Join(cfg.DataDir, "db/blastdb/genetable_genes_prot")
 	nuclDB := path.Join(cfg.DataDir, "db/blastdb/genetable_genes_nucl")
 	genomeDB := path.Join(cfg.DataDir, "db/blastdb/genetable_genomes")
+	// The other aligners are offered when their databases have been built.
+	diamondDB := existingPath(path.Join(cfg.DataDir, "db/diamond/genetable_genes_prot.dmnd"))
+	mmseqsProtDB := existingPath(path.Join(cfg.DataDir, "db/mmseqs/genetable_genes_prot"))
+	mmseqsNuclDB := existingPath(path.Join(cfg.DataDir, "db/mmseqs/genetable_genes_nucl"))
+	mmseqsGenomeDB := existingPath(path.Join(cfg.DataDir, "db/mmseqs/genetable_genomes"))
 
 	// DB connect
 	// FIX: This create a new sqlite3 database if it does not exists.
@@ -118,18 +187,93 @@ func run(cfg AppConfig) error {
 	dbConn.SetMaxIdleConns(5)
 	dbConn.SetConnMaxLifetime(3 * time.Minute)
 
-	gcdb := db.NewGeneClusterDB(dbConn, &db.SequenceDB{
+	blastSeqDB := &db.SequenceDB{
 		ProtDB:   protDB,
 		NuclDB:   nuclDB,
 		GenomeDB: genomeDB,
-	})
+		MaxProcs: cfg.BlastdbcmdProcs,
+		MaxWait:  30 * time.Second, // Then the request fails with 503
+	}
+	seqStore, err := openSequenceStore(cfg, blastSeqDB)
+	if err != nil {
+		logger.Fatal("Cannot open sequences", zap.String("backend", cfg.SequenceBackend), zap.Error(err))
+		return err
+	}
+	blastdbcmd, _ := seqStore.(*db.SequenceDB)
+	var cache *db.CachedSequenceStore
+	if cfg.SequenceCacheMB > 0 {
+		cache = db.NewCachedSequenceStore(seqStore, int64(cfg.SequenceCacheMB)<<20)
+		seqStore = cache
+	}
+	gcdb := db.NewGeneClusterDB(dbConn, seqStore)
+
+	blastManager := db.NewBlastManager(openJobStore(cfg), cfg.JobRetention)
+	defer blastManager.Close()
 
+	shutdown := make(chan struct{})
 	appConfig := &handler.AppContext{
-		GCDB:         gcdb,
-		BlastManager: db.NewBlastManager(),
-		ProtBLASTDB:  protDB,
-		NuclBLASTDB:  nuclDB,
+		GCDB:          gcdb,
+		BlastManager:  blastManager,
+		ProtBLASTDB:   protDB,
+		NuclBLASTDB:   nuclDB,
+		GenomeBLASTDB: genomeDB,
+		BlastThreads:  cfg.BlastThreads,
+		BlastQueries:  cfg.BlastQueries,
+		BlastCache:    cfg.BlastCache,
+		PublicURL:     cfg.PublicURL,
+		NCBIBlast:     cfg.NCBIBlast,
+		Shutdown:      shutdown,
+
+		DiamondDB:      diamondDB,
+		MMseqsProtDB:   mmseqsProtDB,
+		MMseqsNuclDB:   mmseqsNuclDB,
+		MMseqsGenomeDB: mmseqsGenomeDB,
+
+		// Report downloads wait up to 30s for a blast_formatter slot, then get 503.
+		BlastFormatter: &model.BlastFormatter{MaxProcs: cfg.FormatterProcs, Wait: 30 * time.Second},
+
+		SequenceCache: cache,
+		Blastdbcmd:    blastdbcmd,
+	}
+
+	// The secret is only read from the environment, so it does not show in ps.
+	if cfg.WebhookSecret != "" {
+		appConfig.Webhooks = webhook.NewSender(cfg.WebhookSecret)
+		appConfig.Webhooks.AllowPrivate = cfg.WebhookAllowPrivate
+		defer appConfig.Webhooks.Close()
+	}
+	blastManager.OnFinished(appConfig.NotifyJobFinished)
+	render.NCBIBlastLinks = cfg.NCBIBlast
+
+	if cfg.BlastWorkers < 1 {
+		cfg.BlastWorkers = 1
+	}
+	// Jobs wait in the queue even when a worker is free, so an empty queue would reject every search.
+	if cfg.BlastQueueSize < 1 {
+		logger.Fatal("BLAST queue size must be at least 1", zap.Int("blast_queue", cfg.BlastQueueSize))
+	}
+	blastManager.StartWorkers(cfg.BlastWorkers, cfg.BlastQueueSize, cfg.BlastTimeout, appConfig.RunBlastJob)
+	defer blastManager.Stop()
+	if n, err := blastManager.RequeueInterrupted(); err != nil {
+		logger.Error("Cannot recover BLAST jobs", zap.Error(err))
+	} else if n > 0 {
+		logger.Info("Requeued BLAST jobs interrupted by the last shutdown", zap.Int("jobs", n))
 	}
+	logger.Info("BLAST worker pool",
+		zap.Int("workers", cfg.BlastWorkers),
+		zap.Int("threads", cfg.BlastThreads),
+		zap.Int("queue_size", cfg.BlastQueueSize),
+		zap.Duration("timeout", cfg.BlastTimeout),
+		zap.Int("max_queries", cfg.BlastQueries),
+		zap.Bool("cache", cfg.BlastCache),
+		zap.Bool("webhooks", appConfig.Webhooks != nil),
+	)
+	logger.Info("Aligner databases",
+		zap.String("diamond", diamondDB),
+		zap.String("mmseqs_prot", mmseqsProtDB),
+		zap.String("mmseqs_nucl", mmseqsNuclDB),
+		zap.String("mmseqs_genome", mmseqsGenomeDB),
+	)
 
 	logger.Info("Start", zap.String("Version", cfg.Version))
 	logger.Info("Open database", zap.String("DB_LOC", sqlitePath))
@@ -152,15 +296,88 @@ func run(cfg AppConfig) error {
 		model.SetGenomeID(sortedIDs)
 		logger.Info("Using manually sorted HEADER with length", zap.Int("len", len(sortedIDs)))
 	}
-	// Serve
-	logger.Info("Server starting", zap.String("addr", cfg.Addr))
-	if httpErr := http.ListenAndServe(cfg.Addr, mux); httpErr != nil {
+	// Serve until SIGINT/SIGTERM, then drain requests. The deferred
+	// blastManager.Stop kills running BLAST processes on the way out.
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: middle.RequestIDMiddleware()(mux),
+	}
+	// Shutdown waits for open connections; end the BLAST event streams first.
+	srv.RegisterOnShutdown(func() { close(shutdown) })
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server starting", zap.String("addr", cfg.Addr))
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case httpErr := <-serveErr:
 		logger.Error("Error starting server", zap.String("error", httpErr.Error()))
 		return httpErr
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("HTTP shutdown did not finish cleanly", zap.Error(err))
 	}
 	return nil
 }
 
+// openJobStore opens the SQLite BLAST job store, falling back to memory when the
+// file cannot be created (e.g. a read-only data mount).
+func openJobStore(cfg AppConfig) db.BlastJobStore {
+	jobDB := cfg.JobDB
+	if jobDB == "" {
+		jobDB = path.Join(cfg.DataDir, "jobs/blast_jobs.db")
+	}
+	if jobDB == "memory" {
+		logger.Info("Keeping BLAST jobs in memory")
+		return db.NewMemoryJobStore()
+	}
+
+	store, err := db.NewSQLiteJobStore(jobDB)
+	if err != nil {
+		logger.Warn("Cannot open BLAST job store; jobs will be lost on restart",
+			zap.String("JOB_DB", jobDB), zap.Error(err))
+		return db.NewMemoryJobStore()
+	}
+	logger.Info("Open BLAST job store", zap.String("JOB_DB", jobDB), zap.Duration("retention", cfg.JobRetention))
+	return store
+}
+
+// openSequenceStore returns the sequence backend picked by cfg: blastDB, or
+// the FASTA files under <data>/db/fasta, each bgzip-compressed (.fa.gz) or
+// plain (.fa) and indexed with samtools faidx.
+func openSequenceStore(cfg AppConfig, blastDB *db.SequenceDB) (db.SequenceStore, error) {
+	if cfg.SequenceBackend == "" || cfg.SequenceBackend == "blastdbcmd" {
+		return blastDB, nil
+	}
+	if cfg.SequenceBackend != "fasta" {
+		return nil, fmt.Errorf("unknown sequence backend %q (want blastdbcmd or fasta)", cfg.SequenceBackend)
+	}
+
+	fasta := func(name string) string {
+		p := path.Join(cfg.DataDir, "db/fasta", name+".fa")
+		if existingPath(p+".gz") != "" {
+			return p + ".gz"
+		}
+		return p
+	}
+	prot, nucl, genome := fasta("genetable_genes_prot"), fasta("genetable_genes_nucl"), fasta("genetable_genomes")
+	store, err := db.NewFastaSequenceDB(prot, nucl, genome)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Reading sequences from FASTA", zap.String("prot", prot), zap.String("nucl", nucl), zap.String("genome", genome))
+	return store, nil
+}
+
 // Move to router.go in the next iteration
 func NewRouter(appConfig *handler.AppContext) *http.ServeMux {
 	mux := http.NewServeMux()
@@ -173,22 +390,50 @@ func NewRouter(appConfig *handler.AppContext) *http.ServeMux {
 	// Main routes
 	mux.HandleFunc("GET /", appConfig.MainPage)
 	mux.HandleFunc("GET /search", appConfig.ClusterSearchPage)
+	mux.HandleFunc("GET /blast", appConfig.BlastHistoryPage)
 	mux.HandleFunc("POST /blast", appConfig.BlastSearchPage)
+	mux.HandleFunc("POST /blast/gene", appConfig.BlastGeneSearch)
+	mux.HandleFunc("POST /blast/region", appConfig.BlastRegionSearch)
+	mux.HandleFunc("GET /blast/gene", appConfig.BlastSearchNeedsPost)
+	mux.HandleFunc("GET /blast/region", appConfig.BlastSearchNeedsPost)
 	mux.HandleFunc("GET /blast/{job_id}", appConfig.BlastStatusPage)
+	mux.HandleFunc("DELETE /blast/{job_id}", appConfig.CancelBlastJob)
+	mux.HandleFunc("POST /blast/{job_id}/cancel", appConfig.CancelBlastJob)
+	mux.HandleFunc("GET /blast/{job_id}/events", appConfig.BlastJobEvents)
+	mux.HandleFunc("GET /blast/{job_id}/clusters", appConfig.BlastClusterHeatmapPage)
+	mux.HandleFunc("GET /blast/{job_id}/best-hits.tsv", appConfig.BlastBestHitsTSV)
+	mux.HandleFunc("GET /blast/{job_id}/download/{format}", appConfig.BlastReportDownload)
 	mux.HandleFunc("GET /cluster/table/{cluster_id}", appConfig.ClusterDetailPage) // Dedicated cluster table page.
+	mux.HandleFunc("GET /cluster/heatmap/{cluster_id}", appConfig.ClusterHeatmapByIDPage)
 	mux.HandleFunc("GET /cluster/heatmap/{genome_id}/{contig_id}/{gene_id}", appConfig.ClusterHeatmapPage)
 	mux.HandleFunc("GET /redirect/blastn/", appConfig.BlastNRedirectPage)
 	mux.HandleFunc("GET /redirect/blastp/", appConfig.BlastPRedirectPage)
 
+	// Heatmap images for figures
+	mux.HandleFunc("GET /image/heatmap.svg", appConfig.HeatmapSVGHandler)
+	mux.HandleFunc("GET /image/heatmap.png", appConfig.HeatmapPNGHandler)
+
 	// API routes
-	// mux.HandleFunc("GET /api/v1/search", appConfig.ClusterSearchAPI)
+	mux.HandleFunc("GET /api/v1/openapi.json", handler.OpenAPISpec)
+	mux.HandleFunc("GET /api/v1/search", appConfig.ClusterSearchAPI)
+	mux.HandleFunc("POST /api/v1/search", appConfig.ClusterSearchAPI)
+	mux.HandleFunc("GET /api/v1/clusters", appConfig.ClusterListAPI)
+	mux.HandleFunc("GET /api/v1/clusters/{cluster_id}", appConfig.ClusterAPI)
+	mux.HandleFunc("GET /api/v1/genomes", appConfig.GenomeListAPI)
+	mux.HandleFunc("GET /api/v1/genes/{genome_id}/{gene_id}", appConfig.GeneAPI)
+	mux.HandleFunc("GET /api/v1/blast", appConfig.BlastHistoryAPI)
+	mux.HandleFunc("POST /api/v1/blast/validate", appConfig.BlastValidateAPI)
+	mux.HandleFunc("GET /api/v1/blast/{job_id}", appConfig.BlastResultAPI)
+	mux.HandleFunc("GET /api/v1/blast/{job_id}/events", appConfig.BlastJobEvents)
 	mux.HandleFunc("GET /api/v1/health", handler.HealthCheck)
-	mux.HandleFunc("GET /api/v1/cluster/{cluster_id}", appConfig.ClusterDetailPage)
+	mux.HandleFunc("GET /api/v1/stats", appConfig.StatsAPI)
+	mux.HandleFunc("GET /api/v1/cluster/{cluster_id}", appConfig.ClusterAPI) // Kept for older clients
 
 	// Get sequences
 	mux.HandleFunc("GET /sequence/by-gene", appConfig.GetGeneSequenceHandler)
 	mux.HandleFunc("GET /sequence/by-region", appConfig.GetRegionSequenceHandler)
 	mux.HandleFunc("GET /sequence/by-cluster", appConfig.GetSequenceByClusterIDHandler)
+	mux.HandleFunc("POST /sequence/batch", appConfig.SequenceBatchHandler)
 
 	// Static
 	setupStaticFiles(mux)
@@ -229,3 +474,41 @@ func getenv(k, default_val string) string {
 	}
 	return default_val
 }
+
+func getenvDuration(k string, default_val time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		fmt.Fprintf(os.Stderr, "ignoring invalid %s %q\n", k, v)
+	}
+	return default_val
+}
+
+func getenvBool(k string, default_val bool) bool {
+	if v := os.Getenv(k); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+		fmt.Fprintf(os.Stderr, "ignoring invalid %s %q\n", k, v)
+	}
+	return default_val
+}
+
+func getenvInt(k string, default_val int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		fmt.Fprintf(os.Stderr, "ignoring invalid %s %q\n", k, v)
+	}
+	return default_val
+}
+
+// existingPath returns p if it exists and "" otherwise.
+func existingPath(p string) string {
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
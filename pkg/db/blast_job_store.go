@@ -0,0 +1,518 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// ErrJobNotFound is returned when a job ID is unknown or has expired.
+var ErrJobNotFound = errors.New("blast job not found")
+
+// ErrNoArchive is returned for jobs without a stored BLAST archive.
+var ErrNoArchive = errors.New("no BLAST archive stored for this job")
+
+// BlastJobStore persists BLAST jobs. Implementations must be safe for concurrent
+// use and must hand out copies, so callers never share a *BlastJob.
+type BlastJobStore interface {
+	Create(job *BlastJob) error
+	Get(id string) (*BlastJob, error)
+	// GetSummary is Get without the job's Result.
+	GetSummary(id string) (*BlastJob, error)
+	Save(job *BlastJob) error
+	// ListByStatus returns jobs in any of the given statuses, oldest first.
+	ListByStatus(statuses ...BlastJobStatus) ([]*BlastJob, error)
+	// FindCompleted returns the most recently finished completed job with the
+	// given cache key, or ErrJobNotFound.
+	FindCompleted(cacheKey string) (*BlastJob, error)
+	// ListByOwner returns up to limit jobs of owner, newest first, without
+	// their Result.
+	ListByOwner(owner string, limit int) ([]*BlastJob, error)
+	// SaveArchive stores the BLAST archive (-outfmt 11) of a job.
+	SaveArchive(jobID string, archive []byte) error
+	// Archive returns a job's BLAST archive, or ErrNoArchive.
+	Archive(jobID string) ([]byte, error)
+	// HasArchive reports whether a BLAST archive is stored for a job.
+	HasArchive(jobID string) (bool, error)
+	// DeleteFinishedBefore removes jobs in a final state last updated before
+	// cutoff, with their archives. Jobs whose result is still reused by a job
+	// that stays (its CachedFrom) are kept.
+	DeleteFinishedBefore(cutoff time.Time) (int, error)
+	Close() error
+}
+
+// finishedStatuses are the states retention may prune.
+var finishedStatuses = []BlastJobStatus{BlastJobCompleted, BlastJobFailed, BlastJobCancelled, BlastJobTimedOut}
+
+func (job *BlastJob) clone() *BlastJob {
+	c := *job
+	if job.Params != nil {
+		c.Params = append(json.RawMessage(nil), job.Params...)
+	}
+	return &c
+}
+
+// MemoryJobStore keeps jobs in memory; they are lost on restart.
+type MemoryJobStore struct {
+	mu       sync.RWMutex
+	jobs     map[string]*BlastJob
+	archives map[string][]byte
+}
+
+// NewMemoryJobStore constructs an empty in-memory store.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]*BlastJob), archives: make(map[string][]byte)}
+}
+
+func (s *MemoryJobStore) Create(job *BlastJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; ok {
+		return fmt.Errorf("blast job %s already exists", job.ID)
+	}
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+func (s *MemoryJobStore) Get(id string) (*BlastJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job.clone(), nil
+}
+
+func (s *MemoryJobStore) GetSummary(id string) (*BlastJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	job.Result = ""
+	return job, nil
+}
+
+func (s *MemoryJobStore) Save(job *BlastJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrJobNotFound
+	}
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+func (s *MemoryJobStore) ListByStatus(statuses ...BlastJobStatus) ([]*BlastJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*BlastJob
+	for _, job := range s.jobs {
+		for _, st := range statuses {
+			if job.Status == st {
+				out = append(out, job.clone())
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryJobStore) FindCompleted(cacheKey string) (*BlastJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found *BlastJob
+	for _, job := range s.jobs {
+		if job.Status == BlastJobCompleted && job.CacheKey == cacheKey && (found == nil || job.UpdatedAt.After(found.UpdatedAt)) {
+			found = job
+		}
+	}
+	if found == nil {
+		return nil, ErrJobNotFound
+	}
+	return found.clone(), nil
+}
+
+func (s *MemoryJobStore) ListByOwner(owner string, limit int) ([]*BlastJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*BlastJob
+	for _, job := range s.jobs {
+		if job.Owner == owner {
+			summary := job.clone()
+			summary.Result = ""
+			out = append(out, summary)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryJobStore) SaveArchive(jobID string, archive []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[jobID]; !ok {
+		return ErrJobNotFound
+	}
+	s.archives[jobID] = append([]byte(nil), archive...)
+	return nil
+}
+
+func (s *MemoryJobStore) Archive(jobID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	archive, ok := s.archives[jobID]
+	if !ok {
+		return nil, ErrNoArchive
+	}
+	return append([]byte(nil), archive...), nil
+}
+
+func (s *MemoryJobStore) HasArchive(jobID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.archives[jobID]
+	return ok, nil
+}
+
+func (s *MemoryJobStore) DeleteFinishedBefore(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := func(job *BlastJob) bool { return job.Status.Finished() && job.UpdatedAt.Before(cutoff) }
+	reused := make(map[string]bool)
+	for _, job := range s.jobs {
+		if job.CachedFrom != "" && !expired(job) {
+			reused[job.CachedFrom] = true
+		}
+	}
+	n := 0
+	for id, job := range s.jobs {
+		if expired(job) && !reused[id] {
+			delete(s.jobs, id)
+			delete(s.archives, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryJobStore) Close() error { return nil }
+
+// sqliteJobMigrations are applied in order; PRAGMA user_version records how many ran.
+var sqliteJobMigrations = []string{
+	`CREATE TABLE blast_jobs (
+		id          TEXT PRIMARY KEY,
+		blast_type  TEXT NOT NULL,
+		target_db   TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		params      TEXT,
+		result      TEXT NOT NULL DEFAULT '',
+		error       TEXT NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		cache_key   TEXT NOT NULL DEFAULT '',
+		cached_from TEXT NOT NULL DEFAULT '',
+		owner       TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX idx_blast_jobs_status_updated ON blast_jobs (status, updated_at);
+	CREATE INDEX idx_blast_jobs_cache_key ON blast_jobs (cache_key, status, updated_at);
+	CREATE INDEX idx_blast_jobs_owner ON blast_jobs (owner, created_at);
+	-- Kept apart from blast_jobs so that loading a job does not read its archive.
+	CREATE TABLE blast_archives (
+		job_id  TEXT PRIMARY KEY,
+		archive BLOB NOT NULL
+	);`,
+}
+
+// SQLiteJobStore keeps jobs in their own SQLite file, separate from the
+// (read-only) gene table database, so results survive restarts.
+type SQLiteJobStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteJobStore opens or creates the job database at path and migrates it.
+func NewSQLiteJobStore(path string) (*SQLiteJobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create job store directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous(NORMAL)", path)
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One writer at a time; SQLite serializes writes anyway.
+	conn.SetMaxOpenConns(1)
+
+	store := &SQLiteJobStore{db: conn}
+	if err := store.migrate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("migrate job store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (s *SQLiteJobStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteJobMigrations) {
+		return fmt.Errorf("job store schema version %d is newer than supported (%d)", version, len(sqliteJobMigrations))
+	}
+
+	for i := version; i < len(sqliteJobMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteJobMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not take bind parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const sqliteJobColumns = `id, blast_type, target_db, status, params, result, error, created_at, updated_at, cache_key, cached_from, owner`
+
+// sqliteJobSummaryColumns leaves out the result, which can be megabytes.
+const sqliteJobSummaryColumns = `id, blast_type, target_db, status, params, error, created_at, updated_at, owner`
+
+func (s *SQLiteJobStore) Create(job *BlastJob) error {
+	_, err := s.db.Exec(`INSERT INTO blast_jobs (`+sqliteJobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.BlastType, job.Database, string(job.Status), nullableJSON(job.Params), job.Result, job.Error,
+		job.CreatedAt.UnixNano(), job.UpdatedAt.UnixNano(), job.CacheKey, job.CachedFrom, job.Owner)
+	return err
+}
+
+func (s *SQLiteJobStore) Get(id string) (*BlastJob, error) {
+	row := s.db.QueryRow(`SELECT `+sqliteJobColumns+` FROM blast_jobs WHERE id = ?`, id)
+	job, err := scanBlastJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+func (s *SQLiteJobStore) GetSummary(id string) (*BlastJob, error) {
+	row := s.db.QueryRow(`SELECT `+sqliteJobSummaryColumns+` FROM blast_jobs WHERE id = ?`, id)
+	job, err := scanBlastJobSummary(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+func (s *SQLiteJobStore) Save(job *BlastJob) error {
+	res, err := s.db.Exec(`UPDATE blast_jobs
+		SET blast_type = ?, target_db = ?, status = ?, params = ?, result = ?, error = ?, updated_at = ?,
+			cache_key = ?, cached_from = ?, owner = ?
+		WHERE id = ?`,
+		job.BlastType, job.Database, string(job.Status), nullableJSON(job.Params), job.Result, job.Error,
+		job.UpdatedAt.UnixNano(), job.CacheKey, job.CachedFrom, job.Owner, job.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// statusArgs returns "?,?,..." and the matching arguments for a status IN clause.
+func statusArgs(statuses []BlastJobStatus) (string, []interface{}) {
+	args := make([]interface{}, len(statuses))
+	for i, st := range statuses {
+		args[i] = string(st)
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ","), args
+}
+
+func (s *SQLiteJobStore) ListByStatus(statuses ...BlastJobStatus) ([]*BlastJob, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	placeholders, args := statusArgs(statuses)
+
+	rows, err := s.db.Query(`SELECT `+sqliteJobColumns+` FROM blast_jobs
+		WHERE status IN (`+placeholders+`) ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlastJobs(rows)
+}
+
+func (s *SQLiteJobStore) ListByOwner(owner string, limit int) ([]*BlastJob, error) {
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	rows, err := s.db.Query(`SELECT `+sqliteJobSummaryColumns+` FROM blast_jobs
+		WHERE owner = ? ORDER BY created_at DESC LIMIT ?`, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*BlastJob
+	for rows.Next() {
+		job, err := scanBlastJobSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, job)
+	}
+	return out, rows.Err()
+}
+
+func scanBlastJobs(rows *sql.Rows) ([]*BlastJob, error) {
+	defer rows.Close()
+
+	var out []*BlastJob
+	for rows.Next() {
+		job, err := scanBlastJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, job)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteJobStore) FindCompleted(cacheKey string) (*BlastJob, error) {
+	row := s.db.QueryRow(`SELECT `+sqliteJobColumns+` FROM blast_jobs
+		WHERE cache_key = ? AND status = ? ORDER BY updated_at DESC LIMIT 1`, cacheKey, string(BlastJobCompleted))
+	job, err := scanBlastJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+func (s *SQLiteJobStore) SaveArchive(jobID string, archive []byte) error {
+	if _, err := s.Get(jobID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO blast_archives (job_id, archive) VALUES (?, ?)`, jobID, archive)
+	return err
+}
+
+func (s *SQLiteJobStore) Archive(jobID string) ([]byte, error) {
+	var archive []byte
+	err := s.db.QueryRow(`SELECT archive FROM blast_archives WHERE job_id = ?`, jobID).Scan(&archive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoArchive
+	}
+	return archive, err
+}
+
+func (s *SQLiteJobStore) HasArchive(jobID string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM blast_archives WHERE job_id = ?`, jobID).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQLiteJobStore) DeleteFinishedBefore(cutoff time.Time) (int, error) {
+	placeholders, statuses := statusArgs(finishedStatuses)
+	expired := `status IN (` + placeholders + `) AND updated_at < ?`
+	where := expired + ` AND id NOT IN (SELECT cached_from FROM blast_jobs WHERE cached_from != '' AND NOT (` + expired + `))`
+	var args []interface{}
+	for range 2 {
+		args = append(append(args, statuses...), cutoff.UnixNano())
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM blast_archives WHERE job_id IN (SELECT id FROM blast_jobs WHERE `+where+`)`, args...); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM blast_jobs WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+func (s *SQLiteJobStore) Close() error { return s.db.Close() }
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBlastJob(row rowScanner) (*BlastJob, error) {
+	var (
+		job       BlastJob
+		status    string
+		params    sql.NullString
+		createdAt int64
+		updatedAt int64
+	)
+	if err := row.Scan(&job.ID, &job.BlastType, &job.Database, &status, &params, &job.Result, &job.Error, &createdAt, &updatedAt,
+		&job.CacheKey, &job.CachedFrom, &job.Owner); err != nil {
+		return nil, err
+	}
+	job.Status = BlastJobStatus(status)
+	if params.Valid && params.String != "" {
+		job.Params = json.RawMessage(params.String)
+	}
+	job.CreatedAt = time.Unix(0, createdAt)
+	job.UpdatedAt = time.Unix(0, updatedAt)
+	return &job, nil
+}
+
+// scanBlastJobSummary reads the sqliteJobSummaryColumns of a job.
+func scanBlastJobSummary(row rowScanner) (*BlastJob, error) {
+	var (
+		job       BlastJob
+		status    string
+		params    sql.NullString
+		createdAt int64
+		updatedAt int64
+	)
+	if err := row.Scan(&job.ID, &job.BlastType, &job.Database, &status, &params, &job.Error,
+		&createdAt, &updatedAt, &job.Owner); err != nil {
+		return nil, err
+	}
+	job.Status = BlastJobStatus(status)
+	if params.Valid && params.String != "" {
+		job.Params = json.RawMessage(params.String)
+	}
+	job.CreatedAt = time.Unix(0, createdAt)
+	job.UpdatedAt = time.Unix(0, updatedAt)
+	return &job, nil
+}
+
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -1,8 +1,12 @@
 package db
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -16,103 +20,566 @@ const (
 	BlastJobRunning   BlastJobStatus = "running"
 	BlastJobCompleted BlastJobStatus = "completed"
 	BlastJobFailed    BlastJobStatus = "failed"
+	BlastJobCancelled BlastJobStatus = "cancelled"
+	BlastJobTimedOut  BlastJobStatus = "timed_out"
 )
 
+// Finished reports whether the job has reached a final state.
+func (s BlastJobStatus) Finished() bool {
+	switch s {
+	case BlastJobCompleted, BlastJobFailed, BlastJobCancelled, BlastJobTimedOut:
+		return true
+	}
+	return false
+}
+
 // BlastJob keeps track of the BLAST execution state while the command runs.
 type BlastJob struct {
 	ID        string
-	BlastType string
+	BlastType string // BLAST program, e.g. "tblastn"
+	Database  string // Target database, e.g. "genes" or "genomes"
 	Status    BlastJobStatus
+	Params    json.RawMessage // The submitted request, so a job can be inspected or re-run
 	Result    string
 	Error     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	CacheKey   string // Identifies the search for result reuse; empty disables reuse
+	CachedFrom string // ID of the job that ran the search whose result was reused, if any
+	Owner      string // Opaque ID of the submitter (session or API key); empty if unknown
 }
 
-const maxJobs = 3
+// DefaultJobRetention is how long finished jobs are kept.
+const DefaultJobRetention = 7 * 24 * time.Hour
+
+// pruneInterval limits how often NewJob sweeps expired jobs.
+const pruneInterval = time.Minute
+
+// ErrQueueFull is returned by Submit when every queue slot is taken.
+var ErrQueueFull = errors.New("blast queue is full")
+
+// ErrJobFinished is returned by Cancel for jobs that already reached a final state.
+var ErrJobFinished = errors.New("blast job already finished")
+
+// Causes attached to a running job's context, so the worker knows why it stopped.
+var (
+	errJobCancelled  = errors.New("cancelled by user")
+	errJobTimedOut   = errors.New("job timed out")
+	errServerStopped = errors.New("server shutting down")
+)
+
+// BlastRunFunc executes a job and returns its report. It is called by the worker
+// pool and must stop the BLAST process when ctx is done.
+type BlastRunFunc func(ctx context.Context, job *BlastJob) (string, error)
+
+// runningJob lets Cancel stop a job and wait until its final state is recorded.
+type runningJob struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
 
-// BlastManager stores BLAST job states indexed by job ID.
+// BlastManager tracks BLAST job states on top of a BlastJobStore and runs
+// queued jobs on a fixed number of workers.
 type BlastManager struct {
-	mu       sync.RWMutex
-	jobs     map[string]*BlastJob
-	jobOrder []string
+	mu        sync.Mutex // Serializes read-modify-write of a job
+	store     BlastJobStore
+	retention time.Duration
+	lastPrune time.Time
+
+	qmu        sync.Mutex
+	qcond      *sync.Cond
+	queue      []string // Job IDs waiting for a worker, oldest first
+	queueSize  int
+	jobTimeout time.Duration
+	running    map[string]*runningJob
+	stopped    bool
+	workers    sync.WaitGroup
+	baseCtx    context.Context
+	stopAll    context.CancelCauseFunc
+
+	nmu     sync.Mutex
+	changed chan struct{} // Closed and replaced on every job or queue change
+
+	onFinished func(job *BlastJob) // Set by OnFinished; called without locks held
+}
+
+// NewBlastManager constructs a job manager. Finished jobs older than retention
+// are removed; a retention of zero or less keeps them forever.
+func NewBlastManager(store BlastJobStore, retention time.Duration) *BlastManager {
+	m := &BlastManager{
+		store:     store,
+		retention: retention,
+		running:   make(map[string]*runningJob),
+		changed:   make(chan struct{}),
+	}
+	m.qcond = sync.NewCond(&m.qmu)
+	m.baseCtx, m.stopAll = context.WithCancelCause(context.Background())
+	return m
+}
+
+// StartWorkers starts workers goroutines that run queued jobs in FIFO order.
+// At most queueSize jobs may wait; Submit rejects the rest with ErrQueueFull.
+// Jobs running longer than timeout are killed; zero means no limit.
+func (m *BlastManager) StartWorkers(workers, queueSize int, timeout time.Duration, run BlastRunFunc) {
+	m.qmu.Lock()
+	m.queueSize = queueSize
+	m.jobTimeout = timeout
+	m.qmu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		m.workers.Add(1)
+		go m.worker(run)
+	}
+}
+
+// Stop stops taking jobs off the queue, kills running BLAST processes and waits
+// for the workers to exit. Killed and waiting jobs stay queued in the store and
+// are picked up again by RequeueInterrupted on the next start.
+func (m *BlastManager) Stop() {
+	m.qmu.Lock()
+	m.stopped = true
+	m.qcond.Broadcast()
+	m.qmu.Unlock()
+	m.stopAll(errServerStopped)
+	m.workers.Wait()
+}
+
+// Cancel stops a queued or running job. For a running job it kills the BLAST
+// process and waits briefly until the cancelled state is recorded.
+func (m *BlastManager) Cancel(jobID string) error {
+	m.qmu.Lock()
+	for i, id := range m.queue {
+		if id == jobID {
+			m.queue = append(m.queue[:i:i], m.queue[i+1:]...)
+			m.qmu.Unlock()
+			return m.markCancelled(jobID)
+		}
+	}
+	if rj, ok := m.running[jobID]; ok {
+		m.qmu.Unlock()
+		rj.cancel(errJobCancelled)
+		select {
+		case <-rj.done:
+		case <-time.After(10 * time.Second):
+		}
+		return nil
+	}
+	m.qmu.Unlock()
+
+	job, err := m.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status.Finished() {
+		return ErrJobFinished
+	}
+	// Queued in the store but not yet requeued in this process.
+	return m.markCancelled(jobID)
+}
+
+func (m *BlastManager) markCancelled(jobID string) error {
+	return m.updateJob(jobID, func(job *BlastJob) {
+		job.Status = BlastJobCancelled
+		job.Error = "cancelled by user"
+	})
+}
+
+// Submit creates a queued job and hands it to the worker pool.
+func (m *BlastManager) Submit(blastType, database string, params interface{}) (*BlastJob, error) {
+	return m.SubmitCached(blastType, database, "", params)
+}
+
+// SubmitCached is Submit for searches identified by cacheKey. If a completed
+// job with the same key exists, the new job is created completed with its
+// result and never queued. Queued jobs check the cache again before running.
+func (m *BlastManager) SubmitCached(blastType, database, cacheKey string, params interface{}) (*BlastJob, error) {
+	return m.SubmitAs("", blastType, database, cacheKey, params)
+}
+
+// SubmitAs is SubmitCached for a job owned by owner, so it shows up in
+// ListJobs(owner).
+func (m *BlastManager) SubmitAs(owner, blastType, database, cacheKey string, params interface{}) (*BlastJob, error) {
+	if cacheKey != "" {
+		cached, err := m.store.FindCompleted(cacheKey)
+		if err == nil {
+			return m.newJob(owner, blastType, database, cacheKey, params, cached)
+		} else if !errors.Is(err, ErrJobNotFound) {
+			return nil, err
+		}
+	}
+
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+
+	if m.stopped || len(m.queue) >= m.queueSize {
+		return nil, ErrQueueFull
+	}
+
+	job, err := m.newJob(owner, blastType, database, cacheKey, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.queue = append(m.queue, job.ID)
+	m.qcond.Signal()
+	return job, nil
+}
+
+// OnFinished registers fn to be called with a copy of each job that reaches a
+// final state, e.g. to notify its submitter. fn must not block. Call it before
+// StartWorkers.
+func (m *BlastManager) OnFinished(fn func(job *BlastJob)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFinished = fn
+}
+
+func (m *BlastManager) finished(job *BlastJob) {
+	m.mu.Lock()
+	fn := m.onFinished
+	m.mu.Unlock()
+	if fn != nil {
+		fn(job.clone())
+	}
+}
+
+// QueuePosition returns the 1-based position of a waiting job, or 0 if it is not waiting.
+func (m *BlastManager) QueuePosition(jobID string) int {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+	for i, id := range m.queue {
+		if id == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Changes returns a channel that is closed the next time a job's state or the
+// queue changes. Watchers take the channel before reading the state they
+// compare, so no change is missed.
+func (m *BlastManager) Changes() <-chan struct{} {
+	m.nmu.Lock()
+	defer m.nmu.Unlock()
+	return m.changed
+}
+
+func (m *BlastManager) notify() {
+	m.nmu.Lock()
+	close(m.changed)
+	m.changed = make(chan struct{})
+	m.nmu.Unlock()
 }
 
-// NewBlastManager constructs a job manager.
-func NewBlastManager() *BlastManager {
-	return &BlastManager{
-		jobs:     make(map[string]*BlastJob),
-		jobOrder: make([]string, 0, maxJobs+1),
+// QueueLength returns the number of jobs waiting for a worker.
+func (m *BlastManager) QueueLength() int {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+	return len(m.queue)
+}
+
+func (m *BlastManager) worker(run BlastRunFunc) {
+	defer m.workers.Done()
+	for {
+		m.qmu.Lock()
+		for len(m.queue) == 0 && !m.stopped {
+			m.qcond.Wait()
+		}
+		if m.stopped {
+			m.qmu.Unlock()
+			return
+		}
+		jobID := m.queue[0]
+		m.queue = m.queue[1:]
+		m.notify() // Queue positions moved up
+
+		// Register under the queue lock so Cancel always finds the job somewhere.
+		ctx, cancel := context.WithCancelCause(m.baseCtx)
+		rj := &runningJob{cancel: cancel, done: make(chan struct{})}
+		m.running[jobID] = rj
+		timeout := m.jobTimeout
+		m.qmu.Unlock()
+
+		m.runJob(ctx, timeout, jobID, run)
+
+		cancel(nil)
+		m.qmu.Lock()
+		delete(m.running, jobID)
+		m.qmu.Unlock()
+		close(rj.done)
 	}
 }
 
-// NewJob registers a queued job for the provided BLAST type and cleans up old jobs.
-func (m *BlastManager) NewJob(blastType string) *BlastJob {
+func (m *BlastManager) runJob(ctx context.Context, timeout time.Duration, jobID string, run BlastRunFunc) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errJobTimedOut)
+		defer cancel()
+	}
+
+	if err := m.SetRunning(jobID); err != nil {
+		return // Expired or removed while waiting
+	}
+	job, err := m.GetJob(jobID)
+	if err != nil {
+		return
+	}
+	// An identical search may have finished while this one waited.
+	if job.CacheKey != "" {
+		if cached, err := m.store.FindCompleted(job.CacheKey); err == nil {
+			_ = m.updateJob(jobID, func(job *BlastJob) {
+				job.Status = BlastJobCompleted
+				job.Result = cached.Result
+				job.CachedFrom = resultOrigin(cached)
+			})
+			return
+		}
+	}
+
+	result, err := func() (result string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("BLAST job panicked: %v", r)
+			}
+		}()
+		return run(ctx, job)
+	}()
+
+	if ctx.Err() != nil {
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errJobCancelled):
+			_ = m.markCancelled(jobID)
+		case errors.Is(cause, errJobTimedOut):
+			_ = m.updateJob(jobID, func(job *BlastJob) {
+				job.Status = BlastJobTimedOut
+				job.Error = fmt.Sprintf("the search exceeded the time limit of %s", timeout)
+			})
+		case errors.Is(cause, errServerStopped):
+			// Leave it for RequeueInterrupted after the restart.
+			_ = m.updateJob(jobID, func(job *BlastJob) {
+				job.Status = BlastJobQueued
+			})
+		default:
+			_ = m.FailJob(jobID, cause)
+		}
+		return
+	}
+
+	if err != nil {
+		_ = m.FailJob(jobID, err)
+		return
+	}
+	_ = m.CompleteJob(jobID, result)
+}
+
+// resultOrigin returns the ID of the job that ran the search whose result
+// cached carries, which is the one that holds its archive.
+func resultOrigin(cached *BlastJob) string {
+	if cached.CachedFrom != "" {
+		return cached.CachedFrom
+	}
+	return cached.ID
+}
+
+// NewJob registers a queued job with its request parameters and cleans up expired jobs.
+func (m *BlastManager) NewJob(blastType, database string, params interface{}) (*BlastJob, error) {
+	return m.newJob("", blastType, database, "", params, nil)
+}
+
+// newJob creates a queued job, or a completed one carrying cached's result.
+func (m *BlastManager) newJob(owner, blastType, database, cacheKey string, params interface{}, cached *BlastJob) (*BlastJob, error) {
+	now := time.Now()
 	job := &BlastJob{
 		ID:        generateJobID(),
 		BlastType: blastType,
+		Database:  database,
 		Status:    BlastJobQueued,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		CacheKey:  cacheKey,
+		Owner:     owner,
+	}
+	if cached != nil {
+		job.Status = BlastJobCompleted
+		job.Result = cached.Result
+		job.CachedFrom = resultOrigin(cached)
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		job.Params = raw
+	}
+
+	if err := m.store.Create(job); err != nil {
+		return nil, err
+	}
+	if job.Status.Finished() {
+		m.finished(job)
 	}
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	due := m.retention > 0 && now.Sub(m.lastPrune) >= pruneInterval
+	if due {
+		m.lastPrune = now
+	}
+	m.mu.Unlock()
+	if due {
+		// Expired jobs are only an inconvenience; never fail a submission over them.
+		_, _ = m.PruneExpired()
+	}
+
+	return job, nil
+}
 
-	m.jobs[job.ID] = job
-	m.jobOrder = append(m.jobOrder, job.ID)
+// PruneExpired removes finished jobs older than the retention period.
+func (m *BlastManager) PruneExpired() (int, error) {
+	if m.retention <= 0 {
+		return 0, nil
+	}
+	return m.store.DeleteFinishedBefore(time.Now().Add(-m.retention))
+}
 
-	if len(m.jobOrder) > maxJobs {
-		jobIDToRemove := m.jobOrder[0]
-		delete(m.jobs, jobIDToRemove)
-		m.jobOrder = m.jobOrder[1:]
+// RequeueInterrupted puts jobs left queued or running by a previous process back
+// on the queue, oldest first. Jobs without stored parameters cannot be re-run and
+// are marked failed. Recovered jobs may exceed the queue size.
+func (m *BlastManager) RequeueInterrupted() (int, error) {
+	jobs, err := m.store.ListByStatus(BlastJobQueued, BlastJobRunning)
+	if err != nil {
+		return 0, err
 	}
 
-	return job
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+
+	requeued := 0
+	for _, job := range jobs {
+		if len(job.Params) == 0 {
+			if err := m.updateJob(job.ID, func(job *BlastJob) {
+				job.Status = BlastJobFailed
+				job.Error = "interrupted by a server restart; please submit the search again"
+			}); err != nil {
+				return requeued, err
+			}
+			continue
+		}
+		if job.Status == BlastJobRunning {
+			if err := m.updateJob(job.ID, func(job *BlastJob) {
+				job.Status = BlastJobQueued
+			}); err != nil {
+				return requeued, err
+			}
+		}
+		m.queue = append(m.queue, job.ID)
+		requeued++
+	}
+	m.qcond.Broadcast()
+	m.notify()
+	return requeued, nil
 }
 
 // SetRunning marks the job as running.
-func (m *BlastManager) SetRunning(jobID string) {
-	m.updateJob(jobID, func(job *BlastJob) {
+func (m *BlastManager) SetRunning(jobID string) error {
+	return m.updateJob(jobID, func(job *BlastJob) {
 		job.Status = BlastJobRunning
 	})
 }
 
 // CompleteJob stores the BLAST output and marks the job complete.
-func (m *BlastManager) CompleteJob(jobID string, result string) {
-	m.updateJob(jobID, func(job *BlastJob) {
+func (m *BlastManager) CompleteJob(jobID string, result string) error {
+	return m.updateJob(jobID, func(job *BlastJob) {
 		job.Status = BlastJobCompleted
 		job.Result = result
 	})
 }
 
 // FailJob records a failure and attaches a user-facing error message.
-func (m *BlastManager) FailJob(jobID string, err error) {
-	m.updateJob(jobID, func(job *BlastJob) {
+func (m *BlastManager) FailJob(jobID string, err error) error {
+	return m.updateJob(jobID, func(job *BlastJob) {
 		job.Status = BlastJobFailed
 		job.Error = err.Error()
 	})
 }
 
-// GetJob fetches a job by ID.
-func (m *BlastManager) GetJob(jobID string) (*BlastJob, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	job, ok := m.jobs[jobID]
-	return job, ok
+// GetJob fetches a job by ID. It returns ErrJobNotFound for unknown or expired jobs.
+func (m *BlastManager) GetJob(jobID string) (*BlastJob, error) {
+	return m.store.Get(jobID)
+}
+
+// JobStatus fetches a job without its result, for callers that only follow
+// its state. It returns ErrJobNotFound for unknown or expired jobs.
+func (m *BlastManager) JobStatus(jobID string) (*BlastJob, error) {
+	return m.store.GetSummary(jobID)
+}
+
+// ListJobs returns up to limit of owner's jobs, newest first. Jobs without an
+// owner are never listed.
+func (m *BlastManager) ListJobs(owner string, limit int) ([]*BlastJob, error) {
+	if owner == "" {
+		return nil, nil
+	}
+	return m.store.ListByOwner(owner, limit)
+}
+
+// SaveArchive stores the BLAST archive of a job, from which other report
+// formats can be produced later.
+func (m *BlastManager) SaveArchive(jobID string, archive []byte) error {
+	return m.store.SaveArchive(jobID, archive)
+}
+
+// Archive returns the BLAST archive of a job. A job answered from the cache
+// shares the archive of the job that ran the search. It returns ErrNoArchive if there is none.
+func (m *BlastManager) Archive(job *BlastJob) ([]byte, error) {
+	archive, err := m.store.Archive(job.ID)
+	if errors.Is(err, ErrNoArchive) && job.CachedFrom != "" {
+		return m.store.Archive(job.CachedFrom)
+	}
+	return archive, err
+}
+
+// HasArchive reports whether Archive would find an archive for job.
+func (m *BlastManager) HasArchive(job *BlastJob) (bool, error) {
+	ok, err := m.store.HasArchive(job.ID)
+	if err == nil && !ok && job.CachedFrom != "" {
+		return m.store.HasArchive(job.CachedFrom)
+	}
+	return ok, err
 }
 
-func (m *BlastManager) updateJob(jobID string, update func(job *BlastJob)) {
+// Close releases the underlying store.
+func (m *BlastManager) Close() error {
+	return m.store.Close()
+}
+
+func (m *BlastManager) updateJob(jobID string, update func(job *BlastJob)) error {
+	job, wasFinished, err := m.saveUpdate(jobID, update)
+	if err != nil {
+		return err
+	}
+	m.notify()
+	if !wasFinished && job.Status.Finished() {
+		m.finished(job)
+	}
+	return nil
+}
+
+func (m *BlastManager) saveUpdate(jobID string, update func(job *BlastJob)) (*BlastJob, bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	job, ok := m.jobs[jobID]
-	if !ok {
-		return
+	job, err := m.store.Get(jobID)
+	if err != nil {
+		return nil, false, err
 	}
+	wasFinished := job.Status.Finished()
 
 	update(job)
 	job.UpdatedAt = time.Now()
+	if err := m.store.Save(job); err != nil {
+		return nil, false, err
+	}
+	return job, wasFinished, nil
 }
 
 func generateJobID() string {
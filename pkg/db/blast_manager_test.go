@@ -1,61 +1,579 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func TestBlastManager_JobLimit(t *testing.T) {
-	m := NewBlastManager()
-	numJobsToAdd := 10
-	
-	// Create predictable job IDs
-	var jobIDs []string
-	for i := 0; i < numJobsToAdd; i++ {
-		jobIDs = append(jobIDs, fmt.Sprintf("job-%d", i))
-	}
-
-	m.mu.Lock()
-	for i := 0; i < numJobsToAdd; i++ {
-		jobID := jobIDs[i]
-		job := &BlastJob{ID: jobID}
-		m.jobs[job.ID] = job
-		m.jobOrder = append(m.jobOrder, job.ID)
-
-		if len(m.jobOrder) > maxJobs {
-			jobIDToRemove := m.jobOrder[0]
-			delete(m.jobs, jobIDToRemove)
-			m.jobOrder = m.jobOrder[1:]
-		}
+func jobStores(t *testing.T) map[string]BlastJobStore {
+	t.Helper()
+	sqliteStore, err := NewSQLiteJobStore(filepath.Join(t.TempDir(), "jobs", "blast_jobs.db"))
+	if err != nil {
+		t.Fatalf("open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	return map[string]BlastJobStore{
+		"memory": NewMemoryJobStore(),
+		"sqlite": sqliteStore,
+	}
+}
+
+func TestBlastManager_Lifecycle(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewBlastManager(store, DefaultJobRetention)
+
+			job, err := m.NewJob("blastp", "genes", map[string]string{"sequence": "MKV"})
+			if err != nil {
+				t.Fatalf("new job: %v", err)
+			}
+			if err := m.SetRunning(job.ID); err != nil {
+				t.Fatalf("set running: %v", err)
+			}
+			if err := m.CompleteJob(job.ID, "report"); err != nil {
+				t.Fatalf("complete: %v", err)
+			}
+
+			got, err := m.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("get job: %v", err)
+			}
+			if got.Status != BlastJobCompleted || got.Result != "report" || got.BlastType != "blastp" || got.Database != "genes" {
+				t.Errorf("unexpected job %+v", got)
+			}
+			if string(got.Params) != `{"sequence":"MKV"}` {
+				t.Errorf("params = %s", got.Params)
+			}
+			if !got.UpdatedAt.After(got.CreatedAt) && !got.UpdatedAt.Equal(got.CreatedAt) {
+				t.Errorf("updated_at %v before created_at %v", got.UpdatedAt, got.CreatedAt)
+			}
+
+			if _, err := m.GetJob("missing"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("missing job error = %v, want ErrJobNotFound", err)
+			}
+		})
 	}
-	m.mu.Unlock()
+}
+
+func TestBlastManager_Retention(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewBlastManager(store, time.Hour)
+			old := time.Now().Add(-2 * time.Hour)
 
+			for _, job := range []*BlastJob{
+				{ID: "old-done", Status: BlastJobCompleted, CreatedAt: old, UpdatedAt: old},
+				{ID: "old-failed", Status: BlastJobFailed, CreatedAt: old, UpdatedAt: old},
+				{ID: "old-running", Status: BlastJobRunning, CreatedAt: old, UpdatedAt: old},
+				{ID: "new-done", Status: BlastJobCompleted, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			} {
+				if err := store.Create(job); err != nil {
+					t.Fatalf("create %s: %v", job.ID, err)
+				}
+			}
+
+			n, err := m.PruneExpired()
+			if err != nil {
+				t.Fatalf("prune: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("pruned %d jobs, want 2", n)
+			}
+			for id, wantKept := range map[string]bool{"old-done": false, "old-failed": false, "old-running": true, "new-done": true} {
+				_, err := m.GetJob(id)
+				if kept := err == nil; kept != wantKept {
+					t.Errorf("job %s kept = %v, want %v", id, kept, wantKept)
+				}
+			}
+		})
+	}
+}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+func TestBlastManager_RequeueInterrupted(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// A previous process left queued and running jobs behind.
+			before := NewBlastManager(store, DefaultJobRetention)
+			queued, _ := before.NewJob("blastn", "genes", map[string]string{"sequence": "ACGT"})
+			running, _ := before.NewJob("blastn", "genes", map[string]string{"sequence": "TTTT"})
+			noParams, _ := before.NewJob("blastn", "genes", nil)
+			_ = before.SetRunning(running.ID)
 
-	// Check that the number of jobs is equal to maxJobs
-	if len(m.jobs) != maxJobs {
-		t.Errorf("expected %d jobs, but got %d", maxJobs, len(m.jobs))
+			m := NewBlastManager(store, DefaultJobRetention)
+			n, err := m.RequeueInterrupted()
+			if err != nil || n != 2 {
+				t.Fatalf("RequeueInterrupted = %d, %v; want 2, nil", n, err)
+			}
+			if m.QueuePosition(queued.ID) != 1 || m.QueuePosition(running.ID) != 2 {
+				t.Errorf("unexpected queue order: %d, %d", m.QueuePosition(queued.ID), m.QueuePosition(running.ID))
+			}
+			if job, _ := m.GetJob(running.ID); job.Status != BlastJobQueued {
+				t.Errorf("interrupted running job status = %s, want queued", job.Status)
+			}
+			if job, _ := m.GetJob(noParams.ID); job.Status != BlastJobFailed {
+				t.Errorf("job without params status = %s, want failed", job.Status)
+			}
+		})
+	}
+}
+
+func TestBlastManager_WorkerPool(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	var (
+		orderMu sync.Mutex
+		order   []string
+	)
+	m.StartWorkers(1, 2, 0, func(ctx context.Context, job *BlastJob) (string, error) {
+		started <- job.ID
+		<-release
+		orderMu.Lock()
+		order = append(order, job.ID)
+		orderMu.Unlock()
+		if job.BlastType == "fail" {
+			return "", errors.New("boom")
+		}
+		return "report " + job.ID, nil
+	})
+
+	first, err := m.Submit("blastn", "genes", nil)
+	if err != nil {
+		t.Fatalf("submit first: %v", err)
+	}
+	<-started // the single worker is now busy
+
+	second, _ := m.Submit("fail", "genes", nil)
+	third, _ := m.Submit("blastn", "genes", nil)
+	if m.QueuePosition(second.ID) != 1 || m.QueuePosition(third.ID) != 2 || m.QueuePosition(first.ID) != 0 {
+		t.Fatalf("queue positions = %d, %d, %d", m.QueuePosition(first.ID), m.QueuePosition(second.ID), m.QueuePosition(third.ID))
+	}
+	if _, err := m.Submit("blastn", "genes", nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("submit to full queue: err = %v, want ErrQueueFull", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := m.GetJob(third.ID)
+		if job.Status == BlastJobCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs did not finish; last status %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	m.Stop()
 
-	if len(m.jobOrder) != maxJobs {
-		t.Errorf("expected %d jobOrder length, but got %d", maxJobs, len(m.jobOrder))
+	orderMu.Lock()
+	defer orderMu.Unlock()
+	if want := []string{first.ID, second.ID, third.ID}; strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("run order = %v, want FIFO %v", order, want)
 	}
+	if job, _ := m.GetJob(second.ID); job.Status != BlastJobFailed || job.Error != "boom" {
+		t.Errorf("failed job = %+v", job)
+	}
+	if job, _ := m.GetJob(first.ID); job.Result != "report "+first.ID {
+		t.Errorf("completed job result = %q", job.Result)
+	}
+}
 
-	// Check that the first numJobsToAdd - maxJobs jobs are gone
-	for i := 0; i < numJobsToAdd-maxJobs; i++ {
-		jobID := jobIDs[i]
-		if _, ok := m.jobs[jobID]; ok {
-			t.Errorf("job %s should have been removed", jobID)
+// waitForStatus polls until the job reaches want or the deadline passes.
+func waitForStatus(t *testing.T, m *BlastManager, jobID string, want BlastJobStatus) *BlastJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.GetJob(jobID)
+		if err == nil && job.Status == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not reach %s; last %+v (%v)", jobID, want, job, err)
 		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBlastManager_Cancel(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+
+	started := make(chan string, 4)
+	killed := make(chan string, 4)
+	m.StartWorkers(1, 2, 0, func(ctx context.Context, job *BlastJob) (string, error) {
+		started <- job.ID
+		<-ctx.Done()
+		killed <- job.ID
+		return "", ctx.Err()
+	})
+	defer m.Stop()
+
+	running, _ := m.Submit("blastn", "genes", nil)
+	<-started
+	queued, _ := m.Submit("blastn", "genes", nil)
+
+	// A waiting job leaves the queue without ever reaching a worker.
+	if err := m.Cancel(queued.ID); err != nil {
+		t.Fatalf("cancel queued: %v", err)
+	}
+	if m.QueuePosition(queued.ID) != 0 {
+		t.Errorf("cancelled job still in queue at %d", m.QueuePosition(queued.ID))
+	}
+	if job, _ := m.GetJob(queued.ID); job.Status != BlastJobCancelled {
+		t.Errorf("queued job status = %s, want cancelled", job.Status)
+	}
+
+	// A running job has its context cancelled.
+	if err := m.Cancel(running.ID); err != nil {
+		t.Fatalf("cancel running: %v", err)
+	}
+	if id := <-killed; id != running.ID {
+		t.Errorf("killed job %s, want %s", id, running.ID)
+	}
+	if job, _ := m.GetJob(running.ID); job.Status != BlastJobCancelled {
+		t.Errorf("running job status = %s, want cancelled", job.Status)
+	}
+
+	if err := m.Cancel(running.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("cancel finished job: err = %v, want ErrJobFinished", err)
+	}
+	if err := m.Cancel("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("cancel missing job: err = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestBlastManager_Timeout(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+	m.StartWorkers(1, 1, 50*time.Millisecond, func(ctx context.Context, job *BlastJob) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	defer m.Stop()
+
+	job, _ := m.Submit("blastn", "genes", nil)
+	got := waitForStatus(t, m, job.ID, BlastJobTimedOut)
+	if !strings.Contains(got.Error, "time limit") {
+		t.Errorf("timed out job error = %q", got.Error)
+	}
+}
+
+func TestBlastManager_StopRequeuesRunning(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+	started := make(chan struct{}, 1)
+	m.StartWorkers(1, 1, 0, func(ctx context.Context, job *BlastJob) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	job, _ := m.Submit("blastn", "genes", map[string]string{"sequence": "ACGT"})
+	<-started
+	m.Stop()
+
+	if got, _ := m.GetJob(job.ID); got.Status != BlastJobQueued {
+		t.Errorf("job interrupted by shutdown has status %s, want queued", got.Status)
+	}
+	if _, err := m.Submit("blastn", "genes", nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("submit after stop: err = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestSQLiteJobStore_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blast_jobs.db")
+
+	store, err := NewSQLiteJobStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	m := NewBlastManager(store, DefaultJobRetention)
+	job, err := m.NewJob("blastn", "genes", nil)
+	if err != nil {
+		t.Fatalf("new job: %v", err)
+	}
+	_ = m.CompleteJob(job.ID, "persisted report")
+	store.Close()
+
+	// Reopening runs the migrations again, which must be a no-op.
+	store, err = NewSQLiteJobStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.Get(job.ID)
+	if err != nil {
+		t.Fatalf("get after reopen: %v", err)
+	}
+	if got.Result != "persisted report" || !got.CreatedAt.Equal(job.CreatedAt) {
+		t.Errorf("unexpected job after reopen: %+v", got)
+	}
+}
+
+func TestBlastManager_Changes(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+	job, err := m.NewJob("blastn", "genes", nil)
+	if err != nil {
+		t.Fatalf("new job: %v", err)
+	}
+
+	changes := m.Changes()
+	select {
+	case <-changes:
+		t.Fatalf("changes closed before any update")
+	default:
+	}
+	if err := m.SetRunning(job.ID); err != nil {
+		t.Fatalf("set running: %v", err)
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatalf("changes not closed after a status update")
+	}
+	if m.Changes() == changes {
+		t.Errorf("a new channel should replace the closed one")
+	}
+}
+
+func TestBlastManager_SubmitCached(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewBlastManager(store, DefaultJobRetention)
+
+			release := make(chan struct{})
+			var runCount atomic.Int32
+			m.StartWorkers(1, 5, 0, func(ctx context.Context, job *BlastJob) (string, error) {
+				runCount.Add(1)
+				<-release
+				return "report", nil
+			})
+			defer m.Stop()
+
+			// Two identical searches submitted together: the second waits, then
+			// finds the first one's result instead of running.
+			first, err := m.SubmitCached("blastn", "genes", "key-1", nil)
+			if err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+			second, _ := m.SubmitCached("blastn", "genes", "key-1", nil)
+			other, _ := m.SubmitCached("blastn", "genes", "key-2", nil)
+			close(release)
+			waitForStatus(t, m, first.ID, BlastJobCompleted)
+			got := waitForStatus(t, m, second.ID, BlastJobCompleted)
+			if got.Result != "report" || got.CachedFrom != first.ID {
+				t.Errorf("second job %+v should reuse %s", got, first.ID)
+			}
+			waitForStatus(t, m, other.ID, BlastJobCompleted)
+			if n := runCount.Load(); n != 2 {
+				t.Errorf("BLAST ran %d times, want 2", n)
+			}
+
+			// Later submissions are answered at once, without a queue slot.
+			third, err := m.SubmitCached("blastn", "genes", "key-1", nil)
+			if err != nil {
+				t.Fatalf("submit cached: %v", err)
+			}
+			if third.Status != BlastJobCompleted || third.Result != "report" || m.QueuePosition(third.ID) != 0 {
+				t.Errorf("cached submission %+v", third)
+			}
+			if got, _ := m.GetJob(third.ID); got.CachedFrom != first.ID || got.CacheKey != "key-1" {
+				t.Errorf("stored cached job %+v", got)
+			}
+			// The newest match is now a copy; copies of it still name the job
+			// that ran, which holds the archive.
+			fourth, _ := m.SubmitCached("blastn", "genes", "key-1", nil)
+			if fourth.CachedFrom != first.ID {
+				t.Errorf("fourth job reuses %s, want %s", fourth.CachedFrom, first.ID)
+			}
+
+			if _, err := store.FindCompleted("key-3"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("FindCompleted for unknown key: %v", err)
+			}
+		})
 	}
+}
+
+func TestBlastManager_ListJobs(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewBlastManager(store, DefaultJobRetention)
+			m.StartWorkers(0, 5, 0, nil) // Queue only
+
+			var mine []string
+			for i := 0; i < 3; i++ {
+				job, err := m.SubmitAs("alice", "blastp", "genes", "", nil)
+				if err != nil {
+					t.Fatalf("submit: %v", err)
+				}
+				mine = append(mine, job.ID)
+				time.Sleep(time.Millisecond) // Distinct creation times
+			}
+			if _, err := m.SubmitAs("bob", "blastn", "genes", "", nil); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+			if _, err := m.Submit("blastn", "genes", nil); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+
+			done, _ := store.Get(mine[2])
+			done.Status, done.Result = BlastJobCompleted, "a large report"
+			if err := store.Save(done); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			if got, err := m.JobStatus(done.ID); err != nil || got.Status != BlastJobCompleted || got.Result != "" || got.Owner != "alice" {
+				t.Errorf("JobStatus = %+v, %v; want the completed job without its result", got, err)
+			}
+			if _, err := m.JobStatus("nope"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("JobStatus of unknown job: %v, want ErrJobNotFound", err)
+			}
+
+			jobs, err := m.ListJobs("alice", 2)
+			if err != nil {
+				t.Fatalf("ListJobs: %v", err)
+			}
+			if len(jobs) > 0 && (jobs[0].Status != BlastJobCompleted || jobs[0].Result != "") {
+				t.Errorf("listed job = %s with result %q, want completed without its result", jobs[0].Status, jobs[0].Result)
+			}
+			if len(jobs) != 2 || jobs[0].ID != mine[2] || jobs[1].ID != mine[1] {
+				t.Errorf("alice's jobs = %v, want the newest two of %v", jobIDs(jobs), mine)
+			}
+			for _, job := range jobs {
+				if job.Owner != "alice" {
+					t.Errorf("job %s owned by %q listed for alice", job.ID, job.Owner)
+				}
+			}
+
+			if jobs, _ := m.ListJobs("alice", 0); len(jobs) != 3 {
+				t.Errorf("unlimited list has %d jobs, want 3", len(jobs))
+			}
+			if jobs, _ := m.ListJobs("", 0); len(jobs) != 0 {
+				t.Errorf("jobs without an owner were listed: %v", jobIDs(jobs))
+			}
+		})
+	}
+}
 
-	// Check that the last maxJobs jobs are still there
-	for i := numJobsToAdd - maxJobs; i < numJobsToAdd; i++ {
-		jobID := jobIDs[i]
-		if _, ok := m.jobs[jobID]; !ok {
-			t.Errorf("job %s should be present", jobID)
+func jobIDs(jobs []*BlastJob) []string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func TestBlastManager_OnFinished(t *testing.T) {
+	m := NewBlastManager(NewMemoryJobStore(), DefaultJobRetention)
+
+	finished := make(chan *BlastJob, 8)
+	m.OnFinished(func(job *BlastJob) { finished <- job })
+	m.StartWorkers(1, 5, 0, func(ctx context.Context, job *BlastJob) (string, error) {
+		if job.BlastType == "tblastx" {
+			return "", errors.New("boom")
 		}
+		return "report", nil
+	})
+	defer m.Stop()
+
+	next := func() *BlastJob {
+		t.Helper()
+		select {
+		case job := <-finished:
+			return job
+		case <-time.After(5 * time.Second):
+			t.Fatal("no finished job reported")
+			return nil
+		}
+	}
+
+	done, _ := m.SubmitCached("blastn", "genes", "key-1", nil)
+	if job := next(); job.ID != done.ID || job.Status != BlastJobCompleted || job.Result != "report" {
+		t.Errorf("completed job reported as %+v", job)
+	}
+	failed, _ := m.Submit("tblastx", "genes", nil)
+	if job := next(); job.ID != failed.ID || job.Status != BlastJobFailed {
+		t.Errorf("failed job reported as %+v", job)
+	}
+	// Answered from the cache without running.
+	cached, _ := m.SubmitCached("blastn", "genes", "key-1", nil)
+	if job := next(); job.ID != cached.ID || job.CachedFrom != done.ID {
+		t.Errorf("cached job reported as %+v", job)
+	}
+
+	// Only the change to a final state is reported.
+	if err := m.CompleteJob(done.ID, "again"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-finished:
+		t.Errorf("finished job reported again: %+v", job)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBlastManager_Archive(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewBlastManager(store, time.Hour)
+			old := time.Now().Add(-2 * time.Hour)
+			for _, job := range []*BlastJob{
+				{ID: "old", Status: BlastJobCompleted, CreatedAt: old, UpdatedAt: old},
+				{ID: "done", Status: BlastJobCompleted, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+				{ID: "reused", Status: BlastJobCompleted, CachedFrom: "done", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+				{ID: "other", Status: BlastJobCompleted, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+				{ID: "old-reused", Status: BlastJobCompleted, CreatedAt: old, UpdatedAt: old},
+				{ID: "new-copy", Status: BlastJobCompleted, CachedFrom: "old-reused", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			} {
+				if err := store.Create(job); err != nil {
+					t.Fatalf("create %s: %v", job.ID, err)
+				}
+			}
+			for _, id := range []string{"old", "done", "old-reused"} {
+				if err := m.SaveArchive(id, []byte("Blast4-archive ::= "+id)); err != nil {
+					t.Fatalf("save archive: %v", err)
+				}
+			}
+			if err := m.SaveArchive("missing", []byte("x")); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("archive for an unknown job: %v", err)
+			}
+
+			for id, want := range map[string]string{"done": "done", "reused": "done"} {
+				job, _ := m.GetJob(id)
+				archive, err := m.Archive(job)
+				if err != nil || string(archive) != "Blast4-archive ::= "+want {
+					t.Errorf("archive of %s = %q, %v", id, archive, err)
+				}
+				if ok, err := m.HasArchive(job); !ok || err != nil {
+					t.Errorf("HasArchive(%s) = %v, %v", id, ok, err)
+				}
+			}
+			other, _ := m.GetJob("other")
+			if _, err := m.Archive(other); !errors.Is(err, ErrNoArchive) {
+				t.Errorf("job without archive: %v", err)
+			}
+			if ok, _ := m.HasArchive(other); ok {
+				t.Error("HasArchive true for a job without archive")
+			}
+
+			if _, err := m.PruneExpired(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Archive("old"); !errors.Is(err, ErrNoArchive) {
+				t.Errorf("archive of a pruned job: %v", err)
+			}
+			// An expired job is kept while a newer copy shares its archive.
+			copied, _ := m.GetJob("new-copy")
+			if archive, err := m.Archive(copied); err != nil || string(archive) != "Blast4-archive ::= old-reused" {
+				t.Errorf("archive of a copy of an expired job = %q, %v", archive, err)
+			}
+		})
 	}
 }
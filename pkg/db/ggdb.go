@@ -4,10 +4,10 @@ import "database/sql"
 
 type GeneClusterDB struct {
 	SQL   *sql.DB
-	SeqDB *SequenceDB
+	SeqDB SequenceStore
 }
 
-func NewGeneClusterDB(db *sql.DB, seqdb *SequenceDB) *GeneClusterDB {
+func NewGeneClusterDB(db *sql.DB, seqdb SequenceStore) *GeneClusterDB {
 	// Check for db schema and version here later
 	return &GeneClusterDB{
 		SQL:   db,
@@ -1,16 +1,24 @@
 package db
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Defining possible error
 var SequenceNotExists = errors.New("Sequence folder does not exists")
 
+// ErrBlastdbcmdBusy is returned when a fetch waits longer than
+// SequenceDB.MaxWait for a blastdbcmd process slot.
+var ErrBlastdbcmdBusy = errors.New("all blastdbcmd processes are busy")
+
 type NoSequenceError struct {
 	Msg string // additional context for the error
 }
@@ -19,11 +27,110 @@ func (e *NoSequenceError) Error() string {
 	return fmt.Sprintf("Sequence error: %s", e.Msg)
 }
 
-// folder which host sequeces/[genomes]/fasta
+// entryNotFound reports whether blastdbcmd failed because the entry is not in the
+// database, as opposed to the database itself being missing or unreadable.
+func entryNotFound(output []byte) bool {
+	msg := strings.ToLower(string(output))
+	return strings.Contains(msg, "not found") && !strings.Contains(msg, "database error")
+}
+
+// SequenceStore fetches gene and genome sequences as FASTA. Gene entries are
+// named "genomeID//contigID//geneID" and contigs "genomeID//contigID"; region
+// entries add ":start-end" (1-based, inclusive). Entries that do not exist are
+// reported as *NoSequenceError, except by the batch methods, which leave them
+// out of the FASTA; MatchFastaRecords finds which of a batch came back.
+type SequenceStore interface {
+	GetGeneSequence(genomeID, contigID, geneID string, isProt bool) ([]byte, error)
+	GetRegionSequence(genomeID, contigID string, start, end uint64) ([]byte, error)
+	GetMultipleGene(geneNames []string, isProt bool) ([]byte, error)
+	GetMultipleRegion(regionNames []string) ([]byte, error)
+}
+
+// SequenceDB is the SequenceStore that runs blastdbcmd on the BLAST databases.
 type SequenceDB struct {
 	ProtDB   string
 	NuclDB   string
 	GenomeDB string
+
+	// MaxProcs limits the blastdbcmd processes run at once; further fetches
+	// wait for one to finish. 0 for no limit. It must not change once the
+	// SequenceDB is in use.
+	MaxProcs int
+	// MaxWait is how long a fetch waits for a process before failing with
+	// ErrBlastdbcmdBusy; 0 waits until one is free.
+	MaxWait time.Duration
+
+	procsOnce sync.Once
+	procs     chan struct{}
+	running   atomic.Int64
+	waiting   atomic.Int64
+	started   atomic.Int64
+}
+
+// BlastdbcmdStats describes the blastdbcmd processes of a SequenceDB.
+type BlastdbcmdStats struct {
+	Running  int64 `json:"running"`
+	Waiting  int64 `json:"waiting"` // Fetches waiting for a free process slot
+	Started  int64 `json:"started"` // Processes started so far
+	MaxProcs int   `json:"max_procs"`
+}
+
+// Stats returns the current process counts.
+func (seqdb *SequenceDB) Stats() BlastdbcmdStats {
+	return BlastdbcmdStats{
+		Running:  seqdb.running.Load(),
+		Waiting:  seqdb.waiting.Load(),
+		Started:  seqdb.started.Load(),
+		MaxProcs: seqdb.MaxProcs,
+	}
+}
+
+// blastdbcmd runs blastdbcmd with args and stdin, once a process slot is free,
+// and returns its standard output and error.
+func (seqdb *SequenceDB) blastdbcmd(stdin string, args ...string) (stdout, stderr []byte, err error) {
+	seqdb.procsOnce.Do(func() {
+		if seqdb.MaxProcs > 0 {
+			seqdb.procs = make(chan struct{}, seqdb.MaxProcs)
+		}
+	})
+	if seqdb.procs != nil {
+		seqdb.waiting.Add(1)
+		ok := seqdb.acquire()
+		seqdb.waiting.Add(-1)
+		if !ok {
+			return nil, nil, ErrBlastdbcmdBusy
+		}
+		defer func() { <-seqdb.procs }()
+	}
+	seqdb.running.Add(1)
+	defer seqdb.running.Add(-1)
+	seqdb.started.Add(1)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command("blastdbcmd", args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err = cmd.Run()
+	return outBuf.Bytes(), errBuf.Bytes(), err
+}
+
+// acquire takes a process slot, waiting at most MaxWait for one, and reports
+// whether it got one.
+func (seqdb *SequenceDB) acquire() bool {
+	if seqdb.MaxWait <= 0 {
+		seqdb.procs <- struct{}{}
+		return true
+	}
+	timer := time.NewTimer(seqdb.MaxWait)
+	defer timer.Stop()
+	select {
+	case seqdb.procs <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 func NewSequenceDB(protDB, nuclDB, genomeDB string) (*SequenceDB, error) {
@@ -62,12 +169,12 @@ func (seqdb *SequenceDB) GetGeneSequence(genomeID, contigID, geneID string, isPr
 	seq_name := fmt.Sprintf("%s//%s//%s", genomeID, contigID, geneID)
 
 	// blastdbcmd -db genetable_genes_prot -entry "CBS57985//contig004129//CBS57985_11370"
-	args := []string{"-db", dbPath, "-entry", seq_name}
-	cmd := exec.Command("blastdbcmd", args...)
-
-	output, err := cmd.CombinedOutput()
+	output, stderr, err := seqdb.blastdbcmd("", "-db", dbPath, "-entry", seq_name)
 
 	if err != nil {
+		if entryNotFound(stderr) {
+			return nil, &NoSequenceError{Msg: seq_name + " not found"}
+		}
 		return nil, fmt.Errorf("%w: Sequence not found (blastdbcmd error)", err)
 	}
 
@@ -81,12 +188,12 @@ func (seqdb *SequenceDB) GetRegionSequence(genomeID, contigID string, start, end
 	seq_name := fmt.Sprintf("%s//%s", genomeID, contigID)
 
 	// blastdbcmd -db genetable_genomes_nucl -entry "genomeID//contigID" -range 100-200
-	args := []string{"-db", dbPath, "-entry", seq_name, "-range", fmt.Sprintf("%d-%d", start, end)}
-	cmd := exec.Command("blastdbcmd", args...)
-
-	output, err := cmd.CombinedOutput()
+	output, stderr, err := seqdb.blastdbcmd("", "-db", dbPath, "-entry", seq_name, "-range", fmt.Sprintf("%d-%d", start, end))
 
 	if err != nil {
+		if entryNotFound(stderr) {
+			return nil, &NoSequenceError{Msg: seq_name + " not found"}
+		}
 		return nil, fmt.Errorf("%w: Sequence not found (blastdbcmd error)", err)
 	}
 
@@ -109,12 +216,12 @@ func (seqdb *SequenceDB) GetMultipleGene(geneNames []string, isProt bool) ([]byt
 	}
 
 	// Use -entry_batch - for better scalability and to avoid command line length limits
-	cmd := exec.Command("blastdbcmd", "-db", dbPath, "-entry_batch", "-")
-	cmd.Stdin = strings.NewReader(strings.Join(geneNames, "\n") + "\n")
-	output, err := cmd.CombinedOutput()
+	output, stderr, err := seqdb.blastdbcmd(strings.Join(geneNames, "\n")+"\n", "-db", dbPath, "-entry_batch", "-")
 
-	if err != nil {
-		nerr := fmt.Errorf("blastdbcmd error: %w, output: %s", err, string(output))
+	// blastdbcmd goes on past missing entries and fails at the end; the rest
+	// of its output is still good.
+	if err != nil && !entryNotFound(stderr) {
+		nerr := fmt.Errorf("blastdbcmd error: %w, output: %s", err, string(stderr))
 		return nil, nerr
 	}
 
@@ -145,14 +252,88 @@ func (seqdb *SequenceDB) GetMultipleRegion(regionNames []string) ([]byte, error)
 		}
 	}
 
-	cmd := exec.Command("blastdbcmd", "-db", seqdb.GenomeDB, "-entry_batch", "-")
-	cmd.Stdin = strings.NewReader(batchData.String())
-	output, err := cmd.CombinedOutput()
+	output, stderr, err := seqdb.blastdbcmd(batchData.String(), "-db", seqdb.GenomeDB, "-entry_batch", "-")
 
-	if err != nil {
-		nerr := fmt.Errorf("blastdbcmd error: %w, output: %s", err, string(output))
+	if err != nil && !entryNotFound(stderr) {
+		nerr := fmt.Errorf("blastdbcmd error: %w, output: %s", err, string(stderr))
 		return nil, nerr
 	}
 
 	return output, nil
 }
+
+// MatchFastaRecords splits the FASTA of a batch fetch into the record of each
+// name, in the order of names, by the entry name in the record headers. Names
+// whose entry was not found get nil. Ranges are matched by their start, as the
+// stores cut the end of a range at the end of the sequence, or by the contig
+// alone if the header has no range.
+func MatchFastaRecords(names []string, fasta []byte) [][]byte {
+	byKey := make(map[string][]int, len(names))
+	byContig := make(map[string][]int)
+	for i, name := range names {
+		key := fastaRecordKey(name)
+		byKey[key] = append(byKey[key], i)
+		if contig, _, ok := strings.Cut(name, ":"); ok {
+			byContig[contig] = append(byContig[contig], i)
+		}
+	}
+
+	records := make([][]byte, len(names))
+	// next takes the first name of at without a record yet; names asked for
+	// twice come back twice, in turn.
+	next := func(at []int) ([]int, int) {
+		for len(at) > 0 && records[at[0]] != nil {
+			at = at[1:]
+		}
+		if len(at) == 0 {
+			return at, -1
+		}
+		return at[1:], at[0]
+	}
+	for _, record := range splitFastaRecords(fasta) {
+		header, _, _ := bytes.Cut(record[1:], []byte("\n"))
+		id, _, _ := strings.Cut(strings.TrimSpace(string(header)), " ")
+		key := fastaRecordKey(id)
+		var i int
+		if byKey[key], i = next(byKey[key]); i < 0 {
+			byContig[id], i = next(byContig[id])
+		}
+		if i >= 0 {
+			records[i] = record
+		}
+	}
+	return records
+}
+
+// fastaRecordKey drops the end of the range of an entry name.
+func fastaRecordKey(name string) string {
+	colon := strings.LastIndexByte(name, ':')
+	if dash := strings.LastIndexByte(name, '-'); colon >= 0 && dash > colon {
+		return name[:dash]
+	}
+	return name
+}
+
+// splitFastaRecords splits FASTA into its records, each from its ">" header
+// up to the next one.
+func splitFastaRecords(fasta []byte) [][]byte {
+	var records [][]byte
+	start := -1
+	for i := 0; i < len(fasta); {
+		if fasta[i] == '>' && (i == 0 || fasta[i-1] == '\n') {
+			if start >= 0 {
+				records = append(records, fasta[start:i])
+			}
+			start = i
+		}
+		next := bytes.IndexByte(fasta[i:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	if start >= 0 {
+		records = append(records, fasta[start:])
+	}
+	return records
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// CachedSequenceStore keeps recently fetched sequences of another
+// SequenceStore in memory, least recently used first out once they take more
+// than the size limit. Sequences are cached per entry, so a gene fetched on its
+// own is also served from the cache in a batch and the other way round.
+// Failed fetches are not cached. The sequences are not checked against the
+// databases again, so the cache only suits databases that do not change while
+// the server runs.
+type CachedSequenceStore struct {
+	store    SequenceStore
+	maxBytes int64
+
+	mu    sync.Mutex
+	lru   *list.List // Of *sequenceCacheEntry, most recently used first
+	items map[string]*list.Element
+	size  int64
+
+	hits, misses, evictions atomic.Int64
+}
+
+type sequenceCacheEntry struct {
+	key   string
+	fasta []byte
+}
+
+// SequenceCacheStats counts the lookups of a CachedSequenceStore.
+type SequenceCacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// NewCachedSequenceStore caches up to maxBytes of FASTA from store.
+func NewCachedSequenceStore(store SequenceStore, maxBytes int64) *CachedSequenceStore {
+	return &CachedSequenceStore{
+		store:    store,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Stats returns the lookup counts so far and the current size of the cache.
+func (c *CachedSequenceStore) Stats() SequenceCacheStats {
+	c.mu.Lock()
+	entries, size := len(c.items), c.size
+	c.mu.Unlock()
+	return SequenceCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     size,
+		MaxBytes:  c.maxBytes,
+	}
+}
+
+func geneCacheKey(name string, isProt bool) string {
+	if isProt {
+		return "prot:" + name
+	}
+	return "nucl:" + name
+}
+
+func regionCacheKey(name string) string {
+	return "genome:" + name
+}
+
+func (c *CachedSequenceStore) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*sequenceCacheEntry).fasta, true
+}
+
+// put caches fasta under key. Entries over an eighth of the cache, such as
+// whole contigs, are not kept so that one fetch cannot empty the cache.
+func (c *CachedSequenceStore) put(key string, fasta []byte) {
+	size := int64(len(fasta))
+	if size > c.maxBytes/8 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&sequenceCacheEntry{key: key, fasta: bytes.Clone(fasta)})
+	c.size += size
+	for c.size > c.maxBytes {
+		oldest := c.lru.Remove(c.lru.Back()).(*sequenceCacheEntry)
+		delete(c.items, oldest.key)
+		c.size -= int64(len(oldest.fasta))
+		c.evictions.Add(1)
+	}
+}
+
+// fetch returns the cached FASTA for key, or fetches and caches it.
+func (c *CachedSequenceStore) fetch(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	if fasta, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return bytes.Clone(fasta), nil
+	}
+	c.misses.Add(1)
+	fasta, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, fasta)
+	return fasta, nil
+}
+
+func (c *CachedSequenceStore) GetGeneSequence(genomeID, contigID, geneID string, isProt bool) ([]byte, error) {
+	name := genomeID + "//" + contigID + "//" + geneID
+	return c.fetch(geneCacheKey(name, isProt), func() ([]byte, error) {
+		return c.store.GetGeneSequence(genomeID, contigID, geneID, isProt)
+	})
+}
+
+func (c *CachedSequenceStore) GetRegionSequence(genomeID, contigID string, start, end uint64) ([]byte, error) {
+	name := fmt.Sprintf("%s//%s:%d-%d", genomeID, contigID, start, end)
+	return c.fetch(regionCacheKey(name), func() ([]byte, error) {
+		return c.store.GetRegionSequence(genomeID, contigID, start, end)
+	})
+}
+
+func (c *CachedSequenceStore) GetMultipleGene(geneNames []string, isProt bool) ([]byte, error) {
+	return c.fetchBatch(geneNames, func(name string) string { return geneCacheKey(name, isProt) },
+		func(names []string) ([]byte, error) { return c.store.GetMultipleGene(names, isProt) })
+}
+
+func (c *CachedSequenceStore) GetMultipleRegion(regionNames []string) ([]byte, error) {
+	return c.fetchBatch(regionNames, regionCacheKey, c.store.GetMultipleRegion)
+}
+
+// fetchBatch answers a batch from the cache where it can and fetches the rest
+// in one batch. The fetched records are matched to their names and cached;
+// entries the store did not return are left out, as the store would.
+func (c *CachedSequenceStore) fetchBatch(names []string, key func(string) string, fetch func([]string) ([]byte, error)) ([]byte, error) {
+	records := make([][]byte, len(names))
+	var missing []string
+	var missingAt []int
+	for i, name := range names {
+		if fasta, ok := c.get(key(name)); ok {
+			records[i] = fasta
+			continue
+		}
+		missing = append(missing, name)
+		missingAt = append(missingAt, i)
+	}
+	c.hits.Add(int64(len(names) - len(missing)))
+	c.misses.Add(int64(len(missing)))
+
+	if len(missing) > 0 {
+		out, err := fetch(missing)
+		if err != nil {
+			return nil, err
+		}
+		for j, fasta := range MatchFastaRecords(missing, out) {
+			if fasta == nil {
+				continue
+			}
+			records[missingAt[j]] = fasta
+			c.put(key(missing[j]), fasta)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, fasta := range records {
+		buf.Write(fasta)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingStore serves ">name\nSEQ\n" for every name except those in
+// missing, counting the names it is asked for.
+type countingStore struct {
+	mu      sync.Mutex
+	fetched []string
+	missing map[string]bool
+}
+
+func (s *countingStore) record(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched = append(s.fetched, name)
+	if s.missing[name] {
+		return nil, &NoSequenceError{Msg: name + " not found"}
+	}
+	return []byte(">" + name + "\nACGTACGT\n"), nil
+}
+
+func (s *countingStore) batch(names []string) ([]byte, error) {
+	var out []byte
+	for _, name := range names {
+		// Like blastdbcmd, leave out what is missing.
+		if rec, err := s.record(name); err == nil {
+			out = append(out, rec...)
+		}
+	}
+	return out, nil
+}
+
+func (s *countingStore) GetGeneSequence(genomeID, contigID, geneID string, isProt bool) ([]byte, error) {
+	return s.record(genomeID + "//" + contigID + "//" + geneID)
+}
+
+func (s *countingStore) GetRegionSequence(genomeID, contigID string, start, end uint64) ([]byte, error) {
+	return s.record(fmt.Sprintf("%s//%s:%d-%d", genomeID, contigID, start, end))
+}
+
+func (s *countingStore) GetMultipleGene(geneNames []string, isProt bool) ([]byte, error) {
+	return s.batch(geneNames)
+}
+
+func (s *countingStore) GetMultipleRegion(regionNames []string) ([]byte, error) {
+	return s.batch(regionNames)
+}
+
+func TestCachedSequenceStore(t *testing.T) {
+	store := &countingStore{missing: map[string]bool{"G//c//gone": true}}
+	cache := NewCachedSequenceStore(store, 1<<20)
+
+	for range 3 {
+		got, err := cache.GetGeneSequence("G", "c", "g1", true)
+		if err != nil || string(got) != ">G//c//g1\nACGTACGT\n" {
+			t.Fatalf("gene = %q, %v", got, err)
+		}
+	}
+	if _, err := cache.GetGeneSequence("G", "c", "gone", true); err == nil {
+		t.Fatal("missing gene should fail")
+	}
+	if _, err := cache.GetGeneSequence("G", "c", "gone", true); err == nil {
+		t.Fatal("missing gene should fail again")
+	}
+	// The nucleotide sequence is another entry.
+	cache.GetGeneSequence("G", "c", "g1", false)
+
+	// A batch reuses g1 and fetches only g2, in order.
+	got, err := cache.GetMultipleGene([]string{"G//c//g2", "G//c//g1"}, true)
+	if err != nil || string(got) != ">G//c//g2\nACGTACGT\n>G//c//g1\nACGTACGT\n" {
+		t.Fatalf("batch = %q, %v", got, err)
+	}
+	cache.GetGeneSequence("G", "c", "g2", true)
+
+	// Regions are cached by range.
+	cache.GetRegionSequence("G", "c", 1, 10)
+	cache.GetMultipleRegion([]string{"G//c:1-10", "G//c:5-10"})
+
+	want := []string{"G//c//g1", "G//c//gone", "G//c//gone", "G//c//g1", "G//c//g2", "G//c:1-10", "G//c:5-10"}
+	if strings.Join(store.fetched, " ") != strings.Join(want, " ") {
+		t.Errorf("fetched %v, want %v", store.fetched, want)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 5 || stats.Misses != 7 || stats.Entries != 5 {
+		t.Errorf("stats = %+v, want 5 hits, 7 misses, 5 entries", stats)
+	}
+
+	// With an entry missing, the batch is fetched once, leaves it out and
+	// caches the others.
+	store.fetched = nil
+	got, err = cache.GetMultipleGene([]string{"G//c//g1", "G//c//gone", "G//c//g3"}, true)
+	if err != nil || string(got) != ">G//c//g1\nACGTACGT\n>G//c//g3\nACGTACGT\n" {
+		t.Errorf("batch with a missing gene = %q, %v", got, err)
+	}
+	cache.GetGeneSequence("G", "c", "g3", true)
+	if strings.Join(store.fetched, " ") != "G//c//gone G//c//g3" {
+		t.Errorf("fetched %v, want one batch of the uncached genes", store.fetched)
+	}
+}
+
+func TestCachedSequenceStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	store := &countingStore{}
+	// Records are 19 bytes, so eight fit.
+	cache := NewCachedSequenceStore(store, 160)
+
+	for i := 1; i <= 8; i++ {
+		cache.GetGeneSequence("G", "c", fmt.Sprint("g", i), true)
+	}
+	cache.GetGeneSequence("G", "c", "g1", true) // g2 is now the oldest
+	cache.GetGeneSequence("G", "c", "g9", true)
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 8 || stats.Bytes != 8*19 {
+		t.Fatalf("stats = %+v, want one eviction and eight entries", stats)
+	}
+
+	store.fetched = nil
+	cache.GetGeneSequence("G", "c", "g1", true)
+	cache.GetGeneSequence("G", "c", "g9", true)
+	cache.GetGeneSequence("G", "c", "g2", true)
+	if strings.Join(store.fetched, " ") != "G//c//g2" {
+		t.Errorf("fetched %v, want only the evicted g2", store.fetched)
+	}
+
+	// Entries over an eighth of the cache are passed through.
+	store.fetched = nil
+	cache.GetRegionSequence("G", "contig-with-a-long-name", 1, 100000)
+	cache.GetRegionSequence("G", "contig-with-a-long-name", 1, 100000)
+	if len(store.fetched) != 2 {
+		t.Errorf("fetched %v, want the large entry twice", store.fetched)
+	}
+}
+
+func TestSequenceDB_LimitsProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake blastdbcmd is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nsleep 0.3\necho '>x'\necho ACGT\n"
+	if err := os.WriteFile(filepath.Join(dir, "blastdbcmd"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	seqdb := &SequenceDB{ProtDB: "prot", MaxProcs: 2}
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := seqdb.GetGeneSequence("G", "c", fmt.Sprint(i), true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(150 * time.Millisecond)
+	if stats := seqdb.Stats(); stats.Running != 2 || stats.Waiting != 3 {
+		t.Errorf("stats = %+v, want 2 running and 3 waiting", stats)
+	}
+	wg.Wait()
+	if stats := seqdb.Stats(); stats.Running != 0 || stats.Waiting != 0 || stats.Started != 5 {
+		t.Errorf("stats after = %+v", stats)
+	}
+}
+
+func TestSequenceDB_BusyAfterMaxWait(t *testing.T) {
+	seqdb := &SequenceDB{ProtDB: "prot", MaxProcs: 1, MaxWait: 10 * time.Millisecond}
+	seqdb.procsOnce.Do(func() { seqdb.procs = make(chan struct{}, 1) })
+	seqdb.procs <- struct{}{} // Held by a running blastdbcmd
+
+	if _, err := seqdb.GetGeneSequence("G", "c", "g1", true); !errors.Is(err, ErrBlastdbcmdBusy) {
+		t.Errorf("gene error = %v, want ErrBlastdbcmdBusy", err)
+	}
+	if _, err := seqdb.GetMultipleGene([]string{"G//c//g1"}, true); !errors.Is(err, ErrBlastdbcmdBusy) {
+		t.Errorf("batch error = %v, want ErrBlastdbcmdBusy", err)
+	}
+	if stats := seqdb.Stats(); stats.Waiting != 0 || stats.Started != 0 {
+		t.Errorf("stats = %+v, want nothing waiting or started", stats)
+	}
+}
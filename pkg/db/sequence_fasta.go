@@ -0,0 +1,369 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fastaLineWidth is the line length of the FASTA written, as blastdbcmd does.
+const fastaLineWidth = 80
+
+// FastaSequenceDB is a SequenceStore over FASTA files indexed with samtools
+// faidx, so sequences are read directly instead of through blastdbcmd and
+// BLAST+ is not needed to browse. The files may be plain or compressed with
+// bgzip; the FASTA IDs are the names the BLAST databases were built with.
+type FastaSequenceDB struct {
+	prot   *IndexedFasta
+	nucl   *IndexedFasta
+	genome *IndexedFasta
+}
+
+// NewFastaSequenceDB opens the gene protein, gene nucleotide and genome FASTA
+// files with their indexes.
+func NewFastaSequenceDB(protFasta, nuclFasta, genomeFasta string) (*FastaSequenceDB, error) {
+	var s FastaSequenceDB
+	for _, f := range []struct {
+		path string
+		dst  **IndexedFasta
+	}{{protFasta, &s.prot}, {nuclFasta, &s.nucl}, {genomeFasta, &s.genome}} {
+		fa, err := OpenIndexedFasta(f.path)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		*f.dst = fa
+	}
+	return &s, nil
+}
+
+// Close closes the FASTA files.
+func (s *FastaSequenceDB) Close() error {
+	var errs []error
+	for _, fa := range []*IndexedFasta{s.prot, s.nucl, s.genome} {
+		if fa != nil {
+			errs = append(errs, fa.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FastaSequenceDB) genes(isProt bool) *IndexedFasta {
+	if isProt {
+		return s.prot
+	}
+	return s.nucl
+}
+
+func (s *FastaSequenceDB) GetGeneSequence(genomeID, contigID, geneID string, isProt bool) ([]byte, error) {
+	var buf bytes.Buffer
+	name := fmt.Sprintf("%s//%s//%s", genomeID, contigID, geneID)
+	if err := s.genes(isProt).writeRecord(&buf, name, 0, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *FastaSequenceDB) GetRegionSequence(genomeID, contigID string, start, end uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	name := fmt.Sprintf("%s//%s", genomeID, contigID)
+	if err := s.genome.writeRecord(&buf, name, int64(start), int64(end)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetMultipleGene returns the genes in order, leaving out those not found.
+func (s *FastaSequenceDB) GetMultipleGene(geneNames []string, isProt bool) ([]byte, error) {
+	var buf bytes.Buffer
+	fa := s.genes(isProt)
+	for _, name := range geneNames {
+		if err := fa.writeRecord(&buf, name, 0, 0); err != nil && !isNoSequence(err) {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// GetMultipleRegion returns the regions, named "genomeID//contigID" or
+// "genomeID//contigID:start-end", in order, leaving out those not found.
+func (s *FastaSequenceDB) GetMultipleRegion(regionNames []string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, region := range regionNames {
+		name, start, end, err := parseRegionName(region)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.genome.writeRecord(&buf, name, start, end); err != nil && !isNoSequence(err) {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func isNoSequence(err error) bool {
+	var noSeq *NoSequenceError
+	return errors.As(err, &noSeq)
+}
+
+func parseRegionName(region string) (name string, start, end int64, err error) {
+	name, rng, ok := strings.Cut(region, ":")
+	if !ok {
+		return region, 0, 0, nil
+	}
+	from, to, ok := strings.Cut(rng, "-")
+	if ok {
+		start, err = strconv.ParseInt(from, 10, 64)
+		if err == nil {
+			end, err = strconv.ParseInt(to, 10, 64)
+		}
+	}
+	if !ok || err != nil {
+		return "", 0, 0, fmt.Errorf("invalid region %q", region)
+	}
+	return name, start, end, nil
+}
+
+// faiEntry is a line of a samtools .fai index.
+type faiEntry struct {
+	length    int64 // Residues in the sequence
+	offset    int64 // Of the first residue in the (uncompressed) file
+	lineBases int64 // Residues per line
+	lineWidth int64 // Bytes per line, with the line ending
+}
+
+// bgzfBlock is the start of a BGZF block in the compressed and the
+// uncompressed file.
+type bgzfBlock struct {
+	compressed   int64
+	uncompressed int64
+}
+
+// IndexedFasta reads sequences from a FASTA file by its .fai index. It is
+// safe for concurrent use.
+type IndexedFasta struct {
+	path   string
+	file   *os.File
+	size   int64
+	index  map[string]faiEntry
+	blocks []bgzfBlock // BGZF blocks of a bgzip file, in order; nil for plain files
+}
+
+// OpenIndexedFasta opens path with the index in path.fai. A bgzip file also
+// uses the block index in path.gzi that samtools faidx writes next to it; the
+// blocks are read from the file if there is none.
+func OpenIndexedFasta(path string) (*IndexedFasta, error) {
+	index, err := readFai(path + ".fai")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fa := &IndexedFasta{path: path, file: file, index: index}
+	if fa.size, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	compressed, err := isBGZF(file)
+	if err == nil && compressed {
+		fa.blocks, err = readGzi(path + ".gzi")
+		if errors.Is(err, os.ErrNotExist) {
+			fa.blocks, err = scanBGZF(file, fa.size)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fa, nil
+}
+
+// Close closes the file.
+func (fa *IndexedFasta) Close() error {
+	return fa.file.Close()
+}
+
+func readFai(path string) (map[string]faiEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("FASTA index: %w (create it with samtools faidx)", err)
+	}
+	defer f.Close()
+
+	index := make(map[string]faiEntry)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("%s:%d: expected 5 columns", path, line)
+		}
+		var e faiEntry
+		var nums [4]int64
+		for i := range nums {
+			if nums[i], err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		e.length, e.offset, e.lineBases, e.lineWidth = nums[0], nums[1], nums[2], nums[3]
+		if e.lineBases <= 0 && e.length > 0 {
+			return nil, fmt.Errorf("%s:%d: no residues per line", path, line)
+		}
+		index[fields[0]] = e
+	}
+	return index, sc.Err()
+}
+
+// isBGZF reports whether f is compressed with bgzip. Plain gzip cannot be read
+// at random and is rejected.
+func isBGZF(f *os.File) (bool, error) {
+	var header [16]byte
+	n, err := f.ReadAt(header[:], 0)
+	if n < 2 || header[0] != 0x1f || header[1] != 0x8b {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	// FEXTRA with a "BC" subfield first, as bgzip writes it.
+	if n < len(header) || header[3]&4 == 0 || header[12] != 'B' || header[13] != 'C' {
+		return false, errors.New("gzip file is not bgzip-compressed; recompress it with bgzip")
+	}
+	return true, nil
+}
+
+func readGzi(path string) ([]bgzfBlock, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 8 {
+		return nil, fmt.Errorf("%s: truncated", path)
+	}
+	n := binary.LittleEndian.Uint64(raw)
+	if uint64(len(raw)-8) != n*16 {
+		return nil, fmt.Errorf("%s: expected %d entries", path, n)
+	}
+	// The first block is implied.
+	blocks := []bgzfBlock{{0, 0}}
+	for i := range n {
+		entry := raw[8+16*i:]
+		blocks = append(blocks, bgzfBlock{
+			compressed:   int64(binary.LittleEndian.Uint64(entry)),
+			uncompressed: int64(binary.LittleEndian.Uint64(entry[8:])),
+		})
+	}
+	return blocks, nil
+}
+
+// scanBGZF lists the blocks of a bgzip file from their headers, which give
+// each block's size, and their trailers, which give its uncompressed size.
+func scanBGZF(f *os.File, size int64) ([]bgzfBlock, error) {
+	var blocks []bgzfBlock
+	var header [18]byte
+	var isize [4]byte
+	var c, u int64
+	for c < size {
+		if _, err := f.ReadAt(header[:], c); err != nil {
+			return nil, fmt.Errorf("BGZF block at %d: %w", c, err)
+		}
+		if header[12] != 'B' || header[13] != 'C' {
+			return nil, fmt.Errorf("BGZF block at %d has no size", c)
+		}
+		blockSize := int64(binary.LittleEndian.Uint16(header[16:])) + 1
+		if _, err := f.ReadAt(isize[:], c+blockSize-4); err != nil {
+			return nil, fmt.Errorf("BGZF block at %d: %w", c, err)
+		}
+		blocks = append(blocks, bgzfBlock{c, u})
+		c += blockSize
+		u += int64(binary.LittleEndian.Uint32(isize[:]))
+	}
+	return blocks, nil
+}
+
+// readAt reads n bytes at offset off of the uncompressed file.
+func (fa *IndexedFasta) readAt(off, n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if fa.blocks == nil {
+		if _, err := fa.file.ReadAt(buf, off); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	i := sort.Search(len(fa.blocks), func(i int) bool { return fa.blocks[i].uncompressed > off }) - 1
+	block := fa.blocks[max(i, 0)]
+	gz, err := gzip.NewReader(io.NewSectionReader(fa.file, block.compressed, fa.size-block.compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	if _, err := io.CopyN(io.Discard, gz, off-block.uncompressed); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(gz, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// position returns the offset of residue pos (0-based) of e in the file.
+func (e faiEntry) position(pos int64) int64 {
+	return e.offset + pos/e.lineBases*e.lineWidth + pos%e.lineBases
+}
+
+// writeRecord writes residues start to end (1-based, inclusive) of sequence
+// name to w as FASTA; start 0 writes the whole sequence. Like blastdbcmd, an
+// end beyond the sequence is cut to its length, and the header of a range
+// ends with ":start-end".
+func (fa *IndexedFasta) writeRecord(w *bytes.Buffer, name string, start, end int64) error {
+	e, ok := fa.index[name]
+	if !ok {
+		return &NoSequenceError{Msg: name + " not found"}
+	}
+
+	header := name
+	if start == 0 {
+		start, end = 1, e.length
+	} else {
+		end = min(end, e.length)
+		if start < 1 || start > end {
+			return &NoSequenceError{Msg: fmt.Sprintf("%s has no residues %d-%d", name, start, end)}
+		}
+		header = fmt.Sprintf("%s:%d-%d", name, start, end)
+	}
+
+	var seq []byte
+	if e.length > 0 {
+		from, to := e.position(start-1), e.position(end-1)+1
+		raw, err := fa.readAt(from, to-from)
+		if err != nil {
+			return fmt.Errorf("%s: reading %s: %w", fa.path, name, err)
+		}
+		seq = raw[:0]
+		for _, c := range raw {
+			if c != '\n' && c != '\r' {
+				seq = append(seq, c)
+			}
+		}
+	}
+
+	w.WriteString(">" + header + "\n")
+	for len(seq) > 0 {
+		n := min(len(seq), fastaLineWidth)
+		w.Write(seq[:n])
+		w.WriteByte('\n')
+		seq = seq[n:]
+	}
+	return nil
+}
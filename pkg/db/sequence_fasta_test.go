@@ -0,0 +1,151 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeIndexedFasta writes records as FASTA with lines of width residues and
+// the .fai index samtools faidx would write.
+func writeIndexedFasta(t *testing.T, path string, records [][2]string, width int) []byte {
+	t.Helper()
+	var fasta, fai bytes.Buffer
+	for _, r := range records {
+		fmt.Fprintf(&fasta, ">%s some description\n", r[0])
+		fmt.Fprintf(&fai, "%s\t%d\t%d\t%d\t%d\n", r[0], len(r[1]), fasta.Len(), width, width+1)
+		for seq := r[1]; len(seq) > 0; {
+			n := min(len(seq), width)
+			fasta.WriteString(seq[:n] + "\n")
+			seq = seq[n:]
+		}
+	}
+	if err := os.WriteFile(path, fasta.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".fai", fai.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fasta.Bytes()
+}
+
+// bgzip compresses data into BGZF blocks of blockSize bytes, ending with the
+// empty EOF block, and returns the offsets for a .gzi index.
+func bgzip(t *testing.T, data []byte, blockSize int) (out []byte, gzi []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	var entries [][2]uint64
+	for u := 0; ; u += blockSize {
+		if u > 0 && u < len(data) {
+			entries = append(entries, [2]uint64{uint64(buf.Len()), uint64(u)})
+		}
+		var block bytes.Buffer
+		zw := gzip.NewWriter(&block)
+		zw.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		zw.Write(data[min(u, len(data)):min(u+blockSize, len(data))])
+		zw.Close()
+		b := block.Bytes()
+		binary.LittleEndian.PutUint16(b[16:], uint16(len(b)-1))
+		buf.Write(b)
+		if u >= len(data) {
+			break
+		}
+	}
+	gzi = binary.LittleEndian.AppendUint64(nil, uint64(len(entries)))
+	for _, e := range entries {
+		gzi = binary.LittleEndian.AppendUint64(gzi, e[0])
+		gzi = binary.LittleEndian.AppendUint64(gzi, e[1])
+	}
+	return buf.Bytes(), gzi
+}
+
+func TestFastaSequenceDB(t *testing.T) {
+	dir := t.TempDir()
+	genes := [][2]string{{"G1//c1//g1", "MKVLAAGIVG"}, {"G1//c1//g2", "MSTNPKPQRK"}}
+	contig := strings.Repeat("ACGTTGCA", 30)
+	writeIndexedFasta(t, filepath.Join(dir, "prot.fa"), genes, 4)
+	writeIndexedFasta(t, filepath.Join(dir, "nucl.fa"), [][2]string{{"G1//c1//g1", "ATGAAAGTT"}}, 60)
+	plain := writeIndexedFasta(t, filepath.Join(dir, "genome.fa"), [][2]string{{"G1//c0", "A"}, {"G1//c1", contig}}, 7)
+
+	// The same genomes compressed with bgzip, with and without a .gzi index.
+	compressed, gzi := bgzip(t, plain, 50)
+	for _, name := range []string{"genome.fa.gz", "genome-nogzi.fa.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, compressed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fai, _ := os.ReadFile(filepath.Join(dir, "genome.fa.fai"))
+		if err := os.WriteFile(path+".fai", fai, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "genome.fa.gz.gzi"), gzi, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, genome := range []string{"genome.fa", "genome.fa.gz", "genome-nogzi.fa.gz"} {
+		t.Run(genome, func(t *testing.T) {
+			s, err := NewFastaSequenceDB(filepath.Join(dir, "prot.fa"), filepath.Join(dir, "nucl.fa"), filepath.Join(dir, genome))
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer s.Close()
+
+			got, err := s.GetGeneSequence("G1", "c1", "g2", true)
+			if err != nil || string(got) != ">G1//c1//g2\nMSTNPKPQRK\n" {
+				t.Errorf("gene = %q, %v", got, err)
+			}
+			got, err = s.GetRegionSequence("G1", "c1", 6, 20)
+			if want := ">G1//c1:6-20\n" + contig[5:20] + "\n"; err != nil || string(got) != want {
+				t.Errorf("region = %q, %v; want %q", got, err, want)
+			}
+			// The end is cut to the contig; records are wrapped at 80 residues.
+			got, err = s.GetRegionSequence("G1", "c1", 100, 1000)
+			if want := ">G1//c1:100-240\n" + contig[99:179] + "\n" + contig[179:] + "\n"; err != nil || string(got) != want {
+				t.Errorf("region to the end = %q, %v; want %q", got, err, want)
+			}
+			got, err = s.GetMultipleRegion([]string{"G1//c0", "G1//c1:1-3"})
+			if err != nil || string(got) != ">G1//c0\nA\n>G1//c1:1-3\nACG\n" {
+				t.Errorf("regions = %q, %v", got, err)
+			}
+
+			var noSeq *NoSequenceError
+			if _, err := s.GetGeneSequence("G1", "c1", "g9", false); !errors.As(err, &noSeq) {
+				t.Errorf("missing gene: %v, want NoSequenceError", err)
+			}
+			if _, err := s.GetRegionSequence("G1", "c1", 300, 400); !errors.As(err, &noSeq) {
+				t.Errorf("region past the end: %v, want NoSequenceError", err)
+			}
+			// Batches leave out what is missing.
+			names := []string{"G1//c1//g9", "G1//c1//g2"}
+			got, err = s.GetMultipleGene(names, true)
+			if records := MatchFastaRecords(names, got); err != nil || records[0] != nil || string(records[1]) != ">G1//c1//g2\nMSTNPKPQRK\n" {
+				t.Errorf("batch with a missing gene = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestOpenIndexedFasta_RejectsPlainGzip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "genes.fa.gz")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(">g1\nACGT\n"))
+	zw.Close()
+	os.WriteFile(path, buf.Bytes(), 0o644)
+	os.WriteFile(path+".fai", []byte("g1\t4\t4\t4\t5\n"), 0o644)
+
+	if _, err := OpenIndexedFasta(path); err == nil || !strings.Contains(err.Error(), "bgzip") {
+		t.Errorf("err = %v, want a request to use bgzip", err)
+	}
+	if _, err := OpenIndexedFasta(filepath.Join(dir, "missing.fa")); err == nil || !strings.Contains(err.Error(), "samtools faidx") {
+		t.Errorf("err = %v, want a hint to index the file", err)
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"testing"
 )
 
-func mockInput(t testing.T) {
+func mockInput(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "seqdb_test")
 	if err != nil {
 		t.Fatalf("Failed to create temporary directory: %v", err)
@@ -117,3 +117,16 @@ func TestGetMultipleRegion(t *testing.T) {
 	// Check that the sequence length is ....
 	fmt.Println(seq)
 }
+
+func TestMatchFastaRecords(t *testing.T) {
+	names := []string{"G//c//g1", "G//c//gone", "G//c:1-500", "G//c//g1", "G//d:5-9"}
+	fasta := ">G//c//g1 some gene\nACGT\n>G//c:1-240\nAC\nGT\n>G//c//g1 some gene\nACGT\n>G//d\nTTTTT\n"
+
+	records := MatchFastaRecords(names, []byte(fasta))
+	want := []string{">G//c//g1 some gene\nACGT\n", "", ">G//c:1-240\nAC\nGT\n", ">G//c//g1 some gene\nACGT\n", ">G//d\nTTTTT\n"}
+	for i := range want {
+		if string(records[i]) != want[i] {
+			t.Errorf("record %d (%s) = %q, want %q", i, names[i], records[i], want[i])
+		}
+	}
+}
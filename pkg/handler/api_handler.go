@@ -0,0 +1,316 @@
+// Handler for the versioned JSON API (/api/v1/...)
+
+package handler
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/model"
+	"go.uber.org/zap"
+)
+
+// maxAPIPageSize caps page_size for JSON clients.
+const maxAPIPageSize = 1000
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// PaginationMeta describes where a page sits in the full result set.
+type PaginationMeta struct {
+	Page       int `json:"page"`
+	PageSize   int `json:"page_size"`
+	TotalItems int `json:"total_items"`
+	TotalPages int `json:"total_pages"`
+}
+
+// writeJSON encodes v with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSONBody(w, status, v)
+}
+
+// writeJSONBody encodes v with the given status code, keeping the Content-Type already set.
+func writeJSONBody(w http.ResponseWriter, status int, v interface{}) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("failed to encode JSON response", zap.Error(err))
+	}
+}
+
+// splitListParam collects values given as repeated and/or comma-separated parameters.
+func splitListParam(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// apiSearchRequestFromQuery accepts every ClusterSearchRequest field by its JSON name,
+// plus the short aliases used by the HTML search form (search, search_by, gm_<id>).
+func apiSearchRequestFromQuery(q url.Values) model.ClusterSearchRequest {
+	req := searchRequestFromQuery(q)
+
+	if v := q.Get("search_for"); v != "" {
+		req.Search_For = v
+	}
+	if v := q.Get("search_field"); v != "" {
+		req.Search_Field = model.ParseClusterField(v)
+	}
+	req.Genome_IDs = append(req.Genome_IDs, splitListParam(q["genome_ids"])...)
+	req.RequireGenesFromGenomes = splitListParam(q["require_genes_from_genomes"])
+	return req
+}
+
+// validateSearchRequest fills defaults and rejects values the query layer cannot handle.
+func validateSearchRequest(req *model.ClusterSearchRequest, requireTerm bool) error {
+	if req.Page <= 0 {
+		req.Page = defaultPageNumber
+	}
+	if req.Page_Size <= 0 {
+		req.Page_Size = defaultPageSize
+	}
+	if req.Page_Size > maxAPIPageSize {
+		return fmt.Errorf("page_size must be at most %d", maxAPIPageSize)
+	}
+	req.Order_Dir = normalizeOrderDir(req.Order_Dir)
+	req.Color_By = canonicalColorBy(req.Color_By)
+
+	switch req.Search_Field {
+	case model.ClusterFieldFunction, model.ClusterFieldCOGID, model.ClusterFieldClusterID, model.ClusterFieldGeneID:
+	default:
+		return fmt.Errorf("search_field must be one of function, cog_id, cluster_id, gene_id")
+	}
+	switch req.Order_By {
+	case model.ClusterFieldFunction, model.ClusterFieldCOGID, model.ClusterFieldClusterID:
+	default:
+		return fmt.Errorf("order_by must be one of function, cog_id, cluster_id")
+	}
+	if requireTerm && req.Search_Field == model.ClusterFieldGeneID && req.Search_For == "" {
+		return fmt.Errorf("search_for is required when searching by gene_id")
+	}
+	return nil
+}
+
+// searchClusters runs req and wraps the page with pagination metadata.
+func (appConfig *AppContext) searchClusters(req model.ClusterSearchRequest) (*ClustersPayload, error) {
+	rows, err := model.SearchGeneCluster(appConfig.GCDB.SQL, req)
+	if err != nil {
+		return nil, err
+	}
+	rowNum, err := model.CountSearchRow(appConfig.GCDB.SQL, req)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []*model.Cluster{}
+	}
+
+	totalPageNum := (rowNum + req.Page_Size - 1) / req.Page_Size
+	return &ClustersPayload{
+		Cluster:   rows,
+		TotalPage: totalPageNum,
+		Pagination: PaginationMeta{
+			Page:       req.Page,
+			PageSize:   req.Page_Size,
+			TotalItems: rowNum,
+			TotalPages: totalPageNum,
+		},
+		Request: &req,
+	}, nil
+}
+
+// ClusterSearchAPI handles GET (query parameters) and POST (JSON ClusterSearchRequest) searches.
+func (appConfig *AppContext) ClusterSearchAPI(w http.ResponseWriter, r *http.Request) {
+	var req model.ClusterSearchRequest
+
+	if r.Method == http.MethodPost {
+		req.Search_Field = model.ClusterFieldFunction
+		req.Order_By = model.ParseClusterField(defaultOrderBy)
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, r, badRequest("invalid request body: %v", err))
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		if q.Get("search_by") == "" && q.Get("search_field") == "" {
+			q.Set("search_field", model.ClusterFieldFunction.String())
+		}
+		req = apiSearchRequestFromQuery(q)
+	}
+
+	if err := validateSearchRequest(&req, true); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return
+	}
+
+	logger.Info("Running search API",
+		zap.String("searchterm", req.Search_For),
+		zap.String("search_field", req.Search_Field.String()),
+		zap.Int("page", req.Page),
+		zap.Int("page_size", req.Page_Size),
+	)
+
+	payload, err := appConfig.searchClusters(req)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ClusterResponse{Success: true, Payload: payload})
+}
+
+// ClusterListAPI lists clusters page by page, or returns exactly the clusters named by cluster_id.
+func (appConfig *AppContext) ClusterListAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if ids := splitListParam(q["cluster_id"]); len(ids) > 0 {
+		if len(ids) > maxAPIPageSize {
+			writeError(w, r, badRequest("at most %d cluster_id values are allowed", maxAPIPageSize))
+			return
+		}
+		rows, err := model.GetClusters(appConfig.GCDB.SQL, ids)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, notFound("one or more clusters not found"))
+			return
+		} else if err != nil {
+			writeError(w, r, backendError(err, "failed to retrieve data"))
+			return
+		}
+		writeJSON(w, http.StatusOK, ClusterResponse{Success: true, Payload: &ClustersPayload{
+			Cluster:   rows,
+			TotalPage: 1,
+			Pagination: PaginationMeta{
+				Page:       1,
+				PageSize:   len(rows),
+				TotalItems: len(rows),
+				TotalPages: 1,
+			},
+		}})
+		return
+	}
+
+	// Listing is an unfiltered property search over cluster IDs, which keeps ordering and filters.
+	req := apiSearchRequestFromQuery(q)
+	req.Search_For = ""
+	req.Search_Field = model.ClusterFieldClusterID
+
+	if err := validateSearchRequest(&req, false); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return
+	}
+
+	payload, err := appConfig.searchClusters(req)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ClusterResponse{Success: true, Payload: payload})
+}
+
+// ClusterAPI returns a single cluster with all genomes, genes and regions.
+func (appConfig *AppContext) ClusterAPI(w http.ResponseWriter, r *http.Request) {
+	cluster_id := r.PathValue("cluster_id")
+
+	res, err := model.GetCluster(appConfig.GCDB.SQL, cluster_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("cluster %s not found", cluster_id))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GenomeListAPI lists genomes with their gene and cluster counts.
+func (appConfig *AppContext) GenomeListAPI(w http.ResponseWriter, r *http.Request) {
+	genomes, err := model.ListGenomes(appConfig.GCDB.SQL)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"genomes": genomes,
+		"total":   len(genomes),
+	})
+}
+
+// GeneLinks points at the other representations of a gene.
+type GeneLinks struct {
+	NucleotideSequence string `json:"nucleotide_sequence"`
+	ProteinSequence    string `json:"protein_sequence"`
+	Heatmap            string `json:"heatmap,omitempty"`
+}
+
+// GeneResponse is a gene's annotation plus navigation links.
+type GeneResponse struct {
+	*model.GeneDetail
+	Links GeneLinks `json:"links"`
+}
+
+// geneLinks builds the sequence and heatmap URLs for a gene.
+func geneLinks(genomeID, contigID, geneID string) GeneLinks {
+	seqQuery := func(isProt bool) string {
+		q := url.Values{}
+		q.Set("genome_id", genomeID)
+		q.Set("contig_id", contigID)
+		q.Set("gene_id", geneID)
+		q.Set("is_prot", strconv.FormatBool(isProt))
+		return "/sequence/by-gene?" + q.Encode()
+	}
+
+	links := GeneLinks{
+		NucleotideSequence: seqQuery(false),
+		ProteinSequence:    seqQuery(true),
+	}
+	if contigID != "" {
+		links.Heatmap = fmt.Sprintf("/cluster/heatmap/%s/%s/%s",
+			url.PathEscape(genomeID), url.PathEscape(contigID), url.PathEscape(geneID))
+	}
+	return links
+}
+
+// GeneAPI returns coordinates, description, completeness and cluster memberships of one gene.
+func (appConfig *AppContext) GeneAPI(w http.ResponseWriter, r *http.Request) {
+	genomeID := r.PathValue("genome_id")
+	geneID := r.PathValue("gene_id")
+
+	gene, err := model.GetGene(appConfig.GCDB.SQL, genomeID, geneID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("gene %s not found in genome %s", geneID, genomeID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GeneResponse{
+		GeneDetail: gene,
+		Links:      geneLinks(gene.GenomeID, gene.ContigID, gene.GeneID),
+	})
+}
+
+// OpenAPISpec serves the machine-readable description of /api/v1.
+func OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/db"
+)
+
+func decodeClusterResponse(t *testing.T, rr *httptest.ResponseRecorder) ClusterResponse {
+	t.Helper()
+	var resp struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+		Payload struct {
+			Clusters []struct {
+				ClusterProperty struct {
+					ClusterID string `json:"cluster_id"`
+				} `json:"cluster_properties"`
+				Genomes map[string]json.RawMessage `json:"genomes"`
+			} `json:"clusters"`
+			Pagination PaginationMeta `json:"pagination"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rr.Body.String())
+	}
+
+	ids := []string{}
+	for _, cl := range resp.Payload.Clusters {
+		ids = append(ids, cl.ClusterProperty.ClusterID)
+	}
+	return ClusterResponse{
+		Success: resp.Success,
+		Error:   resp.Error,
+		Payload: &ClustersPayload{Cluster: ids, Pagination: resp.Payload.Pagination},
+	}
+}
+
+func TestClusterSearchAPI(t *testing.T) {
+	app := newTestAppContext(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"function substring", "GET", "/api/v1/search?search_for=transporter", "", 200, []string{"C1"}},
+		{"form aliases", "GET", "/api/v1/search?search=COG000&search_by=cog_id&order_dir=desc", "", 200, []string{"C2", "C1"}},
+		{"gene id exact", "GET", "/api/v1/search?search_for=G2_0001&search_field=gene_id", "", 200, []string{"C1"}},
+		{"require genes from genomes", "GET", "/api/v1/search?search_for=COG&search_field=cog_id&require_genes_from_genomes=G1,G2", "", 200, []string{"C1"}},
+		{"json body", "POST", "/api/v1/search", `{"search_for":"shock","search_field":"function","page_size":5}`, 200, []string{"C2"}},
+		{"unknown json field", "POST", "/api/v1/search", `{"nope":1}`, 400, nil},
+		{"bad search field", "GET", "/api/v1/search?search_for=x&search_field=bogus", "", 400, nil},
+		{"page size too large", "GET", "/api/v1/search?search_for=x&page_size=5000", "", 400, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			app.ClusterSearchAPI(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				var problem Problem
+				if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil || problem.Status != tt.wantStatus || problem.Detail == "" {
+					t.Fatalf("expected a problem response, got %s", rr.Body.String())
+				}
+				return
+			}
+			resp := decodeClusterResponse(t, rr)
+
+			got := resp.Payload.Cluster.([]string)
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Fatalf("clusters = %v, want %v", got, tt.wantIDs)
+			}
+			if resp.Payload.Pagination.TotalItems != len(tt.wantIDs) {
+				t.Fatalf("total_items = %d, want %d", resp.Payload.Pagination.TotalItems, len(tt.wantIDs))
+			}
+		})
+	}
+}
+
+func TestClusterListAPI(t *testing.T) {
+	app := newTestAppContext(t)
+
+	rr := httptest.NewRecorder()
+	app.ClusterListAPI(rr, httptest.NewRequest("GET", "/api/v1/clusters?page_size=1&page=2", nil))
+	resp := decodeClusterResponse(t, rr)
+	if got := resp.Payload.Cluster.([]string); len(got) != 1 || got[0] != "C2" {
+		t.Fatalf("page 2 = %v, want [C2]", got)
+	}
+	if p := resp.Payload.Pagination; p.TotalItems != 2 || p.TotalPages != 2 {
+		t.Fatalf("unexpected pagination %+v", p)
+	}
+
+	rr = httptest.NewRecorder()
+	app.ClusterListAPI(rr, httptest.NewRequest("GET", "/api/v1/clusters?cluster_id=C2,C1", nil))
+	if got := decodeClusterResponse(t, rr).Payload.Cluster.([]string); strings.Join(got, ",") != "C2,C1" {
+		t.Fatalf("by id = %v, want [C2 C1]", got)
+	}
+
+	rr = httptest.NewRecorder()
+	app.ClusterListAPI(rr, httptest.NewRequest("GET", "/api/v1/clusters?cluster_id=missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("missing cluster status = %d, want 404", rr.Code)
+	}
+}
+
+func TestOpenAPISpecIsValidJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	OpenAPISpec(rr, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	paths, _ := spec["paths"].(map[string]interface{})
+	for _, p := range []string{"/search", "/clusters", "/clusters/{cluster_id}", "/genomes", "/genes/{genome_id}/{gene_id}", "/stats"} {
+		if _, ok := paths[p]; !ok {
+			t.Errorf("openapi.json missing path %s", p)
+		}
+	}
+}
+
+func TestGenomeListAPI(t *testing.T) {
+	app := newTestAppContext(t)
+
+	rr := httptest.NewRecorder()
+	app.GenomeListAPI(rr, httptest.NewRequest("GET", "/api/v1/genomes", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Genomes []struct {
+			GenomeID     string `json:"genome_id"`
+			FullName     string `json:"genome_fullname"`
+			GeneCount    int    `json:"gene_count"`
+			ClusterCount int    `json:"cluster_count"`
+		} `json:"genomes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Genomes) != 2 {
+		t.Fatalf("got %d genomes, want 2", len(resp.Genomes))
+	}
+	g1 := resp.Genomes[0]
+	if g1.GenomeID != "G1" || g1.FullName != "Genome One" || g1.GeneCount != 2 || g1.ClusterCount != 2 {
+		t.Fatalf("unexpected G1 summary %+v", g1)
+	}
+}
+
+func TestGeneAPI(t *testing.T) {
+	app := newTestAppContext(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/genes/G2/G2_0001", nil)
+	req.SetPathValue("genome_id", "G2")
+	req.SetPathValue("gene_id", "G2_0001")
+	rr := httptest.NewRecorder()
+	app.GeneAPI(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		ContigID string `json:"contig_id"`
+		Start    int    `json:"start"`
+		End      int    `json:"end"`
+		Clusters []struct {
+			ClusterID    string  `json:"cluster_id"`
+			Completeness float64 `json:"completeness"`
+		} `json:"clusters"`
+		Links GeneLinks `json:"links"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ContigID != "ctg9" || resp.Start != 1001 || resp.End != 1270 {
+		t.Fatalf("unexpected coordinates %+v", resp)
+	}
+	if len(resp.Clusters) != 1 || resp.Clusters[0].ClusterID != "C1" || resp.Clusters[0].Completeness != 90 {
+		t.Fatalf("unexpected clusters %+v", resp.Clusters)
+	}
+	if !strings.Contains(resp.Links.ProteinSequence, "is_prot=true") || resp.Links.Heatmap != "/cluster/heatmap/G2/ctg9/G2_0001" {
+		t.Fatalf("unexpected links %+v", resp.Links)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/genes/G2/nope", nil)
+	req.SetPathValue("genome_id", "G2")
+	req.SetPathValue("gene_id", "nope")
+	rr = httptest.NewRecorder()
+	app.GeneAPI(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown gene status = %d, want 404", rr.Code)
+	}
+}
+
+func TestStatsAPI(t *testing.T) {
+	app := newTestAppContext(t)
+	rr := httptest.NewRecorder()
+	app.StatsAPI(rr, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "{}" {
+		t.Fatalf("without cache or blastdbcmd: %d %s, want an empty object", rr.Code, rr.Body.String())
+	}
+
+	app.Blastdbcmd = &db.SequenceDB{MaxProcs: 4}
+	app.SequenceCache = db.NewCachedSequenceStore(app.Blastdbcmd, 1<<20)
+	rr = httptest.NewRecorder()
+	app.StatsAPI(rr, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	var got StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SequenceCache == nil || got.SequenceCache.MaxBytes != 1<<20 || got.Blastdbcmd == nil || got.Blastdbcmd.MaxProcs != 4 {
+		t.Errorf("stats = %s", rr.Body.String())
+	}
+}
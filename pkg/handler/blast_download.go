@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/model"
+	"github.com/yumyai/ggtable/pkg/render"
+	"go.uber.org/zap"
+)
+
+// blastReportFormats returns the reports that can be downloaded for a
+// completed job: all of them when its BLAST archive was kept, none otherwise.
+func (appConfig *AppContext) blastReportFormats(job *db.BlastJob) []model.BlastReportFormat {
+	if job.Status != db.BlastJobCompleted {
+		return nil
+	}
+	ok, err := appConfig.BlastManager.HasArchive(job)
+	if err != nil {
+		logger.Error("failed to look up BLAST archive", zap.String("job_id", job.ID), zap.Error(err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return model.BlastReportFormats
+}
+
+func blastDownloadURL(job *db.BlastJob, format model.BlastReportFormat) string {
+	return fmt.Sprintf("/blast/%s/download/%s", job.ID, format.Name)
+}
+
+func blastDownloadLinks(job *db.BlastJob, formats []model.BlastReportFormat) []render.BlastDownload {
+	var links []render.BlastDownload
+	for _, f := range formats {
+		links = append(links, render.BlastDownload{Label: f.Label, URL: blastDownloadURL(job, f)})
+	}
+	return links
+}
+
+// BlastReportDownload serves a completed job's report in one of the
+// model.BlastReportFormats, produced from its BLAST archive.
+func (appConfig *AppContext) BlastReportDownload(w http.ResponseWriter, r *http.Request) {
+	format, ok := model.LookupBlastReportFormat(r.PathValue("format"))
+	if !ok {
+		writeError(w, r, notFound("unknown report format %q", r.PathValue("format")))
+		return
+	}
+	job, ok := appConfig.completedBlastJob(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := appConfig.BlastManager.Archive(job)
+	if errors.Is(err, db.ErrNoArchive) {
+		writeError(w, r, notFound("no BLAST archive was kept for job %s; reports are only available for BLAST+ searches", job.ID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST archive"))
+		return
+	}
+
+	report, err := appConfig.BlastFormatter.Format(r.Context(), archive, format)
+	if errors.Is(err, model.ErrBlastFormatterBusy) {
+		writeError(w, r, unavailable("too many BLAST reports are being prepared; try again shortly", err))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to format BLAST report"))
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="blast-%s.%s"`, job.ID, format.Extension))
+	w.Write(report)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/db"
+	"go.uber.org/zap"
+)
+
+// blastEventKeepAlive is how often an idle event stream sends a comment, so
+// proxies don't close it.
+const blastEventKeepAlive = 15 * time.Second
+
+// BlastJobEvents streams a job's state as Server-Sent Events. A "status" event
+// carrying the BlastJobResponse JSON is sent at once and again whenever the
+// status or queue position changes; the stream ends after the final status.
+func (appConfig *AppContext) BlastJobEvents(w http.ResponseWriter, r *http.Request) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return
+	}
+
+	jobID := r.PathValue("job_id")
+	if _, err := appConfig.BlastManager.JobStatus(jobID); errors.Is(err, db.ErrJobNotFound) {
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Don't let nginx buffer the stream
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		logger.Error("BLAST event stream cannot flush", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	keepAlive := time.NewTicker(blastEventKeepAlive)
+	defer keepAlive.Stop()
+
+	var last BlastJobResponse
+	for sent := false; ; sent = true {
+		changes := appConfig.BlastManager.Changes()
+
+		job, err := appConfig.BlastManager.JobStatus(jobID)
+		if err != nil {
+			// Expired or removed while watching; the client sees the stream end.
+			logger.Info("BLAST event stream ended", zap.String("job_id", jobID), zap.Error(err))
+			return
+		}
+		state := appConfig.blastJobResponse(job)
+		if !sent || state.Status != last.Status || state.QueuePosition != last.QueuePosition {
+			data, _ := json.Marshal(state)
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			last = state
+		}
+		if job.Status.Finished() {
+			return
+		}
+
+		select {
+		case <-changes:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-appConfig.Shutdown:
+			return
+		}
+	}
+}
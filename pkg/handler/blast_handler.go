@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yumyai/ggtable/logger"
 	"github.com/yumyai/ggtable/pkg/db"
@@ -17,7 +21,7 @@ import (
 
 func (appConfig *AppContext) BlastSearchPage(w http.ResponseWriter, r *http.Request) {
 	if appConfig.BlastManager == nil {
-		http.Error(w, "BLAST service unavailable", http.StatusInternalServerError)
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
 		return
 	}
 
@@ -25,188 +29,609 @@ func (appConfig *AppContext) BlastSearchPage(w http.ResponseWriter, r *http.Requ
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		logger.Error("invalid BLAST request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, badRequest("invalid request body: %v", err))
 		return
 	}
 
-	if req.BlastType != "blastn" && req.BlastType != "blastp" {
-		http.Error(w, "Invalid BLAST type", http.StatusBadRequest)
+	job, ok := appConfig.submitBlastJob(w, r, req)
+	if !ok {
 		return
 	}
 
-	if strings.TrimSpace(req.Sequence) == "" {
-		http.Error(w, "Sequence cannot be empty", http.StatusBadRequest)
+	if prefersJSON(r) {
+		status := http.StatusAccepted
+		if job.Status.Finished() {
+			status = http.StatusOK // Answered from the cache
+		}
+		writeJSON(w, status, appConfig.blastJobResponse(job))
 		return
 	}
 
-	job := appConfig.BlastManager.NewJob(req.BlastType)
-	go appConfig.runBlastJob(job.ID, req)
+	http.Redirect(w, r, "/blast/"+job.ID, http.StatusSeeOther)
+}
 
-	if prefersJSON(r) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted)
-		if err := json.NewEncoder(w).Encode(map[string]string{
-			"job_id": job.ID,
-		}); err != nil {
-			logger.Error("failed to encode BLAST response", zap.String("job_id", job.ID), zap.Error(err))
-		}
+// submitBlastJob checks req and queues it for the caller, writing the error
+// response if that fails.
+func (appConfig *AppContext) submitBlastJob(w http.ResponseWriter, r *http.Request, req model.BlastSearchRequest) (job *db.BlastJob, ok bool) {
+	// Also picks the program when blast_type is "auto".
+	if err := model.CheckBlastQuery(&req, appConfig.blastQueryLimits()).Err(); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return nil, false
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return nil, false
+	}
+	if err := appConfig.checkAligner(req); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return nil, false
+	}
+	if err := appConfig.checkCallbackURL(req.CallbackURL); err != nil {
+		writeError(w, r, badRequest("%v", err))
+		return nil, false
+	}
+
+	owner, err := jobOwner(w, r, true)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+
+	job, err = appConfig.BlastManager.SubmitAs(owner, req.BlastType, req.Database, appConfig.blastCacheKey(req), req)
+	if errors.Is(err, db.ErrQueueFull) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, unavailable("the BLAST queue is full; please try again in a few minutes", err))
+		return nil, false
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to create BLAST job"))
+		return nil, false
+	}
+
+	if job.CachedFrom != "" {
+		logger.Info("BLAST result reused", zap.String("job_id", job.ID), zap.String("cached_from", job.CachedFrom))
+	}
+	return job, true
+}
+
+// BlastValidateAPI checks a BLAST request without queuing it, so the search
+// form can point out problems in the query before it is submitted. The check is
+// returned with 200 whether or not the request is valid.
+func (appConfig *AppContext) BlastValidateAPI(w http.ResponseWriter, r *http.Request) {
+	var req model.BlastSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, badRequest("invalid request body: %v", err))
 		return
 	}
 
-	http.Redirect(w, r, "/blast/"+job.ID, http.StatusSeeOther)
+	check := model.CheckBlastQuery(&req, appConfig.blastQueryLimits())
+	if check.Valid {
+		err := req.Validate()
+		if err == nil {
+			err = appConfig.checkAligner(req)
+		}
+		if err == nil {
+			err = appConfig.checkCallbackURL(req.CallbackURL)
+		}
+		if err != nil {
+			check.Valid = false
+			check.Errors = append(check.Errors, model.FastaIssue{Message: err.Error()})
+		}
+	}
+	writeJSON(w, http.StatusOK, check)
 }
 
-func (appConfig *AppContext) runBlastJob(jobID string, req model.BlastSearchRequest) {
+// blastQueryLimits are the limits submitted queries are checked against.
+func (appConfig *AppContext) blastQueryLimits() model.BlastQueryLimits {
+	return model.BlastQueryLimits{
+		MaxQueries:     appConfig.BlastQueries,
+		MaxQueryLength: model.MaxBlastQueryLength,
+		MaxTotalLength: model.MaxBlastTotalLength,
+	}
+}
 
-	appConfig.BlastManager.SetRunning(jobID)
+// blastCacheKey returns the key identical searches share, or "" when results
+// are not reused. req must have been validated.
+func (appConfig *AppContext) blastCacheKey(req model.BlastSearchRequest) string {
+	if !appConfig.BlastCache {
+		return ""
+	}
+	aligner, err := appConfig.aligner(req.AlignerName())
+	var dbPath string
+	if err == nil {
+		dbPath, err = aligner.DatabasePath(req.BlastType, req.Database)
+	}
+	if err == nil {
+		var key string
+		if key, err = model.BlastCacheKey(req, dbPath); err == nil {
+			return key
+		}
+	}
+	// The search itself will report a missing database; just don't cache it.
+	logger.Warn("BLAST result cache skipped", zap.String("blast_type", req.BlastType), zap.Error(err))
+	return ""
+}
 
-	var (
-		output string
-		err    error
-	)
+// BlastJobResponse is the JSON view of a BLAST job's state.
+type BlastJobResponse struct {
+	JobID         string    `json:"job_id"`
+	BlastType     string    `json:"blast_type"`
+	Database      string    `json:"database"`
+	Aligner       string    `json:"aligner"`
+	Status        string    `json:"status"`
+	QueuePosition int       `json:"queue_position,omitempty"` // 1-based; only while queued
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
 
-	switch req.BlastType {
-	case "blastn":
-		output, err = model.BLASTN(appConfig.NuclBLASTDB, req.Sequence)
-	case "blastp":
-		output, err = model.BLASTP(appConfig.ProtBLASTDB, req.Sequence)
-	default:
-		err = errors.New("unsupported BLAST type")
+func (appConfig *AppContext) blastJobResponse(job *db.BlastJob) BlastJobResponse {
+	return BlastJobResponse{
+		JobID:         job.ID,
+		BlastType:     job.BlastType,
+		Database:      job.Database,
+		Aligner:       jobAligner(job),
+		Status:        string(job.Status),
+		QueuePosition: appConfig.BlastManager.QueuePosition(job.ID),
+		Error:         job.Error,
+		CreatedAt:     job.CreatedAt,
+		UpdatedAt:     job.UpdatedAt,
 	}
+}
 
+func (appConfig *AppContext) blastDatabases() model.BlastDatabases {
+	return model.BlastDatabases{
+		Prot:   appConfig.ProtBLASTDB,
+		Nucl:   appConfig.NuclBLASTDB,
+		Genome: appConfig.GenomeBLASTDB,
+	}
+}
+
+// aligner returns the named aligner set up with this server's databases.
+func (appConfig *AppContext) aligner(name string) (model.Aligner, error) {
+	switch name {
+	case model.AlignerBLAST:
+		return model.BlastAligner{DBs: appConfig.blastDatabases()}, nil
+	case model.AlignerDIAMOND:
+		return model.DiamondAligner{ProtDB: appConfig.DiamondDB}, nil
+	case model.AlignerMMseqs:
+		return model.MMseqsAligner{DBs: model.BlastDatabases{
+			Prot:   appConfig.MMseqsProtDB,
+			Nucl:   appConfig.MMseqsNuclDB,
+			Genome: appConfig.MMseqsGenomeDB,
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown aligner %q", name)
+}
+
+// checkAligner reports whether the aligner of a validated request can run its
+// search on this server.
+func (appConfig *AppContext) checkAligner(req model.BlastSearchRequest) error {
+	aligner, err := appConfig.aligner(req.AlignerName())
 	if err != nil {
-		logger.Error("BLAST job failed", zap.String("job_id", jobID), zap.Error(err))
-		appConfig.BlastManager.FailJob(jobID, err)
-		return
+		return err
 	}
+	return aligner.Check(req.BlastType, req.Database, req.BlastParams)
+}
 
-	appConfig.BlastManager.CompleteJob(jobID, output)
+// jobAligner returns the aligner a job runs with, read from its request.
+func jobAligner(job *db.BlastJob) string {
+	var req model.BlastSearchRequest
+	if err := json.Unmarshal(job.Params, &req); err != nil {
+		return model.AlignerBLAST
+	}
+	return req.AlignerName()
 }
 
-func (appConfig *AppContext) BlastStatusPage(w http.ResponseWriter, r *http.Request) {
+// RunBlastJob runs a queued job's BLAST search. It is called by the BlastManager
+// worker pool, which cancels ctx to kill the search.
+func (appConfig *AppContext) RunBlastJob(ctx context.Context, job *db.BlastJob) (string, error) {
+	var req model.BlastSearchRequest
+	if err := json.Unmarshal(job.Params, &req); err != nil {
+		return "", fmt.Errorf("invalid stored BLAST request: %w", err)
+	}
+	if err := req.Validate(); err != nil {
+		return "", fmt.Errorf("invalid stored BLAST request: %w", err)
+	}
+	aligner, err := appConfig.aligner(req.AlignerName())
+	if err != nil {
+		return "", err
+	}
+
+	result, err := aligner.Search(ctx, model.AlignRequest{
+		Program:  req.BlastType,
+		Database: req.Database,
+		Query:    req.Sequence,
+		Params:   req.BlastParams,
+		Threads:  appConfig.BlastThreads,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			logger.Info("BLAST job stopped", zap.String("job_id", job.ID), zap.Error(context.Cause(ctx)))
+		} else {
+			logger.Error("BLAST job failed", zap.String("job_id", job.ID), zap.Error(err))
+		}
+		return "", err
+	}
+
+	// The hits are still stored if the archive cannot be.
+	if len(result.Archive) > 0 {
+		if err := appConfig.BlastManager.SaveArchive(job.ID, result.Archive); err != nil {
+			logger.Error("failed to store BLAST archive", zap.String("job_id", job.ID), zap.Error(err))
+		}
+	}
+
+	// Genome hits are annotated once here rather than every time they are shown.
+	appConfig.annotateGenomeHits(job, result)
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode BLAST result: %w", err)
+	}
+	return string(raw), nil
+}
+
+// decodeBlastResult reads a finished job's stored result, or returns nil
+// while the job has none yet.
+func decodeBlastResult(job *db.BlastJob) (*model.BlastResult, error) {
+	if job.Result == "" {
+		if job.Status == db.BlastJobCompleted {
+			return nil, fmt.Errorf("completed BLAST job %s has no stored result", job.ID)
+		}
+		return nil, nil
+	}
+	result := &model.BlastResult{}
+	if err := json.Unmarshal([]byte(job.Result), result); err != nil {
+		return nil, fmt.Errorf("invalid stored BLAST result for job %s: %w", job.ID, err)
+	}
+	return result, nil
+}
+
+// BlastResultResponse is a job's state plus its hits once it has completed.
+type BlastResultResponse struct {
+	BlastJobResponse
+	Queries []*model.BlastQuerySummary `json:"queries,omitempty"`
+	Hits    []model.BlastHit           `json:"hits,omitempty"`
+	// Downloads maps report formats to their URLs, for BLAST+ searches.
+	Downloads map[string]string `json:"downloads,omitempty"`
+}
+
+// BlastResultAPI returns a BLAST job with its parsed hits.
+func (appConfig *AppContext) BlastResultAPI(w http.ResponseWriter, r *http.Request) {
 	if appConfig.BlastManager == nil {
-		http.Error(w, "BLAST service unavailable", http.StatusInternalServerError)
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
 		return
 	}
 
 	jobID := r.PathValue("job_id")
-	if strings.TrimSpace(jobID) == "" {
-		http.Error(w, "Missing job ID", http.StatusBadRequest)
+	job, err := appConfig.BlastManager.GetJob(jobID)
+	if errors.Is(err, db.ErrJobNotFound) {
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
 		return
 	}
 
-	job, ok := appConfig.BlastManager.GetJob(jobID)
-	if !ok {
-		http.NotFound(w, r)
+	result, err := decodeBlastResult(job)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to read BLAST result"))
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res := BlastResultResponse{BlastJobResponse: appConfig.blastJobResponse(job)}
+	if result != nil {
+		appConfig.annotateGenomeHits(job, result)
+		res.Queries = appConfig.blastQuerySummaries(job, result)
+		res.Hits = result.Hits
+		for _, f := range appConfig.blastReportFormats(job) {
+			if res.Downloads == nil {
+				res.Downloads = make(map[string]string)
+			}
+			res.Downloads[f.Name] = blastDownloadURL(job, f)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
 
-	data := render.BlastPageData{
-		JobID:                  job.ID,
-		BlastType:              job.BlastType,
-		BlastReport:            job.Result,
-		Status:                 string(job.Status),
-		ErrorMessage:           job.Error,
-		ShouldRefresh:          job.Status == db.BlastJobQueued || job.Status == db.BlastJobRunning,
-		RefreshIntervalSeconds: 5,
+// completedBlastJob loads a completed job. When there is none it writes the
+// error response and returns ok false.
+func (appConfig *AppContext) completedBlastJob(w http.ResponseWriter, r *http.Request) (job *db.BlastJob, ok bool) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return nil, false
 	}
 
-	if err := render.RenderBLASTPage(w, data); err != nil {
-		logger.Error("failed to render BLAST page", zap.String("job_id", jobID), zap.Error(err))
+	jobID := r.PathValue("job_id")
+	job, err := appConfig.BlastManager.GetJob(jobID)
+	if errors.Is(err, db.ErrJobNotFound) {
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return nil, false
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
+		return nil, false
+	}
+
+	if job.Status != db.BlastJobCompleted {
+		writeError(w, r, &AppError{Status: http.StatusConflict, Detail: fmt.Sprintf("BLAST job %s is %s; results are available once it has completed", jobID, job.Status)})
+		return nil, false
 	}
+	return job, true
 }
 
-func prefersJSON(r *http.Request) bool {
-	accept := r.Header.Get("Accept")
-	if strings.Contains(accept, "application/json") {
-		return true
+// completedBlastResult loads a completed job and its structured result. When
+// there is none it writes the error response and returns ok false.
+func (appConfig *AppContext) completedBlastResult(w http.ResponseWriter, r *http.Request) (job *db.BlastJob, result *model.BlastResult, ok bool) {
+	job, ok = appConfig.completedBlastJob(w, r)
+	if !ok {
+		return nil, nil, false
 	}
-	return strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest")
+	result, err := decodeBlastResult(job)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to read BLAST result"))
+		return nil, nil, false
+	}
+	appConfig.annotateGenomeHits(job, result)
+	return job, result, true
 }
 
-func (appConfig *AppContext) BlastNRedirectPage(w http.ResponseWriter, r *http.Request) {
+// annotateGenomeHits adds the overlapping genes and clusters to the hits of a
+// genome database search. Results are stored annotated, so the lookup only
+// runs for those stored before annotations were, or whose annotation failed.
+// The hits are still shown if the lookup fails.
+func (appConfig *AppContext) annotateGenomeHits(job *db.BlastJob, result *model.BlastResult) {
+	if job.Database != model.BlastDatabaseGenomes || model.GenomeHitsAnnotated(result.Hits) {
+		return
+	}
+	if err := model.AnnotateGenomeHits(appConfig.GCDB.SQL, result.Hits); err != nil {
+		logger.Error("failed to annotate BLAST genome hits", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// blastQuerySummaries summarises a result per query, with the clusters of the
+// top hits: those of the hit gene for gene database searches, and those the
+// hit overlaps for annotated genome database hits.
+func (appConfig *AppContext) blastQuerySummaries(job *db.BlastJob, result *model.BlastResult) []*model.BlastQuerySummary {
+	summaries := model.SummarizeBlastQueries(result)
+	switch job.Database {
+	case model.BlastDatabaseGenes:
+		// The summaries are still useful without clusters.
+		if err := model.AssignQueryClusters(appConfig.GCDB.SQL, summaries); err != nil {
+			logger.Error("failed to look up clusters of BLAST top hits", zap.String("job_id", job.ID), zap.Error(err))
+		}
+	case model.BlastDatabaseGenomes:
+		for _, s := range summaries {
+			if s.TopHit != nil && s.TopHit.Annotation != nil && len(s.TopHit.Annotation.ClusterIDs) > 0 {
+				s.ClusterIDs = s.TopHit.Annotation.ClusterIDs
+			}
+		}
+	}
+	return summaries
+}
 
-	// Get result from get get gene sequence and
+// BlastBestHitsTSV downloads the best hit of each query as a tab-separated table.
+func (appConfig *AppContext) BlastBestHitsTSV(w http.ResponseWriter, r *http.Request) {
+	job, result, ok := appConfig.completedBlastResult(w, r)
+	if !ok {
+		return
+	}
 
-	genome_id := r.URL.Query().Get("genome_id")
-	contig_id := r.URL.Query().Get("contig_id")
-	start_loc, err_start := strconv.ParseUint(r.URL.Query().Get("start"), 10, 64)
-	end_loc, err_end := strconv.ParseUint(r.URL.Query().Get("end"), 10, 64)
+	tw := csv.NewWriter(w)
+	tw.Comma = '\t'
+	w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="blast-%s-best-hits.tsv"`, job.ID))
+
+	tw.Write([]string{"query_id", "query_length", "hit_count", "subject_id", "genome_id", "genome_name", "contig_id", "gene_id",
+		"cluster_ids", "identity", "query_coverage", "alignment_length", "evalue", "bitscore"})
+	for _, s := range appConfig.blastQuerySummaries(job, result) {
+		row := []string{s.QueryID, strconv.Itoa(s.QueryLength), strconv.Itoa(s.HitCount)}
+		if hit := s.TopHit; hit != nil {
+			row = append(row, hit.SubjectID, hit.GenomeID, hit.GenomeName, hit.ContigID, hit.GeneID,
+				strings.Join(s.ClusterIDs, ","),
+				strconv.FormatFloat(hit.Identity, 'f', -1, 64),
+				strconv.FormatFloat(hit.QueryCoverage, 'f', -1, 64),
+				strconv.Itoa(hit.AlignmentLength),
+				strconv.FormatFloat(hit.EValue, 'g', -1, 64),
+				strconv.FormatFloat(hit.BitScore, 'f', -1, 64))
+		} else {
+			row = append(row, make([]string, 11)...)
+		}
+		tw.Write(row)
+	}
+	tw.Flush()
+	if err := tw.Error(); err != nil {
+		logger.Error("failed to write best hits", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
 
-	// Check if genome_id or contig_id are missing
-	if genome_id == "" || contig_id == "" {
-		http.Error(w, "Missing genome_id or contig_id", http.StatusBadRequest)
+// BlastClusterHeatmapPage shows the clusters hit by a gene database search as
+// the search heatmap, strongest hit first, with the hit genes marked.
+func (appConfig *AppContext) BlastClusterHeatmapPage(w http.ResponseWriter, r *http.Request) {
+	job, result, ok := appConfig.completedBlastResult(w, r)
+	if !ok {
+		return
+	}
+	if job.Database != model.BlastDatabaseGenes {
+		writeError(w, r, &AppError{Status: http.StatusConflict, Detail: "only searches against the gene database can be mapped onto clusters"})
 		return
 	}
 
-	if err_start != nil || err_end != nil {
-		http.Error(w, "Invalid start or end location", http.StatusBadRequest)
+	clusterHits, err := model.MapBlastHitsToClusters(appConfig.GCDB.SQL, result.Hits)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to map BLAST hits to clusters"))
 		return
 	}
 
-	// Create region request
-	req := model.RegionGetRequest{
-		Genome_ID: genome_id,
-		Contig_ID: contig_id,
-		Start:     start_loc,
-		End:       end_loc,
-		Is_Prot:   false,
+	q := r.URL.Query()
+	searchRequest := searchRequestFromQuery(q)
+	// Strongest hit first unless the cluster ID column was chosen.
+	if q.Get("order_by") != "cluster_id" {
+		searchRequest.Order_By = model.ClusterFieldTODO
+	} else {
+		sort.SliceStable(clusterHits, func(i, j int) bool {
+			if searchRequest.Order_Dir == "desc" {
+				return clusterHits[i].ClusterID > clusterHits[j].ClusterID
+			}
+			return clusterHits[i].ClusterID < clusterHits[j].ClusterID
+		})
+	}
+	if colorBy := q.Get("color_by"); colorBy == "" || colorBy == "best_identity" {
+		searchRequest.Color_By = "best_identity"
+	}
+	if len(searchRequest.Genome_IDs) == 0 {
+		searchRequest.Genome_IDs = model.ALL_GENOME_ID
 	}
 
-	seq, errq := model.GetRegionSequence(appConfig.GCDB.SeqDB, req)
+	overlay := render.BlastHeatmapOverlay{
+		JobID:        job.ID,
+		BlastType:    job.BlastType,
+		ClusterCount: len(clusterHits),
+		GeneIdentity: make(map[string]float64),
+	}
+	for _, ch := range clusterHits {
+		for gene, identity := range ch.GeneIdentity {
+			overlay.GeneIdentity[gene] = identity
+		}
+	}
 
-	if errq != nil {
-		logger.Error("ERR")
+	start := min((searchRequest.Page-1)*searchRequest.Page_Size, len(clusterHits))
+	end := min(start+searchRequest.Page_Size, len(clusterHits))
+	clusterIDs := make([]string, 0, end-start)
+	for _, ch := range clusterHits[start:end] {
+		clusterIDs = append(clusterIDs, ch.ClusterID)
+	}
+	rows, err := model.GetClusters(appConfig.GCDB.SQL, clusterIDs)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve clusters"))
+		return
 	}
 
-	baseURL := "https://blast.ncbi.nlm.nih.gov/Blast.cgi"
-	params := url.Values{}
-	params.Add("PROGRAM", "blastn")
-	params.Add("PAGE_TYPE", "BlastSearch")
-	params.Add("QUERY", seq)
-	blastURL := baseURL + "?" + params.Encode()
+	totalPage := (len(clusterHits) + searchRequest.Page_Size - 1) / searchRequest.Page_Size
+	if err := render.RenderBlastClusterHeatmapPage(w, rows, overlay, searchRequest, totalPage); err != nil {
+		logger.Error("Failed to render BLAST cluster heatmap", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
 
-	// Redirect the user to the BLAST URL
-	http.Redirect(w, r, blastURL, http.StatusFound)
+// CancelBlastJob stops a queued or running job. DELETE /blast/{job_id} answers
+// with the job's JSON state; the status page's form posts to
+// /blast/{job_id}/cancel and is redirected back.
+func (appConfig *AppContext) CancelBlastJob(w http.ResponseWriter, r *http.Request) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return
+	}
 
+	jobID := r.PathValue("job_id")
+	job, err := appConfig.BlastManager.GetJob(jobID)
+	if errors.Is(err, db.ErrJobNotFound) {
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
+		return
+	}
+	owner, err := jobOwner(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if job.Owner != "" && owner != job.Owner {
+		writeError(w, r, &AppError{Status: http.StatusForbidden, Detail: "only the submitter of a BLAST job can cancel it"})
+		return
+	}
+
+	err = appConfig.BlastManager.Cancel(jobID)
+	switch {
+	case errors.Is(err, db.ErrJobNotFound):
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return
+	case errors.Is(err, db.ErrJobFinished):
+		writeError(w, r, &AppError{Status: http.StatusConflict, Detail: "the BLAST job has already finished"})
+		return
+	case err != nil:
+		writeError(w, r, backendError(err, "failed to cancel BLAST job"))
+		return
+	}
+	logger.Info("BLAST job cancelled", zap.String("job_id", jobID))
+
+	if r.Method == http.MethodPost && !prefersJSON(r) {
+		http.Redirect(w, r, "/blast/"+jobID, http.StatusSeeOther)
+		return
+	}
+
+	job, err = appConfig.BlastManager.GetJob(jobID)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, appConfig.blastJobResponse(job))
 }
 
-func (appConfig *AppContext) BlastPRedirectPage(w http.ResponseWriter, r *http.Request) {
+func (appConfig *AppContext) BlastStatusPage(w http.ResponseWriter, r *http.Request) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return
+	}
 
-	genome_id := r.URL.Query().Get("genome_id")
-	contig_id := r.URL.Query().Get("contig_id")
-	gene_id := r.URL.Query().Get("gene_id")
+	jobID := r.PathValue("job_id")
+	if strings.TrimSpace(jobID) == "" {
+		writeError(w, r, badRequest("missing job ID"))
+		return
+	}
 
-	// Check if genome_id or contig_id are missing
-	if genome_id == "" || contig_id == "" || gene_id == "" {
-		http.Error(w, "Missing genome_id or contig_id or gene_id", http.StatusBadRequest)
+	job, err := appConfig.BlastManager.GetJob(jobID)
+	if errors.Is(err, db.ErrJobNotFound) {
+		writeError(w, r, notFound("BLAST job %s not found (jobs expire after a while)", jobID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to load BLAST job"))
 		return
 	}
 
-	req := model.GeneGetRequest{
-		Genome_ID: genome_id,
-		Contig_ID: contig_id,
-		Gene_ID:   gene_id,
-		Is_Prot:   true,
+	if prefersJSON(r) {
+		writeJSON(w, http.StatusOK, appConfig.blastJobResponse(job))
+		return
 	}
 
-	seq, errq := model.GetGeneSequence(appConfig.GCDB.SeqDB, req)
+	result, err := decodeBlastResult(job)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to read BLAST result"))
+		return
+	}
 
-	if errq != nil {
-		logger.Error("ERR")
+	var queries []*model.BlastQuerySummary
+	if result != nil {
+		appConfig.annotateGenomeHits(job, result)
+		queries = appConfig.blastQuerySummaries(job, result)
 	}
 
-	baseURL := "https://blast.ncbi.nlm.nih.gov/Blast.cgi"
-	params := url.Values{}
-	params.Add("PROGRAM", "blastp")
-	params.Add("PAGE_TYPE", "BlastSearch")
-	params.Add("QUERY", seq)
-	blastURL := baseURL + "?" + params.Encode()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	// Redirect the user to the BLAST URL
-	http.Redirect(w, r, blastURL, http.StatusFound)
+	data := render.BlastPageData{
+		JobID:                  job.ID,
+		BlastType:              job.BlastType,
+		Database:               job.Database,
+		Aligner:                jobAligner(job),
+		Reused:                 job.CachedFrom != "",
+		Downloads:              blastDownloadLinks(job, appConfig.blastReportFormats(job)),
+		Result:                 result,
+		Queries:                queries,
+		Overviews:              render.BlastOverviews(result, queries),
+		Status:                 string(job.Status),
+		QueuePosition:          appConfig.BlastManager.QueuePosition(job.ID),
+		ErrorMessage:           job.Error,
+		ShouldRefresh:          !job.Status.Finished(),
+		RefreshIntervalSeconds: 5,
+	}
 
+	if err := render.RenderBLASTPage(w, data); err != nil {
+		logger.Error("failed to render BLAST page", zap.String("job_id", jobID), zap.Error(err))
+	}
+}
+
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest")
 }
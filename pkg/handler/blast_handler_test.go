@@ -0,0 +1,791 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+func TestBlastSearchPage_QueuePositionAndFullQueue(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	app.BlastManager.StartWorkers(1, 1, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "", nil
+	})
+	t.Cleanup(func() {
+		close(release)
+		app.BlastManager.Stop()
+	})
+
+	submit := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(`{"blast_type":"blastn","sequence":">q\nACGT"}`))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		return rr
+	}
+
+	if rr := submit(); rr.Code != http.StatusAccepted {
+		t.Fatalf("first submit status = %d: %s", rr.Code, rr.Body.String())
+	}
+	<-started // the only worker is busy
+
+	rr := submit()
+	var queued BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &queued); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("second submit: %d %s", rr.Code, rr.Body.String())
+	}
+	if queued.Status != "queued" || queued.QueuePosition != 1 {
+		t.Fatalf("unexpected queued job %+v", queued)
+	}
+
+	if rr := submit(); rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("full queue status = %d (Retry-After %q), want 503", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// The status page reports the same position.
+	req := httptest.NewRequest(http.MethodGet, "/blast/"+queued.JobID, nil)
+	req.SetPathValue("job_id", queued.JobID)
+	page := httptest.NewRecorder()
+	app.BlastStatusPage(page, req)
+	if !strings.Contains(page.Body.String(), "position 1 in queue") {
+		t.Fatalf("status page missing queue position: %s", page.Body.String())
+	}
+}
+
+func TestCancelBlastJob(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	started := make(chan struct{}, 1)
+	app.BlastManager.StartWorkers(1, 1, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	t.Cleanup(app.BlastManager.Stop)
+
+	job, err := app.BlastManager.Submit("blastn", "genes", nil)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-started
+
+	cancel := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetPathValue("job_id", job.ID)
+		rr := httptest.NewRecorder()
+		app.CancelBlastJob(rr, req)
+		return rr
+	}
+
+	rr := cancel(http.MethodDelete, "/blast/"+job.ID)
+	var got BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("DELETE: %d %s", rr.Code, rr.Body.String())
+	}
+	if got.Status != string(db.BlastJobCancelled) {
+		t.Errorf("status after cancel = %q, want cancelled", got.Status)
+	}
+
+	// Cancelling a finished job conflicts, whichever route is used.
+	if rr := cancel(http.MethodDelete, "/blast/"+job.ID); rr.Code != http.StatusConflict {
+		t.Errorf("second DELETE status = %d, want 409", rr.Code)
+	}
+	if rr := cancel(http.MethodPost, "/blast/"+job.ID+"/cancel"); rr.Code != http.StatusConflict {
+		t.Errorf("POST cancel of finished job status = %d, want 409", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/blast/nope", nil)
+	req.SetPathValue("job_id", "nope")
+	rr = httptest.NewRecorder()
+	app.CancelBlastJob(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", rr.Code)
+	}
+
+	// A job submitted with an API key can only be cancelled with that key.
+	const apiKey = "0123456789abcdef-key"
+	owned, err := app.BlastManager.SubmitAs("key:"+hashToken(apiKey), "blastn", "genes", "", nil)
+	if err != nil {
+		t.Fatalf("submit owned job: %v", err)
+	}
+	cancelOwned := func(key string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/blast/"+owned.ID, nil)
+		req.SetPathValue("job_id", owned.ID)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		app.CancelBlastJob(rr, req)
+		return rr.Code
+	}
+	if code := cancelOwned(""); code != http.StatusForbidden {
+		t.Errorf("anonymous cancel of owned job = %d, want 403", code)
+	}
+	if code := cancelOwned("fedcba9876543210-other"); code != http.StatusForbidden {
+		t.Errorf("cancel with another key = %d, want 403", code)
+	}
+	if code := cancelOwned(apiKey); code != http.StatusOK {
+		t.Errorf("cancel by owner = %d, want 200", code)
+	}
+}
+
+func TestBlastSearchPage_RejectsInvalidParams(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastManager.StartWorkers(1, 1, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		return "", nil
+	})
+	t.Cleanup(app.BlastManager.Stop)
+
+	body := `{"blast_type":"blastn","sequence":">q\nACGT","matrix":"BLOSUM62"}`
+	req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	app.BlastSearchPage(rr, req)
+
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "matrix") {
+		t.Fatalf("status = %d, body %s; want 400 about the matrix", rr.Code, rr.Body.String())
+	}
+	if app.BlastManager.QueueLength() != 0 {
+		t.Errorf("invalid request was queued")
+	}
+}
+
+func TestBlastSearchPage_RecordsProgramAndDatabase(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	release := make(chan struct{})
+	app.BlastManager.StartWorkers(1, 4, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		<-release
+		return "", nil
+	})
+	t.Cleanup(func() {
+		close(release)
+		app.BlastManager.Stop()
+	})
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		return rr
+	}
+
+	rr := submit(`{"blast_type":"tblastn","database":"genomes","sequence":">q\nMKVLAT"}`)
+	var got BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("tblastn submit: %d %s", rr.Code, rr.Body.String())
+	}
+	if got.BlastType != "tblastn" || got.Database != "genomes" {
+		t.Errorf("job = %+v, want tblastn against genomes", got)
+	}
+
+	rr = submit(`{"blast_type":"blastx","sequence":">q\nACGTACGT"}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || got.Database != "genes" {
+		t.Errorf("blastx without database: %d %s, want the gene database", rr.Code, rr.Body.String())
+	}
+
+	if rr := submit(`{"blast_type":"blastx","database":"genomes","sequence":">q\nACGT"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("blastx against genomes status = %d, want 400", rr.Code)
+	}
+}
+
+func TestBlastSearchPage_ReusesCachedResult(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastCache = true
+	app.NuclBLASTDB = filepath.Join(t.TempDir(), "nucl")
+	if err := os.WriteFile(app.NuclBLASTDB+".nsq", []byte("db"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app.BlastManager.StartWorkers(1, 4, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		return "report", nil
+	})
+	t.Cleanup(app.BlastManager.Stop)
+
+	submit := func(body string) (int, BlastJobResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		var got BlastJobResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("submit: %d %s", rr.Code, rr.Body.String())
+		}
+		return rr.Code, got
+	}
+
+	code, first := submit(`{"blast_type":"blastn","sequence":">q\nACGTACGT"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("first submit = %d %+v, want a fresh queued job", code, first)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, _ := app.BlastManager.GetJob(first.JobID)
+		if job.Status == db.BlastJobCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first job still %s", job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	code, again := submit(`{"blast_type":"blastn","sequence":">q\nacgt\nacgt\n"}`)
+	if code != http.StatusOK || again.Status != "completed" {
+		t.Fatalf("repeated submit = %d %+v, want completed at once", code, again)
+	}
+	if body, _ := json.Marshal(again); strings.Contains(string(body), first.JobID) {
+		t.Errorf("repeated submit %+v names the earlier job, which may be someone else's", again)
+	}
+	if again.JobID == first.JobID {
+		t.Errorf("a reused result should still get its own job")
+	}
+
+	if code, other := submit(`{"blast_type":"blastn","sequence":">q\nACGTACGT","evalue":0.001}`); code != http.StatusAccepted {
+		t.Errorf("submit with other params = %d %+v, want a new search", code, other)
+	}
+}
+
+// completedJob stores a finished job with the given result, bypassing the workers.
+func completedJob(t *testing.T, app *AppContext, result string) *db.BlastJob {
+	t.Helper()
+	job, err := app.BlastManager.NewJob("blastn", "genes", nil)
+	if err != nil {
+		t.Fatalf("new job: %v", err)
+	}
+	if err := app.BlastManager.CompleteJob(job.ID, result); err != nil {
+		t.Fatalf("complete job: %v", err)
+	}
+	return job
+}
+
+func TestBlastResults_StructuredHits(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	result, _ := json.Marshal(model.BlastResult{Hits: []model.BlastHit{{
+		QueryID: "<script>q1</script>", SubjectID: "KCB09//ctg1//g1",
+		GenomeID: "KCB09", ContigID: "ctg1", GeneID: "g1",
+		Identity: 99.5, EValue: 2e-50, BitScore: 180, QueryCoverage: 100,
+	}}})
+	job := completedJob(t, app, string(result))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastResultAPI(rr, req)
+
+	var got BlastResultResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("API: %d %s", rr.Code, rr.Body.String())
+	}
+	if got.Status != "completed" || len(got.Hits) != 1 || got.Hits[0].GeneID != "g1" || got.Hits[0].Identity != 99.5 {
+		t.Errorf("unexpected API response %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	page := httptest.NewRecorder()
+	app.BlastStatusPage(page, req)
+	body := page.Body.String()
+	if !strings.Contains(body, `id="blast-hits"`) || !strings.Contains(body, `href="/cluster/heatmap/KCB09/ctg1/g1"`) {
+		t.Errorf("status page has no hit table with heatmap link:\n%s", body)
+	}
+	if strings.Contains(body, "<script>q1</script>") {
+		t.Errorf("query ID was not escaped")
+	}
+}
+
+func TestBlastResults_GenomeHitAnnotation(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	result, _ := json.Marshal(model.BlastResult{Hits: []model.BlastHit{
+		{QueryID: "q1", SubjectID: "G1//ctg1", GenomeID: "G1", ContigID: "ctg1", SubjectStart: 350, SubjectEnd: 150, BitScore: 300},
+		{QueryID: "q1", SubjectID: "G1//ctg1", GenomeID: "G1", ContigID: "ctg1", SubjectStart: 1000, SubjectEnd: 1100, BitScore: 90},
+		{QueryID: "q1", SubjectID: "G2//ctg9", GenomeID: "G2", ContigID: "ctg9", SubjectStart: 5100, SubjectEnd: 5200, BitScore: 80},
+		{QueryID: "q2", SubjectID: "G2//ctg9", GenomeID: "G2", ContigID: "ctg9", SubjectStart: 1200, SubjectEnd: 1300, BitScore: 70},
+	}})
+	job, err := app.BlastManager.NewJob("tblastn", model.BlastDatabaseGenomes, nil)
+	if err != nil {
+		t.Fatalf("new job: %v", err)
+	}
+	if err := app.BlastManager.CompleteJob(job.ID, string(result)); err != nil {
+		t.Fatalf("complete job: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastResultAPI(rr, req)
+	var got BlastResultResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || len(got.Hits) != 4 {
+		t.Fatalf("API: %d %s", rr.Code, rr.Body.String())
+	}
+
+	inGene := got.Hits[0].Annotation
+	if inGene == nil || inGene.Intergenic || len(inGene.Genes) != 1 {
+		t.Fatalf("hit on G1_0001 annotated as %+v", inGene)
+	}
+	if g := inGene.Genes[0]; g.GeneID != "G1_0001" || g.Overlap != 201 || strings.Join(inGene.ClusterIDs, ",") != "C1" {
+		t.Errorf("overlapping gene %+v, clusters %v", g, inGene.ClusterIDs)
+	}
+	if a := got.Hits[1].Annotation; a == nil || !a.Intergenic || len(a.ClusterIDs) != 0 {
+		t.Errorf("hit between genes annotated as %+v", a)
+	}
+	if a := got.Hits[2].Annotation; a == nil || !a.Intergenic || len(a.Regions) != 1 || a.Regions[0].Overlap != 101 || a.ClusterIDs[0] != "C1" {
+		t.Errorf("hit in a cluster region annotated as %+v", a)
+	}
+	if a := got.Hits[3].Annotation; a == nil || len(a.Genes) != 1 || a.Genes[0].GeneID != "G2_0001" || a.Genes[0].Overlap != 71 {
+		t.Errorf("hit across the end of G2_0001 annotated as %+v", a)
+	}
+	if len(got.Queries) != 2 || strings.Join(got.Queries[0].ClusterIDs, ",") != "C1" {
+		t.Errorf("query summaries should carry the clusters of the top hit: %+v", got.Queries)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	page := httptest.NewRecorder()
+	app.BlastStatusPage(page, req)
+	body := page.Body.String()
+	for _, want := range []string{`href="/cluster/heatmap/C1"`, `data-location="intergenic"`, `id="hit-location"`, "201 bp overlap"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page missing %s", want)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/cluster/heatmap/C1", nil)
+	req.SetPathValue("cluster_id", "C1")
+	rr = httptest.NewRecorder()
+	app.ClusterHeatmapByIDPage(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "ABC transporter") {
+		t.Errorf("cluster heatmap by ID: %d", rr.Code)
+	}
+}
+
+func TestBlastResults_StoredAnnotation(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	// Annotations stored with the result are served as they are.
+	stored := &model.BlastHitAnnotation{Genes: []model.BlastOverlapGene{{GeneID: "STORED"}}, Regions: []model.BlastOverlapRegion{}, ClusterIDs: []string{}}
+	result, _ := json.Marshal(model.BlastResult{Hits: []model.BlastHit{
+		{QueryID: "q1", SubjectID: "G1//ctg1", GenomeID: "G1", ContigID: "ctg1", SubjectStart: 350, SubjectEnd: 150, BitScore: 300, Annotation: stored},
+	}})
+	job, err := app.BlastManager.NewJob("tblastn", model.BlastDatabaseGenomes, nil)
+	if err != nil {
+		t.Fatalf("new job: %v", err)
+	}
+	if err := app.BlastManager.CompleteJob(job.ID, string(result)); err != nil {
+		t.Fatalf("complete job: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastResultAPI(rr, req)
+	var got BlastResultResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || len(got.Hits) != 1 {
+		t.Fatalf("API: %d %s", rr.Code, rr.Body.String())
+	}
+	if a := got.Hits[0].Annotation; a == nil || len(a.Genes) != 1 || a.Genes[0].GeneID != "STORED" {
+		t.Errorf("stored annotation was recomputed: %+v", a)
+	}
+}
+
+func TestBlastResults_UnreadableResult(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	job := completedJob(t, app, "BLASTN 2.12.0+\n<b>Query=</b> q1")
+
+	req := httptest.NewRequest(http.MethodGet, "/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	page := httptest.NewRecorder()
+	app.BlastStatusPage(page, req)
+	if page.Code != http.StatusInternalServerError || strings.Contains(page.Body.String(), "<b>Query=</b>") {
+		t.Errorf("status page of unreadable result = %d:\n%s", page.Code, page.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastResultAPI(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("API status of unreadable result = %d, want 500", rr.Code)
+	}
+}
+
+func TestBlastClusterHeatmapPage(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	hits := []model.BlastHit{
+		{GenomeID: "G1", ContigID: "ctg1", GeneID: "G1_0002", Identity: 45, BitScore: 300, EValue: 1e-80},
+		{GenomeID: "G1", ContigID: "ctg1", GeneID: "G1_0001", Identity: 92.5, BitScore: 120, EValue: 1e-30},
+		{GenomeID: "G2", ContigID: "ctg9", GeneID: "G2_0001", Identity: 61, BitScore: 90, EValue: 1e-20},
+		{GenomeID: "G2", ContigID: "ctg9", GeneID: "G2_9999", Identity: 99, BitScore: 500}, // not clustered
+		{GenomeID: "G2", ContigID: "ctg9", Identity: 99, BitScore: 500},                    // genome hit
+	}
+
+	clusters, err := model.MapBlastHitsToClusters(app.GCDB.SQL, hits)
+	if err != nil {
+		t.Fatalf("map hits: %v", err)
+	}
+	if len(clusters) != 2 || clusters[0].ClusterID != "C2" || clusters[1].ClusterID != "C1" {
+		t.Fatalf("clusters not ordered by best bit score: %+v", clusters)
+	}
+	if c1 := clusters[1]; c1.HitCount != 2 || c1.BestIdentity != 92.5 || c1.GenomeIdentity["G2"] != 61 || c1.BestEValue != 1e-30 {
+		t.Errorf("unexpected C1 summary %+v", c1)
+	}
+
+	result, _ := json.Marshal(model.BlastResult{Hits: hits})
+	job := completedJob(t, app, string(result))
+
+	req := httptest.NewRequest(http.MethodGet, "/blast/"+job.ID+"/clusters", nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastClusterHeatmapPage(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, body)
+	}
+	if c1, c2 := strings.Index(body, "ABC transporter"), strings.Index(body, "Heat shock protein"); c1 < 0 || c2 < 0 || c2 > c1 {
+		t.Errorf("expected both clusters, strongest hit (C2) first")
+	}
+	for _, want := range []string{
+		`class="blast-hit"`,
+		"BLAST hit, 92.5% identity",
+		`<option value="best_identity" selected>`,
+		`action="/blast/` + job.ID + `/clusters"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+
+	genomeJob, _ := app.BlastManager.NewJob("tblastn", "genomes", nil)
+	app.BlastManager.CompleteJob(genomeJob.ID, `{"hits":[]}`)
+	req = httptest.NewRequest(http.MethodGet, "/blast/"+genomeJob.ID+"/clusters", nil)
+	req.SetPathValue("job_id", genomeJob.ID)
+	rr = httptest.NewRecorder()
+	app.BlastClusterHeatmapPage(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("genome database job status = %d, want 409", rr.Code)
+	}
+}
+
+func TestBlastSearchPage_QueryLimit(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastQueries = 2
+
+	body := `{"blast_type":"blastp","sequence":">a\nMKV\n>b\nMKV\n>c\nMKV"}`
+	req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	app.BlastSearchPage(rr, req)
+
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "at most 2") {
+		t.Fatalf("status = %d, body %s; want 400 about the query limit", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBlastValidateAPI(t *testing.T) {
+	app := newTestAppContext(t)
+
+	validate := func(body string) model.BlastQueryCheck {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/blast/validate", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		app.BlastValidateAPI(rr, req)
+		var check model.BlastQueryCheck
+		if err := json.Unmarshal(rr.Body.Bytes(), &check); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("validate %s: %d %s", body, rr.Code, rr.Body.String())
+		}
+		return check
+	}
+
+	check := validate(`{"blast_type":"auto","database":"genomes","sequence":">q\nMKVLATGLLLAAAGCSSHEEVKKQ"}`)
+	if !check.Valid || check.MoleculeType != "protein" || check.BlastType != "tblastn" {
+		t.Errorf("auto-detected protein query: %+v", check)
+	}
+
+	check = validate(`{"blast_type":"blastp","sequence":">q\nMKVL\nMK1VL"}`)
+	if check.Valid || len(check.Errors) != 1 || check.Errors[0].Line != 3 {
+		t.Errorf("digits in sequence: %+v", check)
+	}
+
+	// Parameter errors are reported once the query itself is fine.
+	check = validate(`{"blast_type":"blastn","sequence":">q\nACGTACGTACGTACGTACGTACGTACGTACGT","matrix":"BLOSUM62"}`)
+	if check.Valid || len(check.Errors) != 1 || !strings.Contains(check.Errors[0].Message, "matrix") {
+		t.Errorf("blastn with a matrix: %+v", check)
+	}
+}
+
+func TestBlastSearchPage_AutoProgram(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	release := make(chan struct{})
+	app.BlastManager.StartWorkers(1, 4, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		<-release
+		return "", nil
+	})
+	t.Cleanup(func() {
+		close(release)
+		app.BlastManager.Stop()
+	})
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		return rr
+	}
+
+	rr := submit(`{"blast_type":"auto","sequence":">q\nMKVLATGLLLAAAGCSSHEEVKKQ"}`)
+	var got BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || rr.Code != http.StatusAccepted || got.BlastType != "blastp" {
+		t.Fatalf("auto submit: %d %s, want a blastp job", rr.Code, rr.Body.String())
+	}
+
+	rr = submit(`{"blast_type":"blastn","sequence":">q\nMKVLATGLLLAAAGCSSHEEVKKQ"}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "looks like protein") {
+		t.Errorf("protein query for blastn: %d %s, want 400", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBlastResults_MultiQuery(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	result, _ := json.Marshal(model.BlastResult{
+		Queries: []model.BlastQuery{{ID: "vir1", Length: 300}, {ID: "vir2", Length: 120}},
+		Hits: []model.BlastHit{
+			{QueryID: "vir1", SubjectID: "G1//ctg1//G1_0001", GenomeID: "G1", GenomeName: "Genome One", ContigID: "ctg1", GeneID: "G1_0001", Identity: 88, BitScore: 400, EValue: 1e-100},
+			{QueryID: "vir1", SubjectID: "G2//ctg9//G2_0001", GenomeID: "G2", ContigID: "ctg9", GeneID: "G2_0001", Identity: 70, BitScore: 200, EValue: 1e-40},
+		},
+	})
+	job := completedJob(t, app, string(result))
+
+	req := httptest.NewRequest(http.MethodGet, "/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	page := httptest.NewRecorder()
+	app.BlastStatusPage(page, req)
+	body := page.Body.String()
+	for _, want := range []string{`id="hit-query"`, `data-query="vir1"`, `href="/cluster/table/C1"`, "No hits", "/best-hits.tsv"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page lacks %q", want)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/blast/"+job.ID+"/best-hits.tsv", nil)
+	req.SetPathValue("job_id", job.ID)
+	rr := httptest.NewRecorder()
+	app.BlastBestHitsTSV(rr, req)
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if rr.Code != http.StatusOK || len(lines) != 3 {
+		t.Fatalf("TSV: %d\n%s", rr.Code, rr.Body.String())
+	}
+	if !strings.HasPrefix(lines[1], "vir1\t300\t2\tG1//ctg1//G1_0001\tG1\tGenome One\tctg1\tG1_0001\tC1\t88\t") {
+		t.Errorf("best hit row = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "vir2\t120\t0\t\t") {
+		t.Errorf("query without hits row = %q", lines[2])
+	}
+}
+
+func TestBlastJobEvents(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	job, _ := app.BlastManager.NewJob("blastn", "genes", nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /blast/{job_id}/events", app.BlastJobEvents)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/blast/" + job.ID + "/events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var statuses []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var state BlastJobResponse
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			t.Fatalf("bad event data %q: %v", data, err)
+		}
+		statuses = append(statuses, state.Status)
+		switch state.Status {
+		case "queued":
+			app.BlastManager.SetRunning(job.ID)
+		case "running":
+			app.BlastManager.CompleteJob(job.ID, `{"hits":[]}`)
+		}
+	}
+	// The stream ends by itself after the final status.
+	if got := strings.Join(statuses, ","); got != "queued,running,completed" {
+		t.Errorf("statuses = %s", got)
+	}
+
+	resp, err = http.Get(srv.URL + "/blast/nope/events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestBlastSearch_DiamondAligner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake diamond is a shell script")
+	}
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastManager.StartWorkers(1, 4, 0, app.RunBlastJob)
+	t.Cleanup(app.BlastManager.Stop)
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		return rr
+	}
+	const query = `{"blast_type":"auto","aligner":"diamond","sequence":">q1\nMKVLATGLLLAAAGCSSHEEVKKQ"}`
+
+	rr := submit(query)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "DIAMOND is not available") {
+		t.Fatalf("DIAMOND without a database: %d %s, want 400", rr.Code, rr.Body.String())
+	}
+
+	tmp := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do [ \"$1\" = --out ] && out=\"$2\"; shift; done\n" +
+		"printf 'q1\\tG1//ctg1//G1_0001\\t90.0\\t24\\t2\\t0\\t1\\t24\\t1\\t24\\t1e-12\\t50.0\\t24\\t100\\t100\\n' > \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(tmp, "diamond"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(prependPath(t, tmp))
+	app.DiamondDB = filepath.Join(tmp, "genes.dmnd")
+
+	rr = submit(query)
+	var job BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("DIAMOND submit: %d %s", rr.Code, rr.Body.String())
+	}
+	if job.Aligner != model.AlignerDIAMOND || job.BlastType != "blastp" {
+		t.Errorf("job = %+v, want a DIAMOND blastp job", job)
+	}
+
+	var got BlastResultResponse
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.JobID, nil)
+		req.SetPathValue("job_id", job.JobID)
+		res := httptest.NewRecorder()
+		app.BlastResultAPI(res, req)
+		got = BlastResultResponse{}
+		if err := json.Unmarshal(res.Body.Bytes(), &got); err != nil {
+			t.Fatalf("result: %v: %s", err, res.Body.String())
+		}
+		if db.BlastJobStatus(got.Status).Finished() {
+			break
+		}
+	}
+	if got.Status != string(db.BlastJobCompleted) || len(got.Hits) != 1 || got.Hits[0].GeneID != "G1_0001" {
+		t.Fatalf("DIAMOND result = %+v", got)
+	}
+
+	rr = submit(`{"blast_type":"blastp","aligner":"diamond","word_size":3,"sequence":">q1\nMKVLATGLLLAAAGCSSHEEVKKQ"}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "word_size") {
+		t.Errorf("DIAMOND with word_size: %d %s, want 400", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBlastReportDownload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake blast_formatter is a shell script")
+	}
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+
+	download := func(job *db.BlastJob, format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/blast/"+job.ID+"/download/"+format, nil)
+		req.SetPathValue("job_id", job.ID)
+		req.SetPathValue("format", format)
+		rr := httptest.NewRecorder()
+		app.BlastReportDownload(rr, req)
+		return rr
+	}
+
+	result, _ := json.Marshal(model.BlastResult{})
+	job := completedJob(t, app, string(result))
+	if rr := download(job, "xml"); rr.Code != http.StatusNotFound {
+		t.Fatalf("without archive: %d %s, want 404", rr.Code, rr.Body.String())
+	}
+
+	if err := app.BlastManager.SaveArchive(job.ID, []byte("Blast4-archive ::= {}")); err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	script := "#!/bin/sh\nprintf '<BlastOutput/>'\n"
+	if err := os.WriteFile(filepath.Join(tmp, "blast_formatter"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(prependPath(t, tmp))
+
+	rr := download(job, "xml")
+	if rr.Code != http.StatusOK || rr.Body.String() != "<BlastOutput/>" {
+		t.Fatalf("xml: %d %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="blast-`+job.ID+`.xml"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if rr := download(job, "html"); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown format: %d, want 404", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/blast/"+job.ID, nil)
+	req.SetPathValue("job_id", job.ID)
+	res := httptest.NewRecorder()
+	app.BlastResultAPI(res, req)
+	var got BlastResultResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Downloads["tabular"] != "/blast/"+job.ID+"/download/tabular" {
+		t.Errorf("downloads = %v", got.Downloads)
+	}
+}
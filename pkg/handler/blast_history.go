@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/model"
+	"github.com/yumyai/ggtable/pkg/render"
+	"go.uber.org/zap"
+)
+
+const (
+	// blastSessionCookie holds the random token that ties a browser's jobs together.
+	blastSessionCookie = "ggtable_session"
+	blastSessionMaxAge = 365 * 24 * time.Hour
+
+	// minAPIKeyLength keeps API keys long enough not to be guessed.
+	minAPIKeyLength = 16
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+	queryPreviewLength  = 60
+)
+
+// jobOwner identifies whose jobs a request submits or lists: the holder of an
+// API key sent as X-API-Key or a bearer token, or else the browser session of
+// the session cookie. Only a hash is returned, so the job store holds no
+// credentials. With create, browsers without a session are given one; otherwise
+// they get "" and own nothing.
+func jobOwner(w http.ResponseWriter, r *http.Request, create bool) (string, error) {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if key != "" {
+		if len(key) < minAPIKeyLength {
+			return "", badRequest("API key must be at least %d characters; use a long random string", minAPIKeyLength)
+		}
+		return "key:" + hashToken(key), nil
+	}
+
+	if cookie, err := r.Cookie(blastSessionCookie); err == nil && validSessionToken(cookie.Value) {
+		return "session:" + hashToken(cookie.Value), nil
+	}
+	if !create {
+		return "", nil
+	}
+
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf[:])
+	http.SetCookie(w, &http.Cookie{
+		Name:     blastSessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(blastSessionMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "session:" + hashToken(token), nil
+}
+
+// validSessionToken reports whether token looks like one jobOwner handed out.
+func validSessionToken(token string) bool {
+	if len(token) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BlastJobSummary is a job as listed in the job history.
+type BlastJobSummary struct {
+	BlastJobResponse
+	QueryCount   int    `json:"query_count"`
+	QueryPreview string `json:"query_preview"` // First query's ID and the start of its sequence
+}
+
+// BlastHistoryResponse lists the caller's recent jobs, newest first.
+type BlastHistoryResponse struct {
+	Jobs []BlastJobSummary `json:"jobs"`
+}
+
+// BlastHistoryPage lists the jobs submitted from this browser session, or with
+// the request's API key, newest first.
+func (appConfig *AppContext) BlastHistoryPage(w http.ResponseWriter, r *http.Request) {
+	history, err := appConfig.blastHistory(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if prefersJSON(r) {
+		writeJSON(w, http.StatusOK, history)
+		return
+	}
+
+	data := render.BlastHistoryPageData{}
+	for _, job := range history.Jobs {
+		data.Jobs = append(data.Jobs, render.BlastHistoryJob{
+			JobID:         job.JobID,
+			BlastType:     job.BlastType,
+			Database:      job.Database,
+			Aligner:       job.Aligner,
+			Status:        job.Status,
+			QueuePosition: job.QueuePosition,
+			CreatedAt:     job.CreatedAt,
+			QueryCount:    job.QueryCount,
+			QueryPreview:  job.QueryPreview,
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render.RenderBlastHistoryPage(w, data); err != nil {
+		logger.Error("failed to render BLAST history", zap.Error(err))
+	}
+}
+
+// BlastHistoryAPI is BlastHistoryPage as JSON.
+func (appConfig *AppContext) BlastHistoryAPI(w http.ResponseWriter, r *http.Request) {
+	history, err := appConfig.blastHistory(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (appConfig *AppContext) blastHistory(w http.ResponseWriter, r *http.Request) (*BlastHistoryResponse, error) {
+	if appConfig.BlastManager == nil {
+		return nil, unavailable("BLAST service unavailable", nil)
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return nil, badRequest("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		limit = n
+	}
+
+	owner, err := jobOwner(w, r, false)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := appConfig.BlastManager.ListJobs(owner, limit)
+	if err != nil {
+		return nil, backendError(err, "failed to list BLAST jobs")
+	}
+
+	// The list depends on the caller's cookie or key.
+	w.Header().Set("Cache-Control", "private, no-store")
+	history := &BlastHistoryResponse{Jobs: []BlastJobSummary{}}
+	for _, job := range jobs {
+		summary := BlastJobSummary{BlastJobResponse: appConfig.blastJobResponse(job)}
+		var req model.BlastSearchRequest
+		if err := json.Unmarshal(job.Params, &req); err == nil {
+			summary.QueryPreview, summary.QueryCount = model.PreviewBlastQuery(req.Sequence, queryPreviewLength)
+		}
+		history.Jobs = append(history.Jobs, summary)
+	}
+	return history, nil
+}
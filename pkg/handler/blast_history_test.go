@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/db"
+)
+
+func TestBlastHistory(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	release := make(chan struct{})
+	app.BlastManager.StartWorkers(1, 10, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		<-release
+		return "", nil
+	})
+	t.Cleanup(func() {
+		close(release)
+		app.BlastManager.Stop()
+	})
+
+	submit := func(body string, setup func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		setup(req)
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("submit: %d %s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+	list := func(setup func(*http.Request)) (*httptest.ResponseRecorder, BlastHistoryResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/blast", nil)
+		setup(req)
+		rr := httptest.NewRecorder()
+		app.BlastHistoryAPI(rr, req)
+		var got BlastHistoryResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode history: %v: %s", err, rr.Body.String())
+			}
+		}
+		return rr, got
+	}
+	none := func(*http.Request) {}
+
+	// The first submission starts a session; later ones from the browser send it back.
+	rr := submit(`{"blast_type":"blastp","sequence":">first\nMKVLATGLLLAAAGCSSHEEVKKQ"}`, none)
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != blastSessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("session cookie = %+v", cookies)
+	}
+	session := func(req *http.Request) { req.AddCookie(cookies[0]) }
+	submit(`{"blast_type":"blastn","sequence":">second\nACGTACGTACGTACGTACGTACGTACGTACGTACGT\n>third\nACGTACGTACGTACGTACGTACGTACGTACGTTTTT"}`, session)
+	submit(`{"blast_type":"blastp","sequence":">other\nMKVLATGLLLAAAGCSSHEEVKKQ"}`, none) // Another browser
+
+	const apiKey = "0123456789abcdef-key"
+	withKey := func(req *http.Request) { req.Header.Set("X-API-Key", apiKey) }
+	submit(`{"blast_type":"blastp","sequence":">scripted\nMKVLATGLLLAAAGCSSHEEVKKQ"}`, withKey)
+
+	_, got := list(session)
+	if len(got.Jobs) != 2 {
+		t.Fatalf("session history has %d jobs, want 2: %+v", len(got.Jobs), got.Jobs)
+	}
+	if job := got.Jobs[0]; job.BlastType != "blastn" || job.QueryCount != 2 || !strings.HasPrefix(job.QueryPreview, "second ACGT") {
+		t.Errorf("newest job = %+v", job)
+	}
+	if got.Jobs[1].QueryPreview != "first MKVLATGLLLAAAGCSSHEEVKKQ" {
+		t.Errorf("oldest job preview = %q", got.Jobs[1].QueryPreview)
+	}
+
+	_, got = list(func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+apiKey) })
+	if len(got.Jobs) != 1 || got.Jobs[0].QueryPreview != "scripted MKVLATGLLLAAAGCSSHEEVKKQ" {
+		t.Errorf("API key history = %+v", got.Jobs)
+	}
+
+	// Without a session nothing is listed, and no session is started.
+	rr, got = list(none)
+	if rr.Code != http.StatusOK || len(got.Jobs) != 0 || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("anonymous history: %d %+v cookies %v", rr.Code, got.Jobs, rr.Result().Cookies())
+	}
+	// Forged session values own nothing either.
+	_, got = list(func(req *http.Request) { req.AddCookie(&http.Cookie{Name: blastSessionCookie, Value: "x"}) })
+	if len(got.Jobs) != 0 {
+		t.Errorf("forged session listed %+v", got.Jobs)
+	}
+
+	if rr, _ := list(func(req *http.Request) { req.Header.Set("X-API-Key", "short") }); rr.Code != http.StatusBadRequest {
+		t.Errorf("short API key: %d, want 400", rr.Code)
+	}
+	if rr, _ := list(func(req *http.Request) { req.URL.RawQuery = "limit=0" }); rr.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: %d, want 400", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/blast", nil)
+	session(req)
+	page := httptest.NewRecorder()
+	app.BlastHistoryPage(page, req)
+	if body := page.Body.String(); page.Code != http.StatusOK || !strings.Contains(body, "first MKVLATGLLLAAAGCSSHEEVKKQ") || strings.Contains(body, "other MKV") {
+		t.Errorf("history page: %d %s", page.Code, body)
+	}
+}
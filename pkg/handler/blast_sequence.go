@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+const ncbiBlastURL = "https://blast.ncbi.nlm.nih.gov/Blast.cgi"
+
+// geneRequest reads the protein of the gene named by the genome_id,
+// contig_id and gene_id parameters, from the query or a posted form.
+func geneRequest(r *http.Request) (model.GeneGetRequest, error) {
+	req := model.GeneGetRequest{
+		Genome_ID: r.FormValue("genome_id"),
+		Contig_ID: r.FormValue("contig_id"),
+		Gene_ID:   r.FormValue("gene_id"),
+		Is_Prot:   true,
+	}
+	if req.Genome_ID == "" || req.Contig_ID == "" || req.Gene_ID == "" {
+		return req, badRequest("missing genome_id or contig_id or gene_id")
+	}
+	return req, nil
+}
+
+// regionRequest reads the contig region named by the genome_id, contig_id,
+// start and end parameters, from the query or a posted form. Regions longer
+// than a BLAST query may be are refused.
+func regionRequest(r *http.Request) (model.RegionGetRequest, error) {
+	req := model.RegionGetRequest{
+		Genome_ID: r.FormValue("genome_id"),
+		Contig_ID: r.FormValue("contig_id"),
+	}
+	if req.Genome_ID == "" || req.Contig_ID == "" {
+		return req, badRequest("missing genome_id or contig_id")
+	}
+	start, errStart := strconv.ParseUint(r.FormValue("start"), 10, 64)
+	end, errEnd := strconv.ParseUint(r.FormValue("end"), 10, 64)
+	if errStart != nil || errEnd != nil {
+		return req, badRequest("invalid start or end location")
+	}
+	if end < start {
+		return req, badRequest("end must not be before start")
+	}
+	if length := end - start + 1; length > model.MaxBlastQueryLength {
+		return req, badRequest("region is %d bases long (maximum %d)", length, model.MaxBlastQueryLength)
+	}
+	req.Start, req.End = start, end
+	return req, nil
+}
+
+// BlastGeneSearch searches the protein of a gene against the local
+// databases, the gene proteins unless database says otherwise, and redirects
+// to the job page. It is posted by the BLASTP buttons of the cluster pages.
+func (appConfig *AppContext) BlastGeneSearch(w http.ResponseWriter, r *http.Request) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return
+	}
+	geneReq, err := geneRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	seq, err := model.GetGeneSequence(appConfig.GCDB.SeqDB, geneReq)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve sequence"))
+		return
+	}
+	appConfig.blastSequence(w, r, seq, model.BlastDatabaseGenes)
+}
+
+// BlastRegionSearch searches a contig region against the local databases,
+// the genome assemblies unless database says otherwise, and redirects to the
+// job page. It is posted by the BLASTN buttons of the cluster pages.
+func (appConfig *AppContext) BlastRegionSearch(w http.ResponseWriter, r *http.Request) {
+	if appConfig.BlastManager == nil {
+		writeError(w, r, unavailable("BLAST service unavailable", nil))
+		return
+	}
+	regionReq, err := regionRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	seq, err := model.GetRegionSequence(appConfig.GCDB.SeqDB, regionReq)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve sequence"))
+		return
+	}
+	appConfig.blastSequence(w, r, seq, model.BlastDatabaseGenomes)
+}
+
+// BlastSearchNeedsPost answers GET on /blast/gene and /blast/region. Those
+// start a search, so they only accept the forms the cluster pages post, and
+// crawlers following old links do not start searches.
+func (appConfig *AppContext) BlastSearchNeedsPost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", http.MethodPost)
+	writeError(w, r, &AppError{Status: http.StatusMethodNotAllowed, Detail: "local BLAST searches are started with the BLAST buttons on the cluster pages; this address only accepts POST"})
+}
+
+// blastSequence submits seq with the program picked from its molecule type.
+// Identical searches are answered from the cache, so following the same link
+// again does not search again.
+func (appConfig *AppContext) blastSequence(w http.ResponseWriter, r *http.Request, seq, database string) {
+	if d := r.FormValue("database"); d != "" {
+		database = d
+	}
+	job, ok := appConfig.submitBlastJob(w, r, model.BlastSearchRequest{
+		BlastType: model.BlastTypeAuto,
+		Database:  database,
+		Sequence:  seq,
+	})
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, "/blast/"+job.ID, http.StatusSeeOther)
+}
+
+// BlastNRedirectPage sends a contig region to NCBI blastn.
+func (appConfig *AppContext) BlastNRedirectPage(w http.ResponseWriter, r *http.Request) {
+	appConfig.ncbiRedirect(w, r, "blastn", func() (string, error) {
+		req, err := regionRequest(r)
+		if err != nil {
+			return "", err
+		}
+		return model.GetRegionSequence(appConfig.GCDB.SeqDB, req)
+	})
+}
+
+// BlastPRedirectPage sends the protein of a gene to NCBI blastp.
+func (appConfig *AppContext) BlastPRedirectPage(w http.ResponseWriter, r *http.Request) {
+	appConfig.ncbiRedirect(w, r, "blastp", func() (string, error) {
+		req, err := geneRequest(r)
+		if err != nil {
+			return "", err
+		}
+		return model.GetGeneSequence(appConfig.GCDB.SeqDB, req)
+	})
+}
+
+// ncbiRedirect redirects to an NCBI BLAST search of the sequence returned by
+// fetch, if NCBI BLAST is enabled.
+func (appConfig *AppContext) ncbiRedirect(w http.ResponseWriter, r *http.Request, program string, fetch func() (string, error)) {
+	if !appConfig.NCBIBlast {
+		writeError(w, r, notFound("NCBI BLAST is disabled on this server; use the local BLAST links instead"))
+		return
+	}
+	seq, err := fetch()
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve sequence"))
+		return
+	}
+
+	params := url.Values{}
+	params.Add("PROGRAM", program)
+	params.Add("PAGE_TYPE", "BlastSearch")
+	params.Add("QUERY", seq)
+	http.Redirect(w, r, ncbiBlastURL+"?"+params.Encode(), http.StatusFound)
+}
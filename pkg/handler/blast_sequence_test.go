@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+func TestBlastGeneSearch_SubmitsLocalJob(t *testing.T) {
+	tmp := t.TempDir()
+	createFakeBlastdbcmd(t, tmp, ">KCB09//ctg//KCB09_00123\nMKVLAAGIVGLLLAVSAQAA\n")
+	t.Cleanup(prependPath(t, tmp))
+	model.MAP_HEADER = map[string]string{"KCB09": "TestGenome"}
+
+	app := newTestAppContext(t)
+	app.GCDB.SeqDB = &db.SequenceDB{ProtDB: filepath.Join(tmp, "prot")}
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastManager.StartWorkers(1, 4, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		return `{"hits":[]}`, nil
+	})
+	t.Cleanup(app.BlastManager.Stop)
+
+	post := func(form string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/blast/gene", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	req := post("genome_id=KCB09&contig_id=ctg&gene_id=KCB09_00123")
+	rr := httptest.NewRecorder()
+	app.BlastGeneSearch(rr, req)
+
+	loc := rr.Header().Get("Location")
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(loc, "/blast/") {
+		t.Fatalf("got %d %q: %s, want a redirect to the job", rr.Code, loc, rr.Body.String())
+	}
+	job, err := app.BlastManager.GetJob(strings.TrimPrefix(loc, "/blast/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params model.BlastSearchRequest
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if job.BlastType != "blastp" || job.Database != model.BlastDatabaseGenes || !strings.Contains(params.Sequence, "MKVLAAGIVGLLLAVSAQAA") {
+		t.Errorf("job = %s against %s with %q, want blastp of the gene against genes", job.BlastType, job.Database, params.Sequence)
+	}
+	if len(rr.Result().Cookies()) == 0 {
+		t.Error("the job should belong to a new session")
+	}
+
+	req = post("genome_id=KCB09&contig_id=ctg")
+	rr = httptest.NewRecorder()
+	app.BlastGeneSearch(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("missing gene_id: %d, want 400", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/blast/gene?genome_id=KCB09&contig_id=ctg&gene_id=KCB09_00123", nil)
+	rr = httptest.NewRecorder()
+	app.BlastSearchNeedsPost(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: %d, Allow %q, want 405 allowing POST", rr.Code, rr.Header().Get("Allow"))
+	}
+}
+
+func TestBlastRegionSearch_RejectsBadRange(t *testing.T) {
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastManager.StartWorkers(0, 4, 0, nil) // Queue only
+	t.Cleanup(app.BlastManager.Stop)
+
+	for name, form := range map[string]string{
+		"end before start": "genome_id=KCB09&contig_id=ctg&start=100&end=10",
+		"too long":         "genome_id=KCB09&contig_id=ctg&start=1&end=100001",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/blast/region", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.BlastRegionSearch(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", name, rr.Code)
+		}
+	}
+	if n := app.BlastManager.QueueLength(); n != 0 {
+		t.Errorf("%d jobs queued, want none", n)
+	}
+}
+
+func TestBlastRedirect_NCBIOption(t *testing.T) {
+	tmp := t.TempDir()
+	createFakeBlastdbcmd(t, tmp, ">KCB09:1-8\nACGTACGT\n")
+	t.Cleanup(prependPath(t, tmp))
+
+	app := newTestAppContext(t)
+	app.GCDB.SeqDB = &db.SequenceDB{GenomeDB: filepath.Join(tmp, "genome")}
+	redirect := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/redirect/blastn/?genome_id=KCB09&contig_id=ctg&start=1&end=8", nil)
+		rr := httptest.NewRecorder()
+		app.BlastNRedirectPage(rr, req)
+		return rr
+	}
+
+	if rr := redirect(); rr.Code != http.StatusNotFound {
+		t.Errorf("disabled: %d, want 404", rr.Code)
+	}
+	app.NCBIBlast = true
+	rr := redirect()
+	if loc := rr.Header().Get("Location"); rr.Code != http.StatusFound || !strings.HasPrefix(loc, ncbiBlastURL+"?") || !strings.Contains(loc, "ACGTACGT") {
+		t.Errorf("enabled: %d %q, want a redirect to NCBI with the sequence", rr.Code, loc)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yumyai/ggtable/pkg/db"
+)
+
+// EventBlastJobFinished is sent to a job's callback_url once it reaches a
+// final state.
+const EventBlastJobFinished = "blast.job.finished"
+
+// JobFinishedPayload is the body of a completion notification.
+type JobFinishedPayload struct {
+	Event      string    `json:"event"`
+	JobID      string    `json:"job_id"`
+	BlastType  string    `json:"blast_type"`
+	Database   string    `json:"database"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StatusURL  string    `json:"status_url"` // Job page
+	ResultURL  string    `json:"result_url"` // JSON API with the hits
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// checkCallbackURL reports why a job cannot be given callbackURL, or nil.
+func (appConfig *AppContext) checkCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	if appConfig.Webhooks == nil {
+		return errors.New("callback_url is not supported: completion webhooks are not enabled on this server")
+	}
+	return appConfig.Webhooks.CheckURL(callbackURL)
+}
+
+// NotifyJobFinished sends a job's completion notification to the callback_url
+// it was submitted with, if any. It is registered with BlastManager.OnFinished.
+func (appConfig *AppContext) NotifyJobFinished(job *db.BlastJob) {
+	if appConfig.Webhooks == nil || len(job.Params) == 0 {
+		return
+	}
+	var params struct {
+		CallbackURL string `json:"callback_url"`
+	}
+	if err := json.Unmarshal(job.Params, &params); err != nil || params.CallbackURL == "" {
+		return
+	}
+
+	base := strings.TrimSuffix(appConfig.PublicURL, "/")
+	appConfig.Webhooks.Deliver(params.CallbackURL, EventBlastJobFinished, JobFinishedPayload{
+		Event:      EventBlastJobFinished,
+		JobID:      job.ID,
+		BlastType:  job.BlastType,
+		Database:   job.Database,
+		Status:     string(job.Status),
+		Error:      job.Error,
+		StatusURL:  base + "/blast/" + job.ID,
+		ResultURL:  base + "/api/v1/blast/" + job.ID,
+		FinishedAt: job.UpdatedAt,
+	})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/webhook"
+)
+
+func TestBlastSearch_CallbackURL(t *testing.T) {
+	type delivery struct {
+		payload JobFinishedPayload
+		valid   bool
+	}
+	deliveries := make(chan delivery, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var d delivery
+		d.valid = webhook.Verify([]byte("s3cret"), body, r.Header.Get(webhook.HeaderSignature)) &&
+			r.Header.Get(webhook.HeaderEvent) == EventBlastJobFinished
+		_ = json.Unmarshal(body, &d.payload)
+		deliveries <- d
+	}))
+	t.Cleanup(receiver.Close)
+
+	app := newTestAppContext(t)
+	app.BlastManager = db.NewBlastManager(db.NewMemoryJobStore(), db.DefaultJobRetention)
+	app.BlastManager.OnFinished(app.NotifyJobFinished)
+	app.BlastManager.StartWorkers(1, 4, 0, func(ctx context.Context, job *db.BlastJob) (string, error) {
+		return `{"hits":[]}`, nil
+	})
+	t.Cleanup(app.BlastManager.Stop)
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blast", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.BlastSearchPage(rr, req)
+		return rr
+	}
+	body := `{"blast_type":"blastp","sequence":">q\nMKVLATGLLLAAAGCSSHEEVKKQ","callback_url":"` + receiver.URL + `/done"}`
+
+	if rr := submit(body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "webhooks are not enabled") {
+		t.Fatalf("callback_url without webhooks: %d %s, want 400", rr.Code, rr.Body.String())
+	}
+
+	app.Webhooks = webhook.NewSender("s3cret")
+	t.Cleanup(app.Webhooks.Close)
+	if rr := submit(body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "non-public address") {
+		t.Errorf("loopback callback_url: %d %s, want 400", rr.Code, rr.Body.String())
+	}
+	app.Webhooks.AllowPrivate = true // The receiver is on loopback
+	app.PublicURL = "https://ggtable.example.org/"
+
+	if rr := submit(strings.Replace(body, receiver.URL, "ftp://example.org", 1)); rr.Code != http.StatusBadRequest {
+		t.Errorf("ftp callback_url: %d, want 400", rr.Code)
+	}
+
+	rr := submit(body)
+	var job BlastJobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("submit: %d %s", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case d := <-deliveries:
+		if !d.valid {
+			t.Error("notification signature or event header is wrong")
+		}
+		p := d.payload
+		if p.JobID != job.JobID || p.Status != "completed" || p.ResultURL != "https://ggtable.example.org/api/v1/blast/"+job.JobID {
+			t.Errorf("payload = %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+
+	// Jobs without a callback_url send nothing.
+	submit(`{"blast_type":"blastn","sequence":">q\nACGTACGTACGTACGTACGTACGTACGTACGTACGT"}`)
+	select {
+	case d := <-deliveries:
+		t.Errorf("unexpected notification %+v", d.payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
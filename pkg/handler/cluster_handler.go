@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -19,7 +22,7 @@ func (appConfig *AppContext) ClusterHeatmapPage(w http.ResponseWriter, r *http.R
 	gene := r.PathValue("gene_id")
 
 	if genome == "" || gene == "" {
-		fmt.Fprint(w, "ERROR")
+		writeError(w, r, badRequest("genome_id and gene_id are required"))
 		return
 	}
 
@@ -39,42 +42,56 @@ func (appConfig *AppContext) ClusterHeatmapPage(w http.ResponseWriter, r *http.R
 
 	// Check for all possible errors
 	if err != nil {
-		// Cluster not found
-		fmt.Fprint(w, "ERROR")
+		writeError(w, r, backendError(err, "failed to look up gene"))
 		return
-	} else if len(cluster_ids) != 1 {
-		fmt.Fprint(w, "ERROR")
+	} else if len(cluster_ids) == 0 {
+		writeError(w, r, notFound("gene %s of genome %s is not in any cluster", gene, genome))
+		return
+	} else if len(cluster_ids) > 1 {
+		writeError(w, r, &AppError{
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("gene %s of genome %s belongs to several clusters: %s", gene, genome, strings.Join(cluster_ids, ", ")),
+		})
 		return
 	}
 
 	cluster_prob, err2 := model.GetCluster(appConfig.GCDB.SQL, cluster_ids[0])
 
-	// Should be possible, massive error
+	// Should not be possible: the cluster ID came from gene_matches
 	if err2 != nil {
-		fmt.Fprint(w, "ERROR")
+		writeError(w, r, backendError(err2, "failed to retrieve cluster"))
 		return
 	}
 
+	appConfig.renderClusterHeatmap(w, r, cluster_prob)
+}
+
+// ClusterHeatmapByIDPage renders the heatmap for a cluster addressed by ID, for
+// links that have a cluster but no single gene (e.g. annotated genome BLAST hits).
+func (appConfig *AppContext) ClusterHeatmapByIDPage(w http.ResponseWriter, r *http.Request) {
+	clusterID := r.PathValue("cluster_id")
+
+	cluster, err := model.GetCluster(appConfig.GCDB.SQL, clusterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("cluster %s not found", clusterID))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve cluster"))
+		return
+	}
+
+	appConfig.renderClusterHeatmap(w, r, cluster)
+}
+
+// renderClusterHeatmap renders a single cluster as a standalone heatmap page,
+// honouring the color_by and genome_ids query parameters.
+func (appConfig *AppContext) renderClusterHeatmap(w http.ResponseWriter, r *http.Request, cluster *model.Cluster) {
 	// Search request is used for rendering only, no query involve here.
 	// Allow optional color mode from query with canonicalization
-	colorByRaw := r.URL.Query().Get("color_by")
-	switch colorByRaw {
-	case "gene_copy_number", "copy_number", "copies", "copy", "":
-		colorByRaw = "gene_copy_number"
-	case "max_gene_completeness", "max_completeness", "completeness":
-		colorByRaw = "max_gene_completeness"
-	default:
-		colorByRaw = "gene_copy_number"
-	}
-	colorBy := colorByRaw
+	colorBy := canonicalColorBy(r.URL.Query().Get("color_by"))
 
 	// Allow only selected genome IDs (defaults to all)
-	includeGenome := []string{}
-	for key := range r.URL.Query() {
-		if strings.HasPrefix(key, "gm_") {
-			includeGenome = append(includeGenome, strings.TrimPrefix(key, "gm_"))
-		}
-	}
+	includeGenome := genomeIDsFromQuery(r.URL.Query())
 	if len(includeGenome) == 0 {
 		includeGenome = model.ALL_GENOME_ID
 	}
@@ -90,10 +107,11 @@ func (appConfig *AppContext) ClusterHeatmapPage(w http.ResponseWriter, r *http.R
 		// RequireGenesFromGenomes: reqGeneFromGenome,
 	}
 
-	err3 := render.RenderClusterStandaloneHeatmapPage(w, []*model.Cluster{cluster_prob}, search_request, 1)
+	err := render.RenderClusterStandaloneHeatmapPage(w, []*model.Cluster{cluster}, search_request, 1)
 
-	if err3 != nil {
-		fmt.Fprint(w, "ERROR")
+	if err != nil {
+		// Part of the page may already be written, so only log.
+		logger.Error("Failed to render cluster heatmap", zap.String("cluster_id", cluster.ClusterProperty.ClusterID), zap.Error(err))
 		return
 	}
 }
@@ -105,13 +123,19 @@ func (appConfig *AppContext) ClusterDetailPage(w http.ResponseWriter, r *http.Re
 
 	res, err_query := model.GetCluster(appConfig.GCDB.SQL, cluster_id)
 
-	if err_query != nil {
-		panic(err_query)
+	if errors.Is(err_query, sql.ErrNoRows) {
+		writeError(w, r, notFound("cluster %s not found", cluster_id))
+		return
+	} else if err_query != nil {
+		writeError(w, r, backendError(err_query, "failed to retrieve cluster"))
+		return
 	}
 
-	err := render.RenderClusterTablePage(w, res)
-
-	if err != nil {
-		panic(err)
+	// Render into a buffer so a template failure still produces a proper error status.
+	var buf bytes.Buffer
+	if err := render.RenderClusterTablePage(&buf, res); err != nil {
+		writeError(w, r, backendError(err, "failed to render cluster table"))
+		return
 	}
+	_, _ = buf.WriteTo(w)
 }
@@ -4,11 +4,40 @@ package handler
 
 import (
 	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/model"
+	"github.com/yumyai/ggtable/pkg/webhook"
 )
 
 type AppContext struct {
-	GCDB         *db.GeneClusterDB
-	BlastManager *db.BlastManager
-	ProtBLASTDB  string
-	NuclBLASTDB  string
+	GCDB          *db.GeneClusterDB
+	BlastManager  *db.BlastManager
+	ProtBLASTDB   string
+	NuclBLASTDB   string
+	GenomeBLASTDB string // Genome assemblies, searched by nucleotide-database programs
+	BlastThreads  int    // -num_threads for each BLAST process
+	BlastQueries  int    // Query sequences allowed per search, 0 for no limit
+	BlastCache    bool   // Reuse the result of an identical earlier search
+
+	BlastFormatter *model.BlastFormatter // Produces report downloads; nil for no process limit
+
+	// Databases of the other aligners; an empty path leaves those searches
+	// unavailable.
+	DiamondDB      string // DIAMOND database of the gene proteins (.dmnd)
+	MMseqsProtDB   string // MMseqs2 database of the gene proteins
+	MMseqsNuclDB   string // MMseqs2 database of the gene nucleotide sequences
+	MMseqsGenomeDB string // MMseqs2 database of the genome assemblies
+
+	Webhooks  *webhook.Sender // Delivers callback_url notifications; nil disables them
+	PublicURL string          // Base URL for links in notifications, e.g. "https://ggtable.example.org"
+
+	// NCBIBlast enables /redirect/blastn and /redirect/blastp, which send
+	// sequences to NCBI BLAST. Air-gapped or unpublished data should turn it off.
+	NCBIBlast bool
+
+	Shutdown <-chan struct{} // Closed when the server shuts down; ends event streams
+
+	// Reported by /api/v1/stats; nil when the cache is off or sequences are
+	// read from FASTA.
+	SequenceCache *db.CachedSequenceStore
+	Blastdbcmd    *db.SequenceDB
 }
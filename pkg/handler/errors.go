@@ -0,0 +1,142 @@
+// Shared error type and error responses for all handlers
+
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/middle"
+	"github.com/yumyai/ggtable/pkg/render"
+	"go.uber.org/zap"
+)
+
+// AppError is a request failure with the status and message to show the client.
+// Err holds the underlying cause; it is logged but never sent.
+type AppError struct {
+	Status int
+	Detail string
+	Err    error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Detail)
+}
+
+func (e *AppError) Unwrap() error { return e.Err }
+
+// badRequest reports a validation failure.
+func badRequest(format string, args ...interface{}) *AppError {
+	return &AppError{Status: http.StatusBadRequest, Detail: fmt.Sprintf(format, args...)}
+}
+
+// notFound reports a missing resource.
+func notFound(format string, args ...interface{}) *AppError {
+	return &AppError{Status: http.StatusNotFound, Detail: fmt.Sprintf(format, args...)}
+}
+
+// unavailable reports a backend that is not configured or not reachable.
+func unavailable(detail string, err error) *AppError {
+	return &AppError{Status: http.StatusServiceUnavailable, Detail: detail, Err: err}
+}
+
+// backendError classifies err from the model/db layers: unknown rows and
+// sequences become 404, a missing or busy blastdbcmd 503, anything else 500.
+// detail is the message shown for the 5xx case.
+func backendError(err error, detail string) *AppError {
+	var appErr *AppError
+	var noSeq *db.NoSequenceError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, sql.ErrNoRows):
+		return &AppError{Status: http.StatusNotFound, Detail: "not found", Err: err}
+	case errors.As(err, &noSeq):
+		return &AppError{Status: http.StatusNotFound, Detail: "sequence not found", Err: err}
+	case errors.Is(err, exec.ErrNotFound):
+		return unavailable("sequence database is not available", err)
+	case errors.Is(err, db.ErrBlastdbcmdBusy):
+		return unavailable("sequence database is busy; try again shortly", err)
+	default:
+		return &AppError{Status: http.StatusInternalServerError, Detail: detail, Err: err}
+	}
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// wantsProblemJSON reports whether the client should get problem+json rather than HTML.
+func wantsProblemJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") ||
+		strings.Contains(r.Header.Get("Accept"), "application/problem+json") ||
+		prefersJSON(r)
+}
+
+// writeError logs err and sends it as problem+json or an HTML error page.
+// Errors that are not an *AppError are treated as internal errors.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = &AppError{Status: http.StatusInternalServerError, Detail: "internal server error", Err: err}
+	}
+
+	requestID := middle.RequestID(r.Context())
+	fields := []zap.Field{
+		zap.Int("status", appErr.Status),
+		zap.String("method", r.Method),
+		zap.String("url", r.URL.String()),
+		zap.String("request_id", requestID),
+		zap.String("detail", appErr.Detail),
+	}
+	if appErr.Err != nil {
+		fields = append(fields, zap.Error(appErr.Err))
+	}
+	if appErr.Status >= http.StatusInternalServerError {
+		logger.Error("Request failed", fields...)
+	} else {
+		logger.Debug("Request rejected", fields...)
+	}
+
+	title := http.StatusText(appErr.Status)
+
+	if wantsProblemJSON(r) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		writeJSONBody(w, appErr.Status, Problem{
+			Type:      "about:blank",
+			Title:     title,
+			Status:    appErr.Status,
+			Detail:    appErr.Detail,
+			Instance:  r.URL.Path,
+			RequestID: requestID,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(appErr.Status)
+	if err := render.RenderErrorPage(w, render.ErrorPageData{
+		Status:    appErr.Status,
+		Title:     title,
+		Detail:    appErr.Detail,
+		RequestID: requestID,
+	}); err != nil {
+		logger.Error("failed to render error page", zap.Error(err))
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/middle"
+)
+
+func TestErrorResponses(t *testing.T) {
+	app := newTestAppContext(t)
+	router := http.NewServeMux()
+	router.HandleFunc("GET /cluster/table/{cluster_id}", app.ClusterDetailPage)
+	router.HandleFunc("GET /cluster/heatmap/{cluster_id}", app.ClusterHeatmapByIDPage)
+	router.HandleFunc("GET /cluster/heatmap/{genome_id}/{contig_id}/{gene_id}", app.ClusterHeatmapPage)
+	router.HandleFunc("GET /sequence/by-gene", app.GetGeneSequenceHandler)
+	router.HandleFunc("GET /api/v1/clusters/{cluster_id}", app.ClusterAPI)
+	srv := middle.RequestIDMiddleware()(router)
+
+	tests := []struct {
+		name       string
+		target     string
+		accept     string
+		wantStatus int
+		wantJSON   bool
+	}{
+		{"unknown cluster page", "/cluster/table/missing", "text/html", 404, false},
+		{"unknown cluster page as json", "/cluster/table/missing", "application/json", 404, true},
+		{"gene without cluster", "/cluster/heatmap/G1/ctg1/NOPE", "text/html", 404, false},
+		{"unknown cluster heatmap", "/cluster/heatmap/missing", "text/html", 404, false},
+		{"bad is_prot", "/sequence/by-gene?genome_id=G1&contig_id=c&gene_id=g&is_prot=maybe", "", 400, false},
+		{"api not found", "/api/v1/clusters/missing", "", 404, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			requestID := rr.Header().Get("X-Request-ID")
+			if requestID == "" {
+				t.Fatal("missing X-Request-ID header")
+			}
+
+			if tt.wantJSON {
+				var problem Problem
+				if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+					t.Fatalf("decode problem: %v (%s)", err, rr.Body.String())
+				}
+				if problem.Status != tt.wantStatus || problem.RequestID != requestID || problem.Title == "" {
+					t.Fatalf("unexpected problem %+v", problem)
+				}
+				return
+			}
+
+			body := rr.Body.String()
+			if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, requestID) {
+				t.Fatalf("expected an HTML error page with the request ID, got %q", body)
+			}
+		})
+	}
+}
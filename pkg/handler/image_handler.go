@@ -0,0 +1,135 @@
+// Handler for exporting the heatmap as SVG/PNG images
+
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yumyai/ggtable/pkg/model"
+	"github.com/yumyai/ggtable/pkg/render"
+)
+
+// maxImageClusters caps the number of rows in an exported image.
+const maxImageClusters = 1000
+
+// clusterIDsFromQuery collects cluster IDs given as repeated and/or comma-separated "cluster_id" values.
+func clusterIDsFromQuery(q url.Values) []string {
+	var ids []string
+	for _, v := range q["cluster_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// heatmapImageOptionsFromQuery reads cell_size, font_size, font_family, color_by and show_function.
+func heatmapImageOptionsFromQuery(q url.Values) render.HeatmapImageOptions {
+	opts := render.HeatmapImageOptions{
+		CellSize:   parsePositiveIntFallback(q.Get("cell_size"), render.DefaultHeatmapCellSize),
+		FontFamily: q.Get("font_family"),
+		ColorBy:    canonicalColorBy(q.Get("color_by")),
+	}
+	if fs, err := strconv.ParseFloat(q.Get("font_size"), 64); err == nil {
+		opts.FontSize = fs
+	}
+	opts.ShowFunction, _ = strconv.ParseBool(q.Get("show_function"))
+	return opts
+}
+
+// HeatmapSVGHandler renders the heatmap for a search result or a cluster ID list as SVG.
+func (appConfig *AppContext) HeatmapSVGHandler(w http.ResponseWriter, r *http.Request) {
+	appConfig.heatmapImage(w, r, "svg")
+}
+
+// HeatmapPNGHandler renders the heatmap for a search result or a cluster ID list as PNG.
+func (appConfig *AppContext) HeatmapPNGHandler(w http.ResponseWriter, r *http.Request) {
+	appConfig.heatmapImage(w, r, "png")
+}
+
+// heatmapImage accepts either explicit cluster IDs (?cluster_id=A,B) or the same
+// search parameters as /search, and writes the result in the requested format.
+func (appConfig *AppContext) heatmapImage(w http.ResponseWriter, r *http.Request, format string) {
+	q := r.URL.Query()
+	search_request := searchRequestFromQuery(q)
+
+	var (
+		rows []*model.Cluster
+		err  error
+	)
+
+	if clusterIDs := clusterIDsFromQuery(q); len(clusterIDs) > 0 {
+		if len(clusterIDs) > maxImageClusters {
+			writeError(w, r, badRequest("at most %d cluster IDs are allowed", maxImageClusters))
+			return
+		}
+		rows, err = model.GetClusters(appConfig.GCDB.SQL, clusterIDs)
+	} else {
+		if search_request.Page_Size > maxImageClusters {
+			search_request.Page_Size = maxImageClusters
+		}
+		if search_request.Search_For == "" {
+			rows, err = model.GetMainPage(appConfig.GCDB.SQL, search_request)
+		} else {
+			rows, err = model.SearchGeneCluster(appConfig.GCDB.SQL, search_request)
+		}
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("one or more clusters not found"))
+		return
+	} else if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+
+	// Keep the column order of the HTML heatmap; default to all genomes.
+	genomeIDs := model.ALL_GENOME_ID
+	if len(search_request.Genome_IDs) > 0 {
+		selected := make(map[string]struct{}, len(search_request.Genome_IDs))
+		for _, id := range search_request.Genome_IDs {
+			selected[id] = struct{}{}
+		}
+		genomeIDs = []string{}
+		for _, id := range model.ALL_GENOME_ID {
+			if _, ok := selected[id]; ok {
+				genomeIDs = append(genomeIDs, id)
+			}
+		}
+	}
+
+	opts := heatmapImageOptionsFromQuery(q)
+
+	// Render into a buffer so a failure can still produce a proper error status.
+	var (
+		buf         bytes.Buffer
+		contentType string
+	)
+	switch format {
+	case "png":
+		err = render.RenderClusterHeatmapPNG(&buf, rows, genomeIDs, opts)
+		contentType = "image/png"
+	default:
+		err = render.RenderClusterHeatmapSVG(&buf, rows, genomeIDs, opts)
+		contentType = "image/svg+xml"
+	}
+
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to render image"))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if download, _ := strconv.ParseBool(q.Get("download")); download {
+		w.Header().Set("Content-Disposition", `attachment; filename="ggtable-heatmap.`+format+`"`)
+	}
+	_, _ = buf.WriteTo(w)
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"github.com/yumyai/ggtable/pkg/db"
 )
 
 type HealthResponse struct {
@@ -24,3 +26,24 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 
 }
+
+// StatsResponse is the body of GET /api/v1/stats. Each part is left out when
+// the server does not use it.
+type StatsResponse struct {
+	SequenceCache *db.SequenceCacheStats `json:"sequence_cache,omitempty"`
+	Blastdbcmd    *db.BlastdbcmdStats    `json:"blastdbcmd,omitempty"`
+}
+
+// StatsAPI reports the sequence cache lookups and blastdbcmd processes.
+func (appConfig *AppContext) StatsAPI(w http.ResponseWriter, r *http.Request) {
+	var res StatsResponse
+	if appConfig.SequenceCache != nil {
+		stats := appConfig.SequenceCache.Stats()
+		res.SequenceCache = &stats
+	}
+	if appConfig.Blastdbcmd != nil {
+		stats := appConfig.Blastdbcmd.Stats()
+		res.Blastdbcmd = &stats
+	}
+	writeJSON(w, http.StatusOK, res)
+}
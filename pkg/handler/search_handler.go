@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -26,14 +27,16 @@ const (
 
 // Response struct to hold the payload and page number
 type ClustersPayload struct {
-	Cluster   interface{} `json:"clusters"`
-	TotalPage int         `json:"pageNumber"`
+	Cluster    interface{}                 `json:"clusters"`
+	TotalPage  int                         `json:"pageNumber"`
+	Pagination PaginationMeta              `json:"pagination"`
+	Request    *model.ClusterSearchRequest `json:"request,omitempty"` // Normalized request, echoed back
 }
 
 type ClusterResponse struct {
-	Success bool
-	Payload ClustersPayload `json:"payload"`
-	Error   bool
+	Success bool             `json:"success"`
+	Payload *ClustersPayload `json:"payload,omitempty"`
+	Error   string           `json:"error,omitempty"`
 }
 
 func parsePositiveIntFallback(v string, fallback int) int {
@@ -53,52 +56,37 @@ func normalizeOrderDir(raw string) string {
 	}
 }
 
-// Search page
-func (appConfig *AppContext) ClusterSearchPage(w http.ResponseWriter, r *http.Request) {
-
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
-		return
-	}
-
-	searchTerm := r.URL.Query().Get("search")
-	searchBy := r.URL.Query().Get("search_by")
-	searchByF := model.ParseClusterField(searchBy)
-
-	orderBy := r.URL.Query().Get("order_by")
-	if orderBy == "" {
-		orderBy = defaultOrderBy
-	}
-	orderByF := model.ParseClusterField(orderBy)
-
-	currentPage := parsePositiveIntFallback(r.URL.Query().Get("page"), defaultPageNumber)
-	pageSize := parsePositiveIntFallback(r.URL.Query().Get("page_size"), defaultPageSize)
-	orderDir := normalizeOrderDir(r.URL.Query().Get("order_dir"))
-
-	// Color selection canonicalization
-	// Accepted: gene_copy_number | max_gene_completeness
-	// Backward-compat: copy -> gene_copy_number, completeness -> max_gene_completeness
-	colorByRaw := r.URL.Query().Get("color_by")
-	switch colorByRaw {
-	case "gene_copy_number", "copy_number", "copies", "copy", "":
-		// default to gene_copy_number if empty
-		colorByRaw = "gene_copy_number"
+// canonicalColorBy maps the accepted color_by spellings onto the two supported modes.
+// Accepted: gene_copy_number | max_gene_completeness
+// Backward-compat: copy -> gene_copy_number, completeness -> max_gene_completeness
+func canonicalColorBy(raw string) string {
+	switch raw {
 	case "max_gene_completeness", "max_completeness", "completeness":
-		colorByRaw = "max_gene_completeness"
+		return "max_gene_completeness"
 	default:
-		colorByRaw = "gene_copy_number"
+		// default to gene_copy_number if empty or unknown
+		return "gene_copy_number"
 	}
-	colorBy := colorByRaw
+}
 
-	// Include the following genome only
+// genomeIDsFromQuery collects genome IDs from "gm_<genome_id>" keys.
+func genomeIDsFromQuery(q url.Values) []string {
 	var includeGenome []string
-	for key := range r.URL.Query() {
+	for key := range q {
 		if strings.HasPrefix(key, "gm_") {
-			// Strip "gn_" prefix and append to the array
-			strippedKey := strings.TrimPrefix(key, "gm_")
-			includeGenome = append(includeGenome, strippedKey)
+			// Strip "gm_" prefix and append to the array
+			includeGenome = append(includeGenome, strings.TrimPrefix(key, "gm_"))
 		}
 	}
+	return includeGenome
+}
+
+// searchRequestFromQuery builds a ClusterSearchRequest from the search form's query parameters.
+func searchRequestFromQuery(q url.Values) model.ClusterSearchRequest {
+	orderBy := q.Get("order_by")
+	if orderBy == "" {
+		orderBy = defaultOrderBy
+	}
 
 	// // Only include those cluster with following genes
 	// var reqGeneFromGenome []string
@@ -111,38 +99,57 @@ func (appConfig *AppContext) ClusterSearchPage(w http.ResponseWriter, r *http.Re
 	// 	}
 	// }
 
+	return model.ClusterSearchRequest{
+		Search_For:   q.Get("search"),
+		Search_Field: model.ParseClusterField(q.Get("search_by")),
+		Order_By:     model.ParseClusterField(orderBy),
+		Order_Dir:    normalizeOrderDir(q.Get("order_dir")),
+		Page:         parsePositiveIntFallback(q.Get("page"), defaultPageNumber),
+		Page_Size:    parsePositiveIntFallback(q.Get("page_size"), defaultPageSize),
+		Genome_IDs:   genomeIDsFromQuery(q),
+		Color_By:     canonicalColorBy(q.Get("color_by")),
+		// RequireGenesFromGenomes: reqGeneFromGenome,
+	}
+}
+
+// Search page
+func (appConfig *AppContext) ClusterSearchPage(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, badRequest("error parsing form"))
+		return
+	}
+
+	search_request := searchRequestFromQuery(r.URL.Query())
+
 	logger.Info("Running searchpage",
-		zap.String("searchterm", searchTerm),
+		zap.String("searchterm", search_request.Search_For),
 		zap.String("url", r.URL.Path),
-		zap.Int("Page", currentPage),
-		zap.Int("Pagesize", pageSize),
-		zap.String("order_by", orderByF.String()),
-		zap.String("order_dir", orderDir),
-		zap.String("color_by", colorBy),
+		zap.Int("Page", search_request.Page),
+		zap.Int("Pagesize", search_request.Page_Size),
+		zap.String("order_by", search_request.Order_By.String()),
+		zap.String("order_dir", search_request.Order_Dir),
+		zap.String("color_by", search_request.Color_By),
 	)
 
-	var search_request = model.ClusterSearchRequest{
-		Search_For:   searchTerm,
-		Search_Field: searchByF,
-		Order_By:     orderByF,
-		Order_Dir:    orderDir,
-		Page:         currentPage,
-		Page_Size:    pageSize,
-		Genome_IDs:   includeGenome,
-		Color_By:     colorBy,
-		// RequireGenesFromGenomes: reqGeneFromGenome,
+	rows, err := model.SearchGeneCluster(appConfig.GCDB.SQL, search_request)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to retrieve data"))
+		return
+	}
+	rowNum, err := model.CountSearchRow(appConfig.GCDB.SQL, search_request)
+	if err != nil {
+		writeError(w, r, backendError(err, "failed to count total items"))
+		return
 	}
 
-	rows, _ := model.SearchGeneCluster(appConfig.GCDB.SQL, search_request)
-	rowNum, _ := model.CountSearchRow(appConfig.GCDB.SQL, search_request)
-
-	totalPageNum := (rowNum + pageSize - 1) / pageSize // Rounding up
+	totalPageNum := (rowNum + search_request.Page_Size - 1) / search_request.Page_Size // Rounding up
 
-	err := render.RenderClusterHeatmapPage(w, rows, search_request, totalPageNum)
+	err = render.RenderClusterHeatmapPage(w, rows, search_request, totalPageNum)
 
 	if err != nil {
-		logger.Error(err.Error())
-		http.Error(w, "Failed to render table", http.StatusInternalServerError)
+		// The page is streamed, so the status is already sent; just log.
+		logger.Error("Failed to render search page", zap.Error(err))
 	}
 }
 
@@ -160,17 +167,7 @@ func (appConfig *AppContext) MainPage(w http.ResponseWriter, r *http.Request) {
 	orderByF := model.ParseClusterField(orderBy)
 	orderDir := normalizeOrderDir(r.URL.Query().Get("order_dir"))
 
-	// Color selection canonicalization
-	colorByRaw := r.URL.Query().Get("color_by")
-	switch colorByRaw {
-	case "gene_copy_number", "copy_number", "copies", "copy", "":
-		colorByRaw = "gene_copy_number"
-	case "max_gene_completeness", "max_completeness", "completeness":
-		colorByRaw = "max_gene_completeness"
-	default:
-		colorByRaw = "gene_copy_number"
-	}
-	colorBy := colorByRaw
+	colorBy := canonicalColorBy(r.URL.Query().Get("color_by"))
 
 	logger.Info("Running mainpage",
 		zap.String("url", r.URL.Path),
@@ -194,11 +191,7 @@ func (appConfig *AppContext) MainPage(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := model.GetMainPage(appConfig.GCDB.SQL, search_request) // Capture the error here
 	if err != nil {
-		logger.Error("Failed to get main page data from model",
-			zap.String("url", r.URL.Path),
-			zap.Any("search_request", search_request), // Log the request details
-			zap.Error(err))                            // Log the error
-		http.Error(w, "Failed to retrieve data", http.StatusInternalServerError)
+		writeError(w, r, backendError(err, "failed to retrieve data"))
 		return // Important: stop execution after sending error
 	}
 
@@ -206,11 +199,7 @@ func (appConfig *AppContext) MainPage(w http.ResponseWriter, r *http.Request) {
 
 	// rowNum, err := model.CountRowByQuery(, ) // Capture the error here
 	if err != nil {
-		logger.Error("Failed to count rows by query",
-			zap.String("url", r.URL.Path),
-			zap.Any("search_request", search_request), // Log the request details
-			zap.Error(err))                            // Log the error
-		http.Error(w, "Failed to count total items", http.StatusInternalServerError)
+		writeError(w, r, backendError(err, "failed to count total items"))
 		return // Important: stop execution after sending error
 	}
 
@@ -219,8 +208,7 @@ func (appConfig *AppContext) MainPage(w http.ResponseWriter, r *http.Request) {
 	err = render.RenderClusterHeatmapPage(w, rows, search_request, totalPageNum)
 
 	if err != nil {
-		logger.Error(err.Error()) // Already logging the error message
-		http.Error(w, "Failed to render table", http.StatusInternalServerError)
-		// No return needed here as it's the last statement in the function
+		// The page is streamed, so the status is already sent; just log.
+		logger.Error("Failed to render main page", zap.Error(err))
 	}
 }
@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/middle"
 	"github.com/yumyai/ggtable/pkg/model"
+	"go.uber.org/zap"
 )
 
 // Response struct to hold the payload and page number
@@ -15,12 +22,6 @@ type SequencePayload struct {
 	Sequence interface{} `json:"sequence"`
 }
 
-type SequenceReponse struct {
-	Status          string `json:"success"`
-	SequencePayload string `json:"payload"`
-	Error           string `json:"error"`
-}
-
 func (appConfig *AppContext) GetGeneSequenceHandler(w http.ResponseWriter, r *http.Request) {
 
 	genome_id := r.URL.Query().Get("genome_id")
@@ -30,7 +31,12 @@ func (appConfig *AppContext) GetGeneSequenceHandler(w http.ResponseWriter, r *ht
 	is_prot, err := strconv.ParseBool(is_prot_str)
 
 	if err != nil {
-		http.Error(w, "is_prot need to be bool-like string", http.StatusBadRequest)
+		writeError(w, r, badRequest("is_prot need to be bool-like string"))
+		return
+	}
+	if genome_id == "" || contig_id == "" || gene_id == "" {
+		writeError(w, r, badRequest("genome_id, contig_id and gene_id are required"))
+		return
 	}
 
 	genome_gene_param := model.GeneGetRequest{
@@ -43,11 +49,10 @@ func (appConfig *AppContext) GetGeneSequenceHandler(w http.ResponseWriter, r *ht
 	respons, err := model.GetGeneSequence(appConfig.GCDB.SeqDB, genome_gene_param)
 
 	if err != nil {
-		http.Error(w, "Not found (maybe sequence database isn't available?)", http.StatusBadRequest)
-
-	} else {
-		fmt.Fprint(w, respons)
+		writeError(w, r, backendError(err, "failed to retrieve sequence"))
+		return
 	}
+	fmt.Fprint(w, respons)
 }
 
 func (appConfig *AppContext) GetRegionSequenceHandler(w http.ResponseWriter, r *http.Request) {
@@ -65,10 +70,16 @@ func (appConfig *AppContext) GetRegionSequenceHandler(w http.ResponseWriter, r *
 	if err_end != nil {
 		errorMessages = append(errorMessages, "Invalid end value")
 	}
+	if genome_id == "" || contig_id == "" {
+		errorMessages = append(errorMessages, "genome_id and contig_id are required")
+	}
+	if err_start == nil && err_end == nil && end < start {
+		errorMessages = append(errorMessages, "end must not be before start")
+	}
 
 	if len(errorMessages) > 0 {
 		// Join all error messages into a single response
-		http.Error(w, strings.Join(errorMessages, "; "), http.StatusBadRequest)
+		writeError(w, r, badRequest("%s", strings.Join(errorMessages, "; ")))
 		return
 	}
 
@@ -83,11 +94,10 @@ func (appConfig *AppContext) GetRegionSequenceHandler(w http.ResponseWriter, r *
 	respons, err := model.GetRegionSequence(appConfig.GCDB.SeqDB, region_gene_param)
 
 	if err != nil {
-		http.Error(w, "No", http.StatusBadRequest)
-
-	} else {
-		fmt.Fprint(w, respons)
+		writeError(w, r, backendError(err, "failed to retrieve sequence"))
+		return
 	}
+	fmt.Fprint(w, respons)
 }
 
 func (appConfig *AppContext) GetSequenceByClusterIDHandler(w http.ResponseWriter, r *http.Request) {
@@ -97,23 +107,18 @@ func (appConfig *AppContext) GetSequenceByClusterIDHandler(w http.ResponseWriter
 	is_prot, errgenome := strconv.ParseBool(is_prot_str)
 
 	if errgenome != nil {
-		http.Error(w, "is_prot need to be bool-like string", http.StatusBadRequest)
+		writeError(w, r, badRequest("is_prot need to be bool-like string"))
+		return
 	}
 
 	// Get cluster info
 	cluster_info, errgenome := model.GetCluster(appConfig.GCDB.SQL, cluster_id)
 
-	if errgenome != nil {
-		// Build error string
-		response := SequenceReponse{
-			Status:          "error",
-			SequencePayload: "",
-			Error:           errgenome.Error(),
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(response)
+	if errors.Is(errgenome, sql.ErrNoRows) {
+		writeError(w, r, notFound("cluster %s not found", cluster_id))
+		return
+	} else if errgenome != nil {
+		writeError(w, r, backendError(errgenome, "failed to retrieve cluster"))
 		return
 	}
 
@@ -166,34 +171,152 @@ func (appConfig *AppContext) GetSequenceByClusterIDHandler(w http.ResponseWriter
 	}
 
 	// Handle error
-	if gene_err != nil || region_err != nil {
+	if gene_err != nil {
+		writeError(w, r, backendError(gene_err, "failed to retrieve gene sequences"))
+		return
+	}
+	if region_err != nil {
+		writeError(w, r, backendError(region_err, "failed to retrieve region sequences"))
+		return
+	}
 
-		var erroMessg string
-		erroMessg += ""
+	// Search sequence
+	fmt.Fprint(w, gene)
 
-		if gene_err != nil {
-			erroMessg += gene_err.Error()
-		}
-		if region_err != nil {
-			erroMessg += region_err.Error()
+	if !is_prot {
+		fmt.Fprint(w, region)
+	}
+}
+
+// maxSequenceBatchBody caps the request body of a batch sequence request.
+const maxSequenceBatchBody = 4 << 20
+
+// SequenceBatchReport is the JSON response of a batch request when the client asks for JSON.
+type SequenceBatchReport struct {
+	Fasta     string                     `json:"fasta"`
+	Requested int                        `json:"requested"`
+	Errors    []model.SequenceBatchError `json:"errors"`
+}
+
+// writeSequenceBatchErrors lists errs as FASTA comment lines, to follow the
+// records of a plain-text batch response.
+func writeSequenceBatchErrors(w io.Writer, errs []model.SequenceBatchError, requested int) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "; %d of %d entries failed\n", len(errs), requested)
+	for _, e := range errs {
+		if e.Line > 0 {
+			fmt.Fprintf(w, "; line %d: %s: %s\n", e.Line, e.Entry, e.Error)
+		} else {
+			fmt.Fprintf(w, "; %s: %s\n", e.Entry, e.Error)
 		}
+	}
+}
+
+// streamWriter sends each write to the client straight away and counts the
+// bytes sent.
+type streamWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	n  int64
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	if err == nil {
+		s.rc.Flush()
+	}
+	return n, err
+}
 
-		response := SequenceReponse{
-			Status:          "error",
-			SequencePayload: "",
-			Error:           erroMessg,
+// SequenceBatchHandler returns one FASTA for many genes and regions.
+//
+// The body is either JSON ({"genes": [...], "regions": [...]}) or plain text with one
+// genome//contig//gene [prot|nucl] or genome//contig:start-end entry per line; the
+// is_prot query parameter sets the default molecule for text gene lines.
+// The FASTA is streamed a group at a time. Entries that cannot be parsed or found
+// are listed in ";" comment lines after the records, or in the "errors" field when
+// the client accepts JSON.
+func (appConfig *AppContext) SequenceBatchHandler(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxSequenceBatchBody)
+
+	var (
+		batch *model.SequenceBatchRequest
+		errs  []model.SequenceBatchError
+		err   error
+	)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		batch = &model.SequenceBatchRequest{}
+		dec := json.NewDecoder(body)
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(batch); err == nil {
+			errs = model.ValidateSequenceBatch(batch)
 		}
+	} else {
+		defaultProt, _ := strconv.ParseBool(r.URL.Query().Get("is_prot"))
+		batch, errs, err = model.ParseSequenceBatchText(body, defaultProt)
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(response)
+	if err != nil {
+		writeError(w, r, badRequest("invalid request body: %v", err))
+		return
+	}
+	if batch.Len() > model.MaxSequenceBatchEntries {
+		writeError(w, r, badRequest("too many entries (maximum %d)", model.MaxSequenceBatchEntries))
+		return
+	}
+	if bases := batch.RegionBases(); bases > model.MaxSequenceBatchBases {
+		writeError(w, r, badRequest("regions total %d bases (maximum %d)", bases, model.MaxSequenceBatchBases))
+		return
+	}
+	if batch.Len() == 0 {
+		if prefersJSON(r) {
+			writeJSON(w, http.StatusBadRequest, SequenceBatchReport{Errors: errs})
+		} else {
+			writeError(w, r, badRequest("no valid genes or regions in request"))
+		}
 		return
 	}
 
-	// Search sequence
-	fmt.Fprint(w, gene)
+	logger.Info("Fetching sequence batch",
+		zap.Int("genes", len(batch.Genes)),
+		zap.Int("regions", len(batch.Regions)),
+	)
+
+	if prefersJSON(r) {
+		var buf bytes.Buffer
+		fetchErrs, err := model.FetchSequenceBatch(appConfig.GCDB.SeqDB, batch, &buf)
+		if err != nil {
+			writeError(w, r, backendError(err, "failed to retrieve sequences"))
+			return
+		}
+		errs = append(errs, fetchErrs...)
+		if errs == nil {
+			errs = []model.SequenceBatchError{}
+		}
+		writeJSON(w, http.StatusOK, SequenceBatchReport{
+			Fasta:     buf.String(),
+			Requested: batch.Len(),
+			Errors:    errs,
+		})
+		return
+	}
 
-	if !is_prot {
-		fmt.Fprint(w, region)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := &streamWriter{w: w, rc: http.NewResponseController(w)}
+	fetchErrs, err := model.FetchSequenceBatch(appConfig.GCDB.SeqDB, batch, out)
+	if err != nil {
+		if out.n == 0 {
+			writeError(w, r, backendError(err, "failed to retrieve sequences"))
+			return
+		}
+		// The status has been sent with the first records.
+		logger.Error("Sequence batch failed part way", zap.String("request_id", middle.RequestID(r.Context())), zap.Error(err))
+		fmt.Fprintf(w, "; error: failed to retrieve the remaining sequences\n")
+		return
 	}
+	writeSequenceBatchErrors(w, append(errs, fetchErrs...), batch.Len())
 }
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"net/http/httptest"
@@ -131,3 +133,99 @@ func TestGetRegionSequenceHandler_InvalidParams(t *testing.T) {
 		t.Fatalf("expected error about start value, got %q", rr.Body.String())
 	}
 }
+
+// createLookupBlastdbcmd installs a fake blastdbcmd that answers -entry_batch
+// input from known, printing one record per found ID and failing on any miss.
+func createLookupBlastdbcmd(t *testing.T, dir string, known map[string]string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("lookup fake needs a POSIX shell")
+	}
+
+	var cases strings.Builder
+	for id, seq := range known {
+		cases.WriteString("    '" + id + "') printf '>%s\\n" + seq + "\\n' \"$id\" ;;\n")
+	}
+	script := "#!/usr/bin/env bash\nstatus=0\n" +
+		"while read -r id rest; do\n  case \"$id\" in\n" + cases.String() +
+		"    *) echo \"Error: $id: OID not found\" >&2; status=1 ;;\n  esac\ndone\nexit $status\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "blastdbcmd"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake blastdbcmd: %v", err)
+	}
+}
+
+func TestSequenceBatchHandler(t *testing.T) {
+	tmp := t.TempDir()
+	createLookupBlastdbcmd(t, tmp, map[string]string{
+		"G1//ctg1//G1_0001": "ACGT",
+		"G2//ctg9":          "TTTT",
+	})
+	t.Cleanup(prependPath(t, tmp))
+
+	appConfig := newTestAppContext(t)
+
+	t.Run("text returns FASTA and lists misses after it", func(t *testing.T) {
+		body := "# comment\nG1//ctg1//G1_0001\nG1//ctg1//MISSING prot\nG2//ctg9:1-4\nnot-an-entry\n"
+		req := httptest.NewRequest(http.MethodPost, "/sequence/batch", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		appConfig.SequenceBatchHandler(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		got := rr.Body.String()
+		if !strings.Contains(got, ">Genome One-G1//ctg1//G1_0001\nACGT") || !strings.Contains(got, "TTTT") {
+			t.Fatalf("unexpected FASTA: %q", got)
+		}
+		wantErrs := "; 2 of 3 entries failed\n; line 5: not-an-entry: expected genome//contig//gene or genome//contig:start-end\n; G1//ctg1//MISSING: sequence not found\n"
+		if !strings.HasSuffix(got, wantErrs) {
+			t.Fatalf("expected the bad line and the missing gene after the FASTA, got %q", got)
+		}
+	})
+
+	t.Run("regions over the length limit", func(t *testing.T) {
+		body := fmt.Sprintf("G2//ctg9:1-%d\n", model.MaxSequenceBatchBases+1)
+		req := httptest.NewRequest(http.MethodPost, "/sequence/batch", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		appConfig.SequenceBatchHandler(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("json report", func(t *testing.T) {
+		body := `{"genes":[{"genome_id":"G1","contig_id":"ctg1","gene_id":"G1_0001"},{"genome_id":"G1","contig_id":"ctg1","gene_id":"NOPE"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/sequence/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+
+		appConfig.SequenceBatchHandler(rr, req)
+
+		var report SequenceBatchReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v (%s)", err, rr.Body.String())
+		}
+		if report.Requested != 2 || len(report.Errors) != 1 || report.Errors[0].Entry != "G1//ctg1//NOPE" {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+		if !strings.Contains(report.Fasta, "ACGT") {
+			t.Fatalf("missing sequence in report: %q", report.Fasta)
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/sequence/batch", strings.NewReader("\n# nothing\n"))
+		rr := httptest.NewRecorder()
+
+		appConfig.SequenceBatchHandler(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/db"
+	"github.com/yumyai/ggtable/pkg/model"
+	"go.uber.org/zap/zapcore"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestAppContext builds an AppContext over a small gene table fixture:
+//
+//	C1 (ABC transporter): genes in G1 and G2, a region in G2
+//	C2 (Heat shock protein): gene in G1 only
+func newTestAppContext(t *testing.T) *AppContext {
+	t.Helper()
+
+	if err := logger.InitLogger(zapcore.ErrorLevel); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "gene_table.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	stmts := []string{
+		`CREATE TABLE genome_info (genome_id TEXT PRIMARY KEY, genome_fullname TEXT)`,
+		`CREATE TABLE gene_clusters (cluster_id TEXT PRIMARY KEY, cog_id TEXT, expected_length INTEGER, function_description TEXT, representative_gene TEXT)`,
+		`CREATE TABLE gene_matches (cluster_id TEXT, genome_id TEXT, contig_id TEXT, gene_id TEXT)`,
+		`CREATE TABLE gene_info (genome_id TEXT, gene_id TEXT, gene_length INTEGER, description TEXT, start_location INTEGER, end_location INTEGER)`,
+		`CREATE TABLE region_matches (cluster_id TEXT, genome_id TEXT, contig_id TEXT, start_location INTEGER, end_location INTEGER)`,
+
+		`INSERT INTO genome_info VALUES ('G1', 'Genome One'), ('G2', 'Genome Two')`,
+		`INSERT INTO gene_clusters VALUES
+			('C1', 'COG0001', 300, 'ABC transporter', 'G1_0001'),
+			('C2', 'COG0002', 600, 'Heat shock protein', 'G1_0002')`,
+		`INSERT INTO gene_matches VALUES
+			('C1', 'G1', 'ctg1', 'G1_0001'),
+			('C1', 'G2', 'ctg9', 'G2_0001'),
+			('C2', 'G1', 'ctg1', 'G1_0002')`,
+		`INSERT INTO gene_info VALUES
+			('G1', 'G1_0001', 300, 'ABC transporter permease', 101, 400),
+			('G2', 'G2_0001', 270, 'ABC transporter, partial', 1001, 1270),
+			('G1', 'G1_0002', 600, 'HSP70', 2001, 2600)`,
+		`INSERT INTO region_matches VALUES ('C1', 'G2', 'ctg9', 5001, 5300)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("fixture %q: %v", stmt, err)
+		}
+	}
+
+	if err := model.InitMapHeader(conn); err != nil {
+		t.Fatalf("init header: %v", err)
+	}
+	model.SetGenomeID([]string{"G1", "G2"})
+
+	return &AppContext{
+		GCDB: db.NewGeneClusterDB(conn, &db.SequenceDB{}),
+	}
+}
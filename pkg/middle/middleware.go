@@ -1,6 +1,7 @@
 package middle
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -20,6 +21,11 @@ func (r *statusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap lets http.ResponseController reach Flush on the wrapped writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // 2. Logging Middleware
 func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -48,6 +54,14 @@ func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 }
 
 // 3. Request ID Middleware
+type requestIDKey struct{}
+
+// RequestID returns the ID assigned by RequestIDMiddleware, or "" outside of it.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 func RequestIDMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -57,8 +71,11 @@ func RequestIDMiddleware() func(http.Handler) http.Handler {
 			// Set it in the header so the client/frontend can see it
 			w.Header().Set("X-Request-ID", reqID)
 
+			// Keep it on the context so handlers can put it in error responses
+			ctx := context.WithValue(r.Context(), requestIDKey{}, reqID)
+
 			// Pass the request down the chain
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
@@ -0,0 +1,307 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aligners a search can run with, selected by BlastSearchRequest.Aligner.
+const (
+	AlignerBLAST   = "blast"   // BLAST+, the default
+	AlignerDIAMOND = "diamond" // DIAMOND: blastp and blastx, much faster on large protein query sets
+	AlignerMMseqs  = "mmseqs"  // MMseqs2 easy-search
+)
+
+// alignerNames lists the aligners in the order they are offered.
+var alignerNames = []string{AlignerBLAST, AlignerDIAMOND, AlignerMMseqs}
+
+// Aligner runs a search for one of the BLAST programs and reports the hits in
+// BLAST's tabular form, so results look the same whichever tool found them.
+type Aligner interface {
+	// Check reports why program cannot run against database with params on
+	// this aligner, or nil. database is BlastDatabaseGenes or BlastDatabaseGenomes.
+	Check(program, database string, params BlastParams) error
+	// DatabasePath returns the database file(s) searched for program against database.
+	DatabasePath(program, database string) (string, error)
+	// Search runs the search. The process is killed when ctx is done.
+	Search(ctx context.Context, req AlignRequest) (*BlastResult, error)
+}
+
+// AlignRequest is a search for an Aligner. Check must have passed for it.
+type AlignRequest struct {
+	Program  string // blastn, blastp, blastx, tblastn or tblastx
+	Database string // BlastDatabaseGenes or BlastDatabaseGenomes
+	Query    string // FASTA
+	Params   BlastParams
+	Threads  int // Passed to the tool when greater than one
+}
+
+// BlastAligner runs BLAST+ against the BLAST databases.
+type BlastAligner struct {
+	DBs BlastDatabases
+}
+
+func (a BlastAligner) Check(program, database string, params BlastParams) error {
+	if _, err := a.DatabasePath(program, database); err != nil {
+		return err
+	}
+	return params.Validate(program)
+}
+
+func (a BlastAligner) DatabasePath(program, database string) (string, error) {
+	return a.DBs.Path(program, database)
+}
+
+func (a BlastAligner) Search(ctx context.Context, req AlignRequest) (*BlastResult, error) {
+	dbPath, err := a.DatabasePath(req.Program, req.Database)
+	if err != nil {
+		return nil, err
+	}
+	return runBLASTCommand(ctx, req.Program, dbPath, req.Query, req.Params, req.Threads)
+}
+
+// DiamondAligner runs DIAMOND blastp and blastx against a DIAMOND database
+// (.dmnd) of the gene proteins. An empty ProtDB disables it.
+type DiamondAligner struct {
+	ProtDB string
+}
+
+func (a DiamondAligner) Check(program, database string, params BlastParams) error {
+	if _, err := a.DatabasePath(program, database); err != nil {
+		return err
+	}
+	if err := params.Validate(program); err != nil {
+		return err
+	}
+	if params.WordSize != 0 || params.Task != "" {
+		return errors.New("DIAMOND does not take word_size or task; leave them empty or use BLAST+")
+	}
+	return nil
+}
+
+func (a DiamondAligner) DatabasePath(program, database string) (string, error) {
+	switch {
+	case a.ProtDB == "":
+		return "", errors.New("DIAMOND is not available on this server")
+	case program != "blastp" && program != "blastx":
+		return "", fmt.Errorf("DIAMOND runs blastp and blastx only, not %s", program)
+	case database != BlastDatabaseGenes:
+		return "", errors.New("DIAMOND only searches the gene proteins")
+	}
+	return a.ProtDB, nil
+}
+
+func (a DiamondAligner) Search(ctx context.Context, req AlignRequest) (*BlastResult, error) {
+	if err := a.Check(req.Program, req.Database, req.Params); err != nil {
+		return nil, err
+	}
+	return runFileAligner(ctx, "diamond", req.Query, func(queryFile, outFile, _ string) []string {
+		p := req.Params
+		args := []string{req.Program, "--db", a.ProtDB, "--query", queryFile, "--out", outFile, "--quiet",
+			"--outfmt", "6"}
+		args = append(args, blastOutputColumns...)
+
+		maxTargets := p.MaxTargetSeqs
+		if maxTargets == 0 {
+			maxTargets = DefaultMaxTargetSeqs
+		}
+		args = append(args, "--max-target-seqs", strconv.Itoa(maxTargets))
+		if p.EValue > 0 {
+			args = append(args, "--evalue", strconv.FormatFloat(p.EValue, 'g', -1, 64))
+		}
+		if p.Matrix != "" {
+			args = append(args, "--matrix", p.Matrix)
+		}
+		if p.GapCosts != "" {
+			open, extend, _ := parseGapCosts(p.GapCosts)
+			args = append(args, "--gapopen", strconv.Itoa(open), "--gapextend", strconv.Itoa(extend))
+		}
+		if p.Filter != nil {
+			masking := "0"
+			if *p.Filter {
+				masking = "seg"
+			}
+			args = append(args, "--masking", masking)
+		}
+		if req.Threads > 1 {
+			args = append(args, "--threads", strconv.Itoa(req.Threads))
+		}
+		return args
+	})
+}
+
+// MMseqsAligner runs MMseqs2 easy-search against MMseqs2 databases built from
+// the same sequences as the BLAST databases. Searches whose database path is
+// empty are not offered.
+type MMseqsAligner struct {
+	DBs BlastDatabases
+}
+
+// mmseqsOutputColumns are MMseqs2's names for blastOutputColumns.
+var mmseqsOutputColumns = []string{
+	"query", "target", "pident", "alnlen", "mismatch", "gapopen",
+	"qstart", "qend", "tstart", "tend", "evalue", "bits",
+	"qlen", "tlen", "qcov",
+}
+
+func (a MMseqsAligner) Check(program, database string, params BlastParams) error {
+	if _, err := a.DatabasePath(program, database); err != nil {
+		return err
+	}
+	if err := params.Validate(program); err != nil {
+		return err
+	}
+	if params.WordSize != 0 || params.Task != "" || params.Matrix != "" || params.GapCosts != "" {
+		return errors.New("MMseqs2 takes only evalue, max_target_seqs and filter; leave the others empty or use BLAST+")
+	}
+	return nil
+}
+
+func (a MMseqsAligner) DatabasePath(program, database string) (string, error) {
+	path, err := a.DBs.Path(program, database)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("MMseqs2 %s against %s is not available on this server", program, database)
+	}
+	return path, nil
+}
+
+func (a MMseqsAligner) Search(ctx context.Context, req AlignRequest) (*BlastResult, error) {
+	if err := a.Check(req.Program, req.Database, req.Params); err != nil {
+		return nil, err
+	}
+	dbPath, _ := a.DatabasePath(req.Program, req.Database)
+
+	result, err := runFileAligner(ctx, "mmseqs", req.Query, func(queryFile, outFile, tmpDir string) []string {
+		p := req.Params
+		args := []string{"easy-search", queryFile, dbPath, outFile, tmpDir, "-v", "1",
+			"--format-output", strings.Join(mmseqsOutputColumns, ",")}
+
+		// Protein-protein and translated searches are detected from the
+		// databases; nucleotide searches have to be asked for.
+		switch req.Program {
+		case "blastn":
+			args = append(args, "--search-type", "3")
+		case "tblastx":
+			args = append(args, "--search-type", "2")
+		}
+
+		maxTargets := p.MaxTargetSeqs
+		if maxTargets == 0 {
+			maxTargets = DefaultMaxTargetSeqs
+		}
+		args = append(args, "--max-seqs", strconv.Itoa(maxTargets))
+		if p.EValue > 0 {
+			args = append(args, "-e", strconv.FormatFloat(p.EValue, 'g', -1, 64))
+		}
+		if p.Filter != nil {
+			mask := "0"
+			if *p.Filter {
+				mask = "1"
+			}
+			args = append(args, "--mask", mask)
+		}
+		if req.Threads > 1 {
+			args = append(args, "--threads", strconv.Itoa(req.Threads))
+		}
+		return args
+	})
+	if err != nil {
+		return nil, err
+	}
+	// MMseqs2 reports query coverage as a fraction.
+	for i := range result.Hits {
+		result.Hits[i].QueryCoverage *= 100
+	}
+	return result, nil
+}
+
+// runFileAligner runs a tool that reads its query from a file and writes its
+// tabular output to another, in a scratch directory removed afterwards.
+// buildArgs gets the query, output and spare temporary directory paths.
+func runFileAligner(ctx context.Context, cmdName, inputFasta string, buildArgs func(queryFile, outFile, tmpDir string) []string) (*BlastResult, error) {
+	cleanedFasta, queries, err := prepareQuery(inputFasta)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "ggtable-"+cmdName+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	queryFile := filepath.Join(dir, "query.fasta")
+	outFile := filepath.Join(dir, "hits.tsv")
+	tmpDir := filepath.Join(dir, "tmp")
+	if err := os.WriteFile(queryFile, []byte(cleanedFasta+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(tmpDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	if _, err := runSearchProcess(ctx, cmdName, buildArgs(queryFile, outFile, tmpDir), ""); err != nil {
+		return nil, err
+	}
+
+	out, err := os.Open(outFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no output: %w", cmdName, err)
+	}
+	defer out.Close()
+	result, err := ParseBlastTabular(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s output: %w", cmdName, err)
+	}
+	result.Queries = queries
+	return result, nil
+}
+
+// prepareQuery cleans a FASTA query and lists its sequences.
+func prepareQuery(inputFasta string) (string, []BlastQuery, error) {
+	cleanedFasta, err := cleanFasta(inputFasta)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to clean FASTA: %w", err)
+	}
+	queries, err := ParseBlastQueries(cleanedFasta)
+	if err != nil {
+		return "", nil, err
+	}
+	return cleanedFasta, queries, nil
+}
+
+// runSearchProcess runs a search tool with stdin as its input and returns its
+// standard output. Errors carry the tool's standard error output.
+func runSearchProcess(ctx context.Context, cmdName string, args []string, stdin string) (*bytes.Buffer, error) {
+	cmd := exec.CommandContext(ctx, cmdName, args...)
+	cmd.WaitDelay = 5 * time.Second // Don't hang on pipes after the process is killed
+	if stdin != "" {
+		cmd.Stdin = bytes.NewBufferString(stdin)
+	}
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%s stopped: %w", cmdName, ctxErr)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to execute %s: %w: %s", cmdName, err, msg)
+		}
+		return nil, fmt.Errorf("failed to execute %s: %w", cmdName, err)
+	}
+	return &out, nil
+}
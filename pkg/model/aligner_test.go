@@ -0,0 +1,141 @@
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeAligner installs a shell script named name on PATH that records its
+// arguments in the returned file and writes hits to the output path found by
+// outputArg.
+func fakeAligner(t *testing.T, name, outputArg, hits string) (argsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake aligners are shell scripts")
+	}
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > " + argsFile + "\n" +
+		outputArg + "\n" +
+		"printf '" + hits + "' > \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+func readArgs(t *testing.T, path string) string {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("aligner was not run: %v", err)
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func TestDiamondAligner_Search(t *testing.T) {
+	argsFile := fakeAligner(t, "diamond",
+		`while [ $# -gt 0 ]; do [ "$1" = --out ] && out="$2"; shift; done`,
+		`q1\tG1//ctg1//G1_0001\t92.5\t40\t3\t0\t1\t40\t5\t44\t1e-20\t80.1\t40\t100\t100\n`)
+
+	filter := true
+	a := DiamondAligner{ProtDB: "/db/genes.dmnd"}
+	result, err := a.Search(context.Background(), AlignRequest{
+		Program:  "blastx",
+		Database: BlastDatabaseGenes,
+		Query:    ">q1\nATGGCGAAACTG\n",
+		Params:   BlastParams{EValue: 1e-5, GapCosts: "11,1", Filter: &filter},
+		Threads:  4,
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].GeneID != "G1_0001" || result.Hits[0].QueryCoverage != 100 {
+		t.Fatalf("hits = %+v", result.Hits)
+	}
+	if len(result.Queries) != 1 || result.Queries[0].ID != "q1" {
+		t.Errorf("queries = %+v", result.Queries)
+	}
+
+	args := readArgs(t, argsFile)
+	for _, want := range []string{"blastx --db /db/genes.dmnd", "--outfmt 6 qseqid sseqid", "--max-target-seqs 500",
+		"--evalue 1e-05", "--gapopen 11 --gapextend 1", "--masking seg", "--threads 4"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q lack %q", args, want)
+		}
+	}
+}
+
+func TestDiamondAligner_Check(t *testing.T) {
+	a := DiamondAligner{ProtDB: "/db/genes.dmnd"}
+	tests := []struct {
+		name     string
+		program  string
+		database string
+		params   BlastParams
+		wantErr  string
+	}{
+		{"blastp", "blastp", BlastDatabaseGenes, BlastParams{}, ""},
+		{"nucleotide program", "blastn", BlastDatabaseGenes, BlastParams{}, "blastp and blastx only"},
+		{"genomes", "blastx", BlastDatabaseGenomes, BlastParams{}, "gene proteins"},
+		{"word size", "blastp", BlastDatabaseGenes, BlastParams{WordSize: 3}, "word_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Check(tt.program, tt.database, tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Check error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (DiamondAligner{}).Check("blastp", BlastDatabaseGenes, BlastParams{}); err == nil {
+		t.Error("DIAMOND without a database was accepted")
+	}
+}
+
+func TestMMseqsAligner_Search(t *testing.T) {
+	argsFile := fakeAligner(t, "mmseqs", `out="$4"`,
+		`q1\tG1//ctg1\t99.0\t30\t0\t0\t1\t30\t1001\t1030\t1e-10\t55.0\t30\t5000\t0.5\n`)
+
+	a := MMseqsAligner{DBs: BlastDatabases{Genome: "/db/mmseqs/genomes"}}
+	result, err := a.Search(context.Background(), AlignRequest{
+		Program:  "blastn",
+		Database: BlastDatabaseGenomes,
+		Query:    ">q1\nACGTACGTACGTACGTACGTACGTACGTAC\n",
+		Params:   BlastParams{MaxTargetSeqs: 10},
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].ContigID != "ctg1" || result.Hits[0].QueryCoverage != 50 {
+		t.Fatalf("hits = %+v", result.Hits)
+	}
+
+	args := readArgs(t, argsFile)
+	for _, want := range []string{"easy-search", "/db/mmseqs/genomes", "--format-output query,target,pident",
+		"--search-type 3", "--max-seqs 10"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q lack %q", args, want)
+		}
+	}
+
+	if err := a.Check("blastp", BlastDatabaseGenes, BlastParams{}); err == nil {
+		t.Error("MMseqs2 blastp without a protein database was accepted")
+	}
+	if err := a.Check("blastn", BlastDatabaseGenomes, BlastParams{Matrix: "BLOSUM62"}); err == nil {
+		t.Error("MMseqs2 accepted a scoring matrix")
+	}
+}
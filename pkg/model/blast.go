@@ -1,21 +1,108 @@
 package model
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"net/url"
-	"os/exec"
-	"regexp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// Target databases a BLAST search can run against.
+const (
+	BlastDatabaseGenes   = "genes"   // Predicted genes; protein or nucleotide depending on the program
+	BlastDatabaseGenomes = "genomes" // Genome assemblies (nucleotide only)
+)
+
+// blastProgram describes the sequence types a BLAST program works with.
+type blastProgram struct {
+	protQuery bool
+	protDB    bool
+}
+
+// blastPrograms are the programs a user may run.
+var blastPrograms = map[string]blastProgram{
+	"blastn":  {protQuery: false, protDB: false},
+	"blastp":  {protQuery: true, protDB: true},
+	"blastx":  {protQuery: false, protDB: true},
+	"tblastn": {protQuery: true, protDB: false},
+	"tblastx": {protQuery: false, protDB: false},
+}
+
 // BlastSearchRequest represents a BLAST request.
 type BlastSearchRequest struct {
 	BlastType string `json:"blast_type"`
+	Database  string `json:"database,omitempty"` // BlastDatabaseGenes (default) or BlastDatabaseGenomes
 	Sequence  string `json:"sequence"`
+	Aligner   string `json:"aligner,omitempty"` // AlignerBLAST (default), AlignerDIAMOND or AlignerMMseqs
+	// CallbackURL is POSTed a signed notification when the job finishes.
+	CallbackURL string `json:"callback_url,omitempty"`
+	BlastParams
+}
+
+// AlignerName returns the aligner the request runs with.
+func (req *BlastSearchRequest) AlignerName() string {
+	if req.Aligner == "" {
+		return AlignerBLAST
+	}
+	return req.Aligner
+}
+
+// Validate checks the program, target database, sequence and parameters, and
+// fills in the default database.
+func (req *BlastSearchRequest) Validate() error {
+	program, ok := blastPrograms[req.BlastType]
+	if !ok {
+		return fmt.Errorf("invalid BLAST type %q", req.BlastType)
+	}
+
+	switch req.Database {
+	case "":
+		req.Database = BlastDatabaseGenes
+	case BlastDatabaseGenes:
+	case BlastDatabaseGenomes:
+		if program.protDB {
+			return fmt.Errorf("%s searches a protein database; the genome database is nucleotide only", req.BlastType)
+		}
+	default:
+		return fmt.Errorf("invalid database %q (use %q or %q)", req.Database, BlastDatabaseGenes, BlastDatabaseGenomes)
+	}
+
+	if !slices.Contains(alignerNames, req.AlignerName()) {
+		return fmt.Errorf("invalid aligner %q (use %s)", req.Aligner, strings.Join(alignerNames, ", "))
+	}
+
+	if strings.TrimSpace(req.Sequence) == "" {
+		return errors.New("sequence cannot be empty")
+	}
+	return req.BlastParams.Validate(req.BlastType)
+}
+
+// BlastDatabases holds the paths of the BLAST databases searches can target.
+type BlastDatabases struct {
+	Prot   string // Gene protein sequences
+	Nucl   string // Gene nucleotide sequences
+	Genome string // Genome assemblies
+}
+
+// Path returns the database blastType searches when the user picked database.
+func (dbs BlastDatabases) Path(blastType, database string) (string, error) {
+	program, ok := blastPrograms[blastType]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("unsupported BLAST type %q", blastType)
+	case database == BlastDatabaseGenomes && !program.protDB:
+		return dbs.Genome, nil
+	case database == BlastDatabaseGenomes:
+		return "", fmt.Errorf("%s cannot search the genome database", blastType)
+	case program.protDB:
+		return dbs.Prot, nil
+	default:
+		return dbs.Nucl, nil
+	}
 }
 
 // cleanFasta validates and cleans the input FASTA string.
@@ -38,163 +125,75 @@ func cleanFasta(inputFasta string) (string, error) {
 }
 
 // runBLASTCommand executes a BLAST command with the given parameters and input FASTA.
-func runBLASTCommand(cmdName, db string, inputFasta string) (string, error) {
-	cleanedFasta, err := cleanFasta(inputFasta)
+// BLAST writes its archive (-outfmt 11), which blast_formatter turns into the
+// tabular output parsed into the result; the archive is kept in the result.
+// numThreads is passed as -num_threads when greater than one. The processes are
+// killed when ctx is done.
+func runBLASTCommand(ctx context.Context, cmdName, db string, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	cleanedFasta, queries, err := prepareQuery(inputFasta)
 	if err != nil {
-		return "", fmt.Errorf("failed to clean FASTA: %w", err)
+		return nil, err
+	}
+	// The parameters become command-line flags, so they are checked here
+	// whatever the caller did.
+	if err := params.Validate(cmdName); err != nil {
+		return nil, err
 	}
 
-	// Shows 500 alignments, that should be enough. Also, max_seq is already at 500
-	cmd := exec.Command(cmdName, "-db", db, "-html", "-num_descriptions", "500", "-num_alignments", "500")
-	cmd.Stdin = bytes.NewBufferString(cleanedFasta)
-
-	var out bytes.Buffer
-	cmd.Stdout = &out
+	dir, err := os.MkdirTemp("", "ggtable-blast-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "result.asn")
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to execute %s: %w", cmdName, err)
+	args := append([]string{"-db", db, "-outfmt", "11", "-out", archivePath}, params.args(cmdName)...)
+	if numThreads > 1 {
+		args = append(args, "-num_threads", strconv.Itoa(numThreads))
+	}
+	if _, err := runSearchProcess(ctx, cmdName, args, cleanedFasta); err != nil {
+		return nil, err
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no archive: %w", cmdName, err)
 	}
 
-	result, err := parseAndAddLink(&out)
+	out, err := runSearchProcess(ctx, blastFormatterCommand, []string{"-archive", archivePath, "-outfmt", blastOutfmt}, "")
+	if err != nil {
+		return nil, err
+	}
+	result, err := ParseBlastTabular(out)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse BLAST output: %w", err)
+		return nil, fmt.Errorf("failed to parse BLAST output: %w", err)
 	}
+	result.Queries = queries
+	result.Archive = archive
 
-	return result.String(), nil
+	return result, nil
 }
 
-// BLASTP runs a BLASTP search and returns the processed output.
-func BLASTP(AADB, inputFasta string) (string, error) {
-	return runBLASTCommand("blastp", AADB, inputFasta)
+// BLASTP runs a BLASTP search and returns its hits.
+func BLASTP(ctx context.Context, AADB, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	return runBLASTCommand(ctx, "blastp", AADB, inputFasta, params, numThreads)
 }
 
-// BLASTN runs a BLASTN search and returns the processed output.
-func BLASTN(NCDB, inputFasta string) (string, error) {
-	return runBLASTCommand("blastn", NCDB, inputFasta)
+// BLASTN runs a BLASTN search and returns its hits.
+func BLASTN(ctx context.Context, NCDB, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	return runBLASTCommand(ctx, "blastn", NCDB, inputFasta, params, numThreads)
 }
 
-// Define the states for our parser
-type ParseState int
-
-const (
-	StateHeader ParseState = iota
-	StateTOC
-	StateAlignments
-	StateFooter
-)
-
-func parseAndAddLink(htmlContent *bytes.Buffer) (*bytes.Buffer, error) {
-	var output bytes.Buffer
-	reader := bufio.NewReader(htmlContent)
-
-	// 1. Define your separator here
-	sep := "//"
-	// Escape the separator for use in Regex (crucial if you use characters like '.', '*', or '|')
-	escSep := regexp.QuoteMeta(sep)
-
-	genomeid_lookup := MAP_HEADER
-
-	// 2. Dynamic Regex construction using the separator
-	// tocRegex: captures genomeID, contig, and gene separated by your delimiter
-	tocRegex := regexp.MustCompile(fmt.Sprintf(`^(\S+)%s(\S+)%s(\S+)`, escSep, escSep))
-
-	// alignHeaderRegex: handles the BLAST HTML anchor tags followed by the delimited ID
-	alignHeaderRegex := regexp.MustCompile(fmt.Sprintf(`^(>.*?<a.*?></a>\s)(\S+)%s(\S+)%s(\S+)$`, escSep, escSep))
-
-	spaceDetection := regexp.MustCompile(`\s{2,}`)
-
-	state := StateHeader
-
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-
-		cleanLine := strings.TrimSuffix(line, "\n")
-
-		switch state {
-		case StateHeader:
-			if strings.HasSuffix(cleanLine, "Score  E") {
-				newline := fmt.Sprintf("%-90s %-10s %-5s", " ", "Score", "E")
-				output.WriteString(newline + "\n")
-			} else if strings.HasPrefix(cleanLine, "Sequences producing significant alignments:") {
-				state = StateTOC
-				newline := fmt.Sprintf("%-90s %-10s %-5s", "Sequences producing significant alignments:", "(Bits)", "Value")
-				output.WriteString(newline + "\n")
-			} else {
-				output.WriteString(cleanLine + "\n")
-			}
-
-		case StateTOC:
-			if strings.HasPrefix(strings.TrimSpace(cleanLine), ">") {
-				state = StateAlignments
-				// Pass the separator to the helper
-				processAlignmentLine(&output, cleanLine, alignHeaderRegex, genomeid_lookup, sep)
-			} else {
-				matches := tocRegex.FindStringSubmatch(cleanLine)
-				if len(matches) == 4 {
-					genomeID, contig, gene := matches[1], matches[2], matches[3]
-
-					if genomeName, ok := genomeid_lookup[genomeID]; ok {
-						// 3. Reconstruct using the variable
-						replacement := fmt.Sprintf("%s-%s%s%s%s%s", genomeName, genomeID, sep, contig, sep, gene)
-						parts := spaceDetection.Split(cleanLine, 3)
-
-						if len(parts) >= 3 {
-							newline := fmt.Sprintf("%-90s %-10s %-5s", replacement, parts[1], parts[2])
-							output.WriteString(newline + "\n")
-							continue
-						}
-					}
-				}
-				output.WriteString(cleanLine + "\n")
-			}
-
-		case StateAlignments:
-			if strings.HasPrefix(cleanLine, "  Database:") || strings.HasPrefix(strings.TrimSpace(cleanLine), "Lambda") {
-				state = StateFooter
-				output.WriteString(cleanLine + "\n")
-			} else if strings.HasPrefix(strings.TrimSpace(cleanLine), ">") {
-				processAlignmentLine(&output, cleanLine, alignHeaderRegex, genomeid_lookup, sep)
-			} else {
-				output.WriteString(cleanLine + "\n")
-			}
-
-		case StateFooter:
-			output.WriteString(cleanLine + "\n")
-		}
-
-		if err == io.EOF {
-			break
-		}
-	}
+// BLASTX searches a protein database with a translated nucleotide query.
+func BLASTX(ctx context.Context, AADB, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	return runBLASTCommand(ctx, "blastx", AADB, inputFasta, params, numThreads)
+}
 
-	return &output, nil
+// TBLASTN searches a translated nucleotide database with a protein query.
+func TBLASTN(ctx context.Context, NCDB, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	return runBLASTCommand(ctx, "tblastn", NCDB, inputFasta, params, numThreads)
 }
 
-// Added sep string parameter here
-func processAlignmentLine(output *bytes.Buffer, line string, regex *regexp.Regexp, lookup map[string]string, sep string) {
-	matches := regex.FindStringSubmatch(line)
-	if len(matches) == 5 {
-		prefix := matches[1]
-		genomeID := matches[2]
-		contig := matches[3]
-		gene := matches[4]
-
-		if genomeName, ok := lookup[genomeID]; ok {
-			// 4. Use variable for reconstruction
-			replacement := fmt.Sprintf("%s-%s%s%s%s%s", genomeName, genomeID, sep, contig, sep, gene)
-			link := fmt.Sprintf("/cluster/heatmap/%s/%s/%s",
-				url.PathEscape(genomeID),
-				url.PathEscape(contig),
-				url.PathEscape(gene),
-			)
-			linkHTML := fmt.Sprintf("<a href=\"%s\">View in gene table</a>", link)
-
-			output.WriteString(fmt.Sprintf("%s%s %s\n", prefix, replacement, linkHTML))
-			return
-		}
-	}
-	output.WriteString(line + "\n")
+// TBLASTX searches a translated nucleotide database with a translated nucleotide query.
+func TBLASTX(ctx context.Context, NCDB, inputFasta string, params BlastParams, numThreads int) (*BlastResult, error) {
+	return runBLASTCommand(ctx, "tblastx", NCDB, inputFasta, params, numThreads)
 }
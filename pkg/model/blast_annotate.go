@@ -0,0 +1,176 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// blastAnnotateChunk bounds the number of hits per overlap query.
+const blastAnnotateChunk = 300
+
+// BlastHitAnnotation places a genome database hit among the annotated genes
+// and cluster regions of its contig.
+type BlastHitAnnotation struct {
+	Genes      []BlastOverlapGene   `json:"genes"`       // Genes the hit overlaps, by position
+	Regions    []BlastOverlapRegion `json:"regions"`     // Cluster regions the hit overlaps, by position
+	ClusterIDs []string             `json:"cluster_ids"` // Clusters of those genes and regions
+	Intergenic bool                 `json:"intergenic"`  // The hit overlaps no annotated gene
+}
+
+// BlastOverlapGene is an annotated gene overlapped by a hit.
+type BlastOverlapGene struct {
+	GeneID      string   `json:"gene_id"`
+	Description string   `json:"description,omitempty"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	Overlap     int      `json:"overlap"` // Bases shared with the hit
+	ClusterIDs  []string `json:"cluster_ids"`
+}
+
+// BlastOverlapRegion is a cluster region (region_matches) overlapped by a hit.
+type BlastOverlapRegion struct {
+	ClusterID string `json:"cluster_id"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Overlap   int    `json:"overlap"`
+}
+
+// AnnotateGenomeHits sets the Annotation of every genome database hit (a hit
+// with a contig but no gene) from the genes and cluster regions it overlaps.
+// gene_info has no contig column, so genes are placed on contigs through
+// gene_matches; a gene outside every cluster is not seen and its hits count
+// as intergenic.
+func AnnotateGenomeHits(db *sql.DB, hits []BlastHit) error {
+	var idx []int
+	for i := range hits {
+		if hits[i].GeneID == "" && hits[i].ContigID != "" {
+			hits[i].Annotation = &BlastHitAnnotation{Genes: []BlastOverlapGene{}, Regions: []BlastOverlapRegion{}, ClusterIDs: []string{}}
+			idx = append(idx, i)
+		}
+	}
+
+	for start := 0; start < len(idx); start += blastAnnotateChunk {
+		chunk := idx[start:min(start+blastAnnotateChunk, len(idx))]
+		if err := annotateHitChunk(db, hits, chunk); err != nil {
+			// Leave no half-made annotations behind.
+			for _, i := range idx {
+				hits[i].Annotation = nil
+			}
+			return err
+		}
+	}
+
+	for _, i := range idx {
+		a := hits[i].Annotation
+		sort.Slice(a.Genes, func(x, y int) bool { return a.Genes[x].Start < a.Genes[y].Start })
+		sort.Slice(a.Regions, func(x, y int) bool { return a.Regions[x].Start < a.Regions[y].Start })
+		seen := make(map[string]bool)
+		for _, g := range a.Genes {
+			for _, id := range g.ClusterIDs {
+				seen[id] = true
+			}
+		}
+		for _, r := range a.Regions {
+			seen[r.ClusterID] = true
+		}
+		for id := range seen {
+			a.ClusterIDs = append(a.ClusterIDs, id)
+		}
+		sort.Strings(a.ClusterIDs)
+		a.Intergenic = len(a.Genes) == 0
+	}
+	return nil
+}
+
+// GenomeHitsAnnotated reports whether every genome database hit has its Annotation.
+func GenomeHitsAnnotated(hits []BlastHit) bool {
+	for _, hit := range hits {
+		if hit.GeneID == "" && hit.ContigID != "" && hit.Annotation == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// annotateHitChunk looks up the genes and regions overlapping hits[i] for each
+// i in chunk. Coordinates are compared with start and end in either order, as
+// both hits and genes on the minus strand may run backwards.
+func annotateHitChunk(db *sql.DB, hits []BlastHit, chunk []int) error {
+	ctx := context.TODO()
+
+	args := make([]interface{}, 0, 5*len(chunk))
+	for _, i := range chunk {
+		hit := hits[i]
+		args = append(args, i, hit.GenomeID, hit.ContigID,
+			min(hit.SubjectStart, hit.SubjectEnd), max(hit.SubjectStart, hit.SubjectEnd))
+	}
+	hitsCTE := `WITH hit_spans(idx, genome_id, contig_id, hit_start, hit_end) AS (VALUES ` +
+		strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?),", len(chunk)), ",") + `)`
+
+	geneQ := hitsCTE + `
+		SELECT h.idx, gi.gene_id, COALESCE(gi.description, ''),
+			MIN(gi.start_location, gi.end_location), MAX(gi.start_location, gi.end_location),
+			MIN(h.hit_end, MAX(gi.start_location, gi.end_location)) - MAX(h.hit_start, MIN(gi.start_location, gi.end_location)) + 1,
+			gm.cluster_id
+		FROM hit_spans h
+		JOIN gene_matches gm ON gm.genome_id = h.genome_id AND gm.contig_id = h.contig_id
+		JOIN gene_info gi ON gi.genome_id = gm.genome_id AND gi.gene_id = gm.gene_id
+		WHERE MIN(gi.start_location, gi.end_location) <= h.hit_end
+			AND MAX(gi.start_location, gi.end_location) >= h.hit_start
+		ORDER BY h.idx, gi.gene_id, gm.cluster_id
+	`
+	rows, err := db.QueryContext(ctx, geneQ, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var i int
+		var g BlastOverlapGene
+		var clusterID string
+		if err := rows.Scan(&i, &g.GeneID, &g.Description, &g.Start, &g.End, &g.Overlap, &clusterID); err != nil {
+			rows.Close()
+			return err
+		}
+		a := hits[i].Annotation
+		// A gene in several clusters comes back once per cluster.
+		if n := len(a.Genes); n > 0 && a.Genes[n-1].GeneID == g.GeneID {
+			a.Genes[n-1].ClusterIDs = append(a.Genes[n-1].ClusterIDs, clusterID)
+			continue
+		}
+		g.ClusterIDs = []string{clusterID}
+		a.Genes = append(a.Genes, g)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	regionQ := hitsCTE + `
+		SELECT h.idx, rm.cluster_id,
+			MIN(rm.start_location, rm.end_location), MAX(rm.start_location, rm.end_location),
+			MIN(h.hit_end, MAX(rm.start_location, rm.end_location)) - MAX(h.hit_start, MIN(rm.start_location, rm.end_location)) + 1
+		FROM hit_spans h
+		JOIN region_matches rm ON rm.genome_id = h.genome_id AND rm.contig_id = h.contig_id
+		WHERE MIN(rm.start_location, rm.end_location) <= h.hit_end
+			AND MAX(rm.start_location, rm.end_location) >= h.hit_start
+	`
+	rows, err = db.QueryContext(ctx, regionQ, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i int
+		var r BlastOverlapRegion
+		if err := rows.Scan(&i, &r.ClusterID, &r.Start, &r.End, &r.Overlap); err != nil {
+			return err
+		}
+		hits[i].Annotation.Regions = append(hits[i].Annotation.Regions, r)
+	}
+	return rows.Err()
+}
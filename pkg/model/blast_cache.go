@@ -0,0 +1,85 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BlastCacheKey identifies a search by everything that decides its result: the
+// program, aligner, target database, query and parameters, and the files of the
+// database at dbPath, so rebuilding the database invalidates earlier results.
+// req must have been validated.
+func BlastCacheKey(req BlastSearchRequest, dbPath string) (string, error) {
+	version, err := blastDatabaseVersion(dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(struct {
+		Program  string      `json:"program"`
+		Database string      `json:"database"`
+		Query    string      `json:"query"`
+		Params   BlastParams `json:"params"`
+		Version  string      `json:"db_version"`
+		Aligner  string      `json:"aligner"`
+	}{req.BlastType, req.Database, normalizeBlastQuery(req.Sequence), req.BlastParams, version, req.AlignerName()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// normalizeBlastQuery rewrites a FASTA query so that line wrapping, blank lines,
+// spacing and letter case do not change the cache key. Headers are kept since
+// query IDs show up in the result.
+func normalizeBlastQuery(fasta string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(fasta, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ">"):
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(">" + strings.Join(strings.Fields(line[1:]), " ") + "\n")
+		default:
+			b.WriteString(strings.ToUpper(strings.Join(strings.Fields(line), "")))
+		}
+	}
+	return b.String()
+}
+
+// blastDatabaseVersion fingerprints the files of a BLAST database (path.pin,
+// path.00.nsq, ...) by name, size and modification time. Single-file databases
+// such as DIAMOND's path.dmnd count path itself.
+func blastDatabaseVersion(path string) (string, error) {
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no BLAST database files found for %s", path)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\t%d\t%d\n", filepath.Base(f), info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlastCacheKey(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "nucl")
+	for _, ext := range []string{".nin", ".nhr", ".nsq"} {
+		if err := os.WriteFile(dbPath+ext, []byte("db"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := func(req BlastSearchRequest) string {
+		t.Helper()
+		k, err := BlastCacheKey(req, dbPath)
+		if err != nil {
+			t.Fatalf("BlastCacheKey: %v", err)
+		}
+		return k
+	}
+
+	base := key(BlastSearchRequest{BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGT\nAAAA\n"})
+	same := key(BlastSearchRequest{BlastType: "blastn", Database: "genes", Sequence: "  >q1   example\r\nacgt acgt aaaa\n\n"})
+	if base != same {
+		t.Errorf("wrapping, case and spacing should not change the key")
+	}
+	if key(BlastSearchRequest{BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAA", Aligner: AlignerBLAST}) != base {
+		t.Errorf("naming the default aligner should not change the key")
+	}
+
+	for name, req := range map[string]BlastSearchRequest{
+		"program":  {BlastType: "tblastx", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAA"},
+		"query ID": {BlastType: "blastn", Database: "genes", Sequence: ">q2 example\nACGTACGTAAAA"},
+		"sequence": {BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAT"},
+		"params":   {BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAA", BlastParams: BlastParams{EValue: 1e-5}},
+		"aligner":  {BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAA", Aligner: AlignerMMseqs},
+	} {
+		if key(req) == base {
+			t.Errorf("a different %s should change the key", name)
+		}
+	}
+
+	// Rebuilding the database invalidates the key.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(dbPath+".nsq", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if key(BlastSearchRequest{BlastType: "blastn", Database: "genes", Sequence: ">q1 example\nACGTACGTAAAA"}) == base {
+		t.Errorf("a modified database should change the key")
+	}
+
+	if _, err := BlastCacheKey(BlastSearchRequest{BlastType: "blastn"}, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected an error for a missing database")
+	}
+}
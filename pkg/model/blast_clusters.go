@@ -0,0 +1,134 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// blastClusterLookupChunk bounds the number of (genome, gene) pairs per query.
+const blastClusterLookupChunk = 400
+
+// BlastClusterHit summarises the BLAST hits that fall into one gene cluster.
+type BlastClusterHit struct {
+	ClusterID    string  `json:"cluster_id"`
+	HitCount     int     `json:"hit_count"` // Hits on member genes, across all genomes
+	BestIdentity float64 `json:"best_identity"`
+	BestBitScore float64 `json:"best_bitscore"`
+	BestEValue   float64 `json:"best_evalue"`
+	// GenomeIdentity is the best identity of a hit in each genome.
+	GenomeIdentity map[string]float64 `json:"genome_best_identity"`
+	// GeneIdentity is the best identity per hit gene, keyed by BlastGeneKey.
+	GeneIdentity map[string]float64 `json:"-"`
+}
+
+// BlastGeneKey identifies a gene across genomes. gene_matches is keyed by
+// genome and gene, so the contig is not part of the key.
+func BlastGeneKey(genomeID, geneID string) string {
+	return genomeID + "//" + geneID
+}
+
+// MapBlastHitsToClusters resolves gene hits to their clusters through gene_matches.
+// Hits without a gene (genome database hits) and genes outside any cluster are
+// skipped. The result is ordered by best bit score, strongest first.
+func MapBlastHitsToClusters(db *sql.DB, hits []BlastHit) ([]*BlastClusterHit, error) {
+	// Distinct genes, in hit order.
+	var genes [][2]string
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		if hit.GeneID == "" {
+			continue
+		}
+		key := BlastGeneKey(hit.GenomeID, hit.GeneID)
+		if !seen[key] {
+			seen[key] = true
+			genes = append(genes, [2]string{hit.GenomeID, hit.GeneID})
+		}
+	}
+
+	clustersOf, err := lookupGeneClusters(db, genes)
+	if err != nil {
+		return nil, err
+	}
+
+	byCluster := make(map[string]*BlastClusterHit)
+	for _, hit := range hits {
+		if hit.GeneID == "" {
+			continue
+		}
+		geneKey := BlastGeneKey(hit.GenomeID, hit.GeneID)
+		for _, clusterID := range clustersOf[geneKey] {
+			ch, ok := byCluster[clusterID]
+			if !ok {
+				ch = &BlastClusterHit{
+					ClusterID:      clusterID,
+					BestEValue:     hit.EValue,
+					GenomeIdentity: make(map[string]float64),
+					GeneIdentity:   make(map[string]float64),
+				}
+				byCluster[clusterID] = ch
+			}
+			ch.HitCount++
+			ch.BestIdentity = max(ch.BestIdentity, hit.Identity)
+			ch.BestBitScore = max(ch.BestBitScore, hit.BitScore)
+			ch.BestEValue = min(ch.BestEValue, hit.EValue)
+			ch.GenomeIdentity[hit.GenomeID] = max(ch.GenomeIdentity[hit.GenomeID], hit.Identity)
+			ch.GeneIdentity[geneKey] = max(ch.GeneIdentity[geneKey], hit.Identity)
+		}
+	}
+
+	out := make([]*BlastClusterHit, 0, len(byCluster))
+	for _, ch := range byCluster {
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].BestBitScore != out[j].BestBitScore {
+			return out[i].BestBitScore > out[j].BestBitScore
+		}
+		return out[i].ClusterID < out[j].ClusterID
+	})
+	return out, nil
+}
+
+// lookupGeneClusters returns the clusters of each (genome, gene) pair, keyed by BlastGeneKey.
+func lookupGeneClusters(db *sql.DB, genes [][2]string) (map[string][]string, error) {
+	ctx := context.TODO()
+
+	clustersOf := make(map[string][]string, len(genes))
+	for start := 0; start < len(genes); start += blastClusterLookupChunk {
+		end := min(start+blastClusterLookupChunk, len(genes))
+		chunk := genes[start:end]
+
+		args := make([]interface{}, 0, 2*len(chunk))
+		for _, g := range chunk {
+			args = append(args, g[0], g[1])
+		}
+		q := `
+			WITH hit_genes(genome_id, gene_id) AS (VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?),", len(chunk)), ",") + `)
+			SELECT DISTINCT gm.genome_id, gm.gene_id, gm.cluster_id
+			FROM hit_genes h
+			JOIN gene_matches gm ON gm.genome_id = h.genome_id AND gm.gene_id = h.gene_id
+		`
+		rows, err := db.QueryContext(ctx, q, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var genomeID, geneID, clusterID string
+			if err := rows.Scan(&genomeID, &geneID, &clusterID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			key := BlastGeneKey(genomeID, geneID)
+			clustersOf[key] = append(clustersOf[key], clusterID)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return clustersOf, nil
+}
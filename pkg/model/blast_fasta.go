@@ -0,0 +1,363 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Molecule types a BLAST query can hold.
+const (
+	MoleculeNucleotide = "nucleotide"
+	MoleculeProtein    = "protein"
+)
+
+// BlastTypeAuto asks for the program to be picked from the query's molecule type.
+const BlastTypeAuto = "auto"
+
+// Default limits on the query of a single search. Longer queries hold up the
+// queue for everyone else.
+const (
+	MaxBlastQueryLength = 100_000   // Residues in one query sequence
+	MaxBlastTotalLength = 1_000_000 // Residues over all query sequences
+)
+
+// maxFastaIssues caps the errors listed for one input; the rest are counted.
+const maxFastaIssues = 20
+
+const (
+	// nucleotideLetters are the bases that mark a sequence as nucleotide when
+	// they make up at least 90% of its letters.
+	nucleotideLetters = "ACGTUN"
+	// nucleotideAlphabet holds the IUPAC nucleotide codes.
+	nucleotideAlphabet = "ACGTURYSWKMBDHVN"
+)
+
+// blastProgramOrder lists the programs in the order they are suggested.
+var blastProgramOrder = []string{"blastn", "blastp", "blastx", "tblastn", "tblastx"}
+
+// BlastQueryLimits are the limits CheckBlastQuery enforces; zero means no limit.
+type BlastQueryLimits struct {
+	MaxQueries     int
+	MaxQueryLength int
+	MaxTotalLength int
+}
+
+// FastaIssue is a problem with a query, tied to an input line where possible.
+type FastaIssue struct {
+	Line    int    `json:"line,omitempty"` // 1-based input line; 0 for the input as a whole
+	QueryID string `json:"query_id,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i FastaIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+	}
+	return i.Message
+}
+
+// BlastQueryCheck is the result of checking a BLAST query before it is queued.
+type BlastQueryCheck struct {
+	Valid        bool         `json:"valid"`
+	MoleculeType string       `json:"molecule_type,omitempty"`
+	BlastType    string       `json:"blast_type,omitempty"`            // Program the search runs
+	Suggested    []string     `json:"suggested_blast_types,omitempty"` // Programs that take this molecule type against the chosen database
+	Queries      []BlastQuery `json:"queries,omitempty"`
+	Errors       []FastaIssue `json:"errors,omitempty"`
+	Warnings     []FastaIssue `json:"warnings,omitempty"`
+	MoreErrors   int          `json:"more_errors,omitempty"` // Errors left out past the first 20
+}
+
+// Err summarizes the first few errors in one message, or returns nil when the
+// query is valid.
+func (c *BlastQueryCheck) Err() error {
+	if len(c.Errors) == 0 {
+		return nil
+	}
+	const shown = 3
+	var msgs []string
+	for i, issue := range c.Errors {
+		if i == shown {
+			msgs = append(msgs, fmt.Sprintf("and %d more problems", len(c.Errors)-shown+c.MoreErrors))
+			break
+		}
+		msgs = append(msgs, issue.String())
+	}
+	return fmt.Errorf("invalid query: %s", strings.Join(msgs, "; "))
+}
+
+func (c *BlastQueryCheck) addError(line int, queryID, format string, args ...interface{}) {
+	if len(c.Errors) >= maxFastaIssues {
+		c.MoreErrors++
+		return
+	}
+	c.Errors = append(c.Errors, FastaIssue{Line: line, QueryID: queryID, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *BlastQueryCheck) addWarning(line int, queryID, format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, FastaIssue{Line: line, QueryID: queryID, Message: fmt.Sprintf(format, args...)})
+}
+
+// CheckBlastQuery checks the query of req before it is queued: that it is
+// FASTA or a bare sequence, that every sequence uses the alphabet of its
+// molecule type and that limits are kept. It detects whether the query is
+// nucleotide or protein and checks that req.BlastType takes that type; an
+// empty or "auto" BlastType is set to the usual program for it (blastn, or
+// blastp and tblastn for protein against genes and genomes; DIAMOND, which
+// searches proteins only, gets blastx or blastp).
+func CheckBlastQuery(req *BlastSearchRequest, limits BlastQueryLimits) *BlastQueryCheck {
+	check := &BlastQueryCheck{}
+	defer func() { check.Valid = len(check.Errors) == 0 }()
+
+	if strings.TrimSpace(req.Sequence) == "" {
+		check.addError(0, "", "enter a query sequence")
+		return check
+	}
+	if line, format := foreignSequenceFormat(req.Sequence); format != "" {
+		check.addError(line, "", "this looks like a %s; paste the sequence in FASTA format instead", format)
+		return check
+	}
+
+	records := scanFasta(req.Sequence)
+	seen := make(map[string]bool)
+	total := 0
+	for _, rec := range records {
+		if seen[rec.ID] {
+			check.addError(rec.HeaderLine, rec.ID, "duplicate query ID %q; give each sequence a unique name", rec.ID)
+		}
+		seen[rec.ID] = true
+		if rec.length() == 0 {
+			check.addError(rec.HeaderLine, rec.ID, "query %s has no sequence", rec.ID)
+		}
+		for _, line := range rec.Lines {
+			if col, r := firstInvalidRune(line.Text); col > 0 {
+				if unicode.IsDigit(r) {
+					check.addError(line.No, rec.ID, "digits are not allowed in a sequence (remove position numbers)")
+				} else {
+					check.addError(line.No, rec.ID, "unexpected character %q in column %d", r, col)
+				}
+			}
+		}
+		if limits.MaxQueryLength > 0 && rec.length() > limits.MaxQueryLength {
+			check.addError(rec.firstLine(), rec.ID, "query %s is %d residues long; at most %d are allowed", rec.ID, rec.length(), limits.MaxQueryLength)
+		}
+		total += rec.length()
+		check.Queries = append(check.Queries, BlastQuery{ID: rec.ID, Length: rec.length()})
+	}
+	if limits.MaxQueries > 0 && len(records) > limits.MaxQueries {
+		check.addError(0, "", "%d query sequences submitted; at most %d are allowed per search", len(records), limits.MaxQueries)
+	}
+	if limits.MaxTotalLength > 0 && total > limits.MaxTotalLength {
+		check.addError(0, "", "the queries total %d residues; at most %d are allowed per search", total, limits.MaxTotalLength)
+	}
+
+	// One program runs every query, so they must all be the same molecule type.
+	var first *fastaRecord
+	for _, rec := range records {
+		molecule := rec.moleculeType()
+		switch {
+		case molecule == "":
+		case first == nil:
+			first = rec
+			check.MoleculeType = molecule
+		case molecule != check.MoleculeType:
+			check.addError(rec.firstLine(), rec.ID, "query %s looks like %s but %s looks like %s; search them separately",
+				rec.ID, molecule, first.ID, check.MoleculeType)
+		}
+		if molecule == MoleculeNucleotide {
+			for _, line := range rec.Lines {
+				if col, r := firstNonNucleotide(line.Text); col > 0 {
+					check.addError(line.No, rec.ID, "%q in column %d is not a nucleotide code", r, col)
+				}
+			}
+		}
+	}
+	if check.MoleculeType == "" {
+		return check
+	}
+
+	protein := check.MoleculeType == MoleculeProtein
+	genomes := req.Database == BlastDatabaseGenomes
+	diamond := req.Aligner == AlignerDIAMOND
+	for _, name := range blastProgramOrder {
+		program := blastPrograms[name]
+		if program.protQuery == protein && !(genomes && program.protDB) && !(diamond && !program.protDB) {
+			check.Suggested = append(check.Suggested, name)
+		}
+	}
+
+	switch program, ok := blastPrograms[req.BlastType]; {
+	case req.BlastType == "" || req.BlastType == BlastTypeAuto:
+		switch {
+		case !protein && diamond:
+			req.BlastType = "blastx"
+		case !protein:
+			req.BlastType = "blastn"
+		case genomes:
+			req.BlastType = "tblastn"
+		default:
+			req.BlastType = "blastp"
+		}
+	case ok && program.protQuery != protein:
+		check.addError(0, "", "%s expects a %s query but this looks like %s; use %s instead",
+			req.BlastType, moleculeName(program.protQuery), check.MoleculeType, strings.Join(check.Suggested, " or "))
+	}
+	check.BlastType = req.BlastType
+
+	// Short queries rarely reach the default word hit thresholds. The short
+	// tasks are BLAST+ only.
+	for _, q := range check.Queries {
+		switch {
+		case req.AlignerName() != AlignerBLAST:
+		case req.BlastType == "blastn" && req.Task == "" && q.Length > 0 && q.Length < 30:
+			check.addWarning(0, q.ID, "query %s is only %d bp; task blastn-short suits primers and other short queries", q.ID, q.Length)
+		case req.BlastType == "blastp" && req.Task == "" && q.Length > 0 && q.Length < 15:
+			check.addWarning(0, q.ID, "query %s is only %d aa; task blastp-short suits peptides", q.ID, q.Length)
+		}
+	}
+	return check
+}
+
+func moleculeName(protein bool) string {
+	if protein {
+		return MoleculeProtein
+	}
+	return MoleculeNucleotide
+}
+
+// foreignSequenceFormat recognizes sequence formats that are often pasted in
+// place of FASTA, returning the line they start on and the format's name.
+func foreignSequenceFormat(input string) (int, string) {
+	for i, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "LOCUS "):
+			return i + 1, "GenBank flat file"
+		case strings.HasPrefix(line, "ID   "):
+			return i + 1, "EMBL flat file"
+		case strings.HasPrefix(line, "@"):
+			return i + 1, "FASTQ file"
+		}
+		return 0, ""
+	}
+	return 0, ""
+}
+
+// firstInvalidRune returns the 1-based column and value of the first rune of a
+// sequence line that is neither a letter, '*', '-' nor whitespace, or 0.
+func firstInvalidRune(line string) (int, rune) {
+	for i, r := range []rune(line) {
+		if !(r < unicode.MaxASCII && unicode.IsLetter(r)) && r != '*' && r != '-' && !unicode.IsSpace(r) {
+			return i + 1, r
+		}
+	}
+	return 0, 0
+}
+
+// firstNonNucleotide returns the 1-based column and value of the first letter
+// of line that is not an IUPAC nucleotide code, or 0.
+func firstNonNucleotide(line string) (int, rune) {
+	for i, r := range []rune(line) {
+		if unicode.IsLetter(r) && !strings.ContainsRune(nucleotideAlphabet, unicode.ToUpper(r)) {
+			return i + 1, r
+		}
+	}
+	return 0, 0
+}
+
+// fastaRecord is one sequence of a FASTA input with the lines it came from.
+type fastaRecord struct {
+	ID         string
+	HeaderLine int // 1-based; 0 for a sequence without a header
+	Lines      []fastaLine
+}
+
+// fastaLine is a sequence line and its 1-based line number.
+type fastaLine struct {
+	No   int
+	Text string
+}
+
+// length counts the residues of the record, ignoring whitespace.
+func (rec *fastaRecord) length() int {
+	n := 0
+	for _, line := range rec.Lines {
+		for _, r := range line.Text {
+			if !unicode.IsSpace(r) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// firstLine is the line issues about the whole record point at.
+func (rec *fastaRecord) firstLine() int {
+	if rec.HeaderLine == 0 && len(rec.Lines) > 0 {
+		return rec.Lines[0].No
+	}
+	return rec.HeaderLine
+}
+
+// moleculeType guesses whether the record is nucleotide or protein from the
+// share of A, C, G, T, U and N among its letters; "" if it has no letters.
+func (rec *fastaRecord) moleculeType() string {
+	letters, bases := 0, 0
+	for _, line := range rec.Lines {
+		for _, r := range line.Text {
+			if r >= unicode.MaxASCII || !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+			if strings.ContainsRune(nucleotideLetters, unicode.ToUpper(r)) {
+				bases++
+			}
+		}
+	}
+	switch {
+	case letters == 0:
+		return ""
+	case bases*10 >= letters*9:
+		return MoleculeNucleotide
+	default:
+		return MoleculeProtein
+	}
+}
+
+// scanFasta splits FASTA input into records. A sequence without a header is
+// named Query_<n> like BLAST+ does, and the lcl| prefix is dropped from IDs.
+func scanFasta(fasta string) []*fastaRecord {
+	var records []*fastaRecord
+	var current *fastaRecord
+	start := func(id string, headerLine int) {
+		if id == "" {
+			id = fmt.Sprintf("Query_%d", len(records)+1)
+		}
+		current = &fastaRecord{ID: strings.TrimPrefix(id, "lcl|"), HeaderLine: headerLine}
+		records = append(records, current)
+	}
+
+	for i, line := range strings.Split(fasta, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ">") {
+			id := ""
+			if fields := strings.Fields(line[1:]); len(fields) > 0 {
+				id = fields[0]
+			}
+			start(id, i+1)
+			continue
+		}
+		if current == nil {
+			start("", 0)
+		}
+		current.Lines = append(current.Lines, fastaLine{No: i + 1, Text: line})
+	}
+	return records
+}
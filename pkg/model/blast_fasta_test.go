@@ -0,0 +1,123 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckBlastQuery_DetectsMoleculeType(t *testing.T) {
+	tests := []struct {
+		sequence, blastType, database string
+		molecule, wantType            string
+	}{
+		{">q\nACGTACGTNNACGTUACGTACGTACGTACGT", "auto", "", MoleculeNucleotide, "blastn"},
+		{">q\nMKVLATGLLLAAAGCSSHEEVKKQ", "", "", MoleculeProtein, "blastp"},
+		{">q\nMKVLATGLLLAAAGCSSHEEVKKQ", "auto", BlastDatabaseGenomes, MoleculeProtein, "tblastn"},
+		{"acgtacgtacgtacgtacgtacgtacgtacgt\nacgt", "tblastx", "", MoleculeNucleotide, "tblastx"},
+	}
+	for _, tt := range tests {
+		req := BlastSearchRequest{BlastType: tt.blastType, Database: tt.database, Sequence: tt.sequence}
+		check := CheckBlastQuery(&req, BlastQueryLimits{})
+		if !check.Valid || check.MoleculeType != tt.molecule || check.BlastType != tt.wantType || req.BlastType != tt.wantType {
+			t.Errorf("%q as %q: got %+v, want %s run with %s", tt.sequence, tt.blastType, check, tt.molecule, tt.wantType)
+		}
+	}
+}
+
+func TestCheckBlastQuery_WrongProgram(t *testing.T) {
+	req := BlastSearchRequest{BlastType: "blastn", Sequence: ">q\nMKVLATGLLLAAAGCSSHEEVKKQ"}
+	check := CheckBlastQuery(&req, BlastQueryLimits{})
+	if check.Valid || len(check.Errors) != 1 {
+		t.Fatalf("protein query accepted by blastn: %+v", check)
+	}
+	if msg := check.Errors[0].Message; !strings.Contains(msg, "use blastp or tblastn") {
+		t.Errorf("error %q does not suggest the protein programs", msg)
+	}
+	if strings.Join(check.Suggested, ",") != "blastp,tblastn" {
+		t.Errorf("suggested = %v", check.Suggested)
+	}
+
+	req = BlastSearchRequest{BlastType: "blastx", Database: BlastDatabaseGenomes, Sequence: ">q\nMKVLATGLLLAAAGCSSHEEVKKQ"}
+	if check := CheckBlastQuery(&req, BlastQueryLimits{}); strings.Join(check.Suggested, ",") != "tblastn" {
+		t.Errorf("suggested against genomes = %v, want only tblastn", check.Suggested)
+	}
+}
+
+func TestCheckBlastQuery_DiamondPicksBlastx(t *testing.T) {
+	req := BlastSearchRequest{BlastType: BlastTypeAuto, Aligner: AlignerDIAMOND, Sequence: ">q\nACGTACGTACGTACGTACGTACGTACGTACGT"}
+	check := CheckBlastQuery(&req, BlastQueryLimits{})
+	if !check.Valid || check.BlastType != "blastx" {
+		t.Fatalf("nucleotide query with DIAMOND: got %+v, want blastx", check)
+	}
+	if strings.Join(check.Suggested, ",") != "blastx" {
+		t.Errorf("suggested = %v, want only blastx", check.Suggested)
+	}
+}
+
+func TestCheckBlastQuery_LineErrors(t *testing.T) {
+	for input, want := range map[string]FastaIssue{
+		">q\nACGTACGT\nACGT1ACG":          {Line: 3, Message: "digits are not allowed"},
+		">q\nMKVL\n\nMK#VL":               {Line: 4, Message: `unexpected character '#' in column 3`},
+		">q\nACGTACGTACGTACGTACGTAECGT":   {Line: 2, Message: `'E' in column 22 is not a nucleotide code`},
+		">a\nMKV\n>a\nMKV":                {Line: 3, Message: `duplicate query ID "a"`},
+		">a\n>b\nMKV":                     {Line: 1, Message: "query a has no sequence"},
+		"LOCUS       AB000001\nORIGIN":    {Line: 1, Message: "GenBank flat file"},
+		"\n@read1\nACGT\n+\nIIII":         {Line: 2, Message: "FASTQ"},
+		">n\nACGTACGTACGT\n>p\nMKVLATHEE": {Line: 3, Message: "query p looks like protein but n looks like nucleotide"},
+		"  \n":                            {Message: "enter a query sequence"},
+	} {
+		req := BlastSearchRequest{BlastType: BlastTypeAuto, Sequence: input}
+		check := CheckBlastQuery(&req, BlastQueryLimits{})
+		if check.Valid || len(check.Errors) == 0 {
+			t.Errorf("%q accepted", input)
+			continue
+		}
+		got := check.Errors[0]
+		if got.Line != want.Line || !strings.Contains(got.Message, want.Message) {
+			t.Errorf("%q: first error %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCheckBlastQuery_Limits(t *testing.T) {
+	limits := BlastQueryLimits{MaxQueries: 2, MaxQueryLength: 10, MaxTotalLength: 15}
+
+	req := BlastSearchRequest{BlastType: "blastp", Sequence: ">a\nMKVLATHEEKQ\n>b\nMKV\n>c\nMKV"}
+	check := CheckBlastQuery(&req, limits)
+	var msgs []string
+	for _, issue := range check.Errors {
+		msgs = append(msgs, issue.String())
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{"line 1: query a is 11 residues long; at most 10", "at most 2 are allowed", "total 17 residues"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("errors %q missing %q", got, want)
+		}
+	}
+
+	// Long lists of errors are capped, and Err summarizes the first few.
+	req = BlastSearchRequest{BlastType: "blastp", Sequence: strings.Repeat(">x\nMKV\n", 30)}
+	check = CheckBlastQuery(&req, BlastQueryLimits{})
+	if len(check.Errors) != maxFastaIssues || check.MoreErrors != 9 {
+		t.Errorf("got %d errors and %d more, want %d and 9", len(check.Errors), check.MoreErrors, maxFastaIssues)
+	}
+	if err := check.Err(); err == nil || !strings.Contains(err.Error(), "and 26 more problems") {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestCheckBlastQuery_ShortQueryWarning(t *testing.T) {
+	req := BlastSearchRequest{BlastType: "blastn", Sequence: "ACGTACGTAC"}
+	check := CheckBlastQuery(&req, BlastQueryLimits{})
+	if !check.Valid || len(check.Warnings) != 1 || !strings.Contains(check.Warnings[0].Message, "blastn-short") {
+		t.Errorf("short query: %+v", check)
+	}
+	if len(check.Queries) != 1 || check.Queries[0] != (BlastQuery{"Query_1", 10}) {
+		t.Errorf("queries = %+v", check.Queries)
+	}
+
+	req.Task = "blastn-short"
+	if check := CheckBlastQuery(&req, BlastQueryLimits{}); len(check.Warnings) != 0 {
+		t.Errorf("warning despite blastn-short: %+v", check.Warnings)
+	}
+}
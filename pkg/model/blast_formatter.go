@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// blastFormatterCommand turns BLAST archives into reports.
+const blastFormatterCommand = "blast_formatter"
+
+// BlastReportFormat is a report that can be downloaded for a BLAST+ search.
+type BlastReportFormat struct {
+	Name        string // As used in download URLs
+	Label       string
+	Outfmt      string // blast_formatter -outfmt; empty for the archive itself
+	ContentType string
+	Extension   string
+}
+
+// BlastReportFormats lists the downloadable reports in the order they are offered.
+var BlastReportFormats = []BlastReportFormat{
+	{Name: "pairwise", Label: "Pairwise text", Outfmt: "0", ContentType: "text/plain; charset=utf-8", Extension: "txt"},
+	{Name: "xml", Label: "BLAST XML", Outfmt: "5", ContentType: "application/xml", Extension: "xml"},
+	{Name: "tabular", Label: "Tabular", Outfmt: "6", ContentType: "text/tab-separated-values; charset=utf-8", Extension: "tsv"},
+	{Name: "json", Label: "BLAST JSON", Outfmt: "15", ContentType: "application/json", Extension: "json"},
+	{Name: "asn", Label: "ASN.1 archive", ContentType: "text/plain; charset=utf-8", Extension: "asn"},
+}
+
+// LookupBlastReportFormat returns the report format called name.
+func LookupBlastReportFormat(name string) (BlastReportFormat, bool) {
+	for _, f := range BlastReportFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return BlastReportFormat{}, false
+}
+
+// FormatBlastArchive produces a report from a BLAST archive with
+// blast_formatter. blast_formatter reads subject sequences from the database
+// the search ran against, so reports are only available while it exists.
+func FormatBlastArchive(ctx context.Context, archive []byte, format BlastReportFormat) ([]byte, error) {
+	if format.Outfmt == "" {
+		return archive, nil
+	}
+
+	dir, err := os.MkdirTemp("", "ggtable-blast-format-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "result.asn")
+	if err := os.WriteFile(archivePath, archive, 0o600); err != nil {
+		return nil, err
+	}
+
+	out, err := runSearchProcess(ctx, blastFormatterCommand, []string{"-archive", archivePath, "-outfmt", format.Outfmt}, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format BLAST archive as %s: %w", format.Name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// ErrBlastFormatterBusy is returned by BlastFormatter.Format when no process
+// slot frees up in time.
+var ErrBlastFormatterBusy = errors.New("all blast_formatter processes are busy")
+
+// BlastFormatter runs FormatBlastArchive for report downloads, with a limit
+// on the blast_formatter processes run at once. A nil BlastFormatter has no
+// limit.
+type BlastFormatter struct {
+	// MaxProcs limits the processes run at once; 0 for no limit. It must not
+	// change once the BlastFormatter is in use.
+	MaxProcs int
+	// Wait is how long a report waits for a free slot before failing with
+	// ErrBlastFormatterBusy; 0 waits as long as its context allows.
+	Wait time.Duration
+
+	procsOnce sync.Once
+	procs     chan struct{}
+}
+
+// Format produces a report like FormatBlastArchive, once a process slot is free.
+func (f *BlastFormatter) Format(ctx context.Context, archive []byte, format BlastReportFormat) ([]byte, error) {
+	if f == nil || format.Outfmt == "" {
+		return FormatBlastArchive(ctx, archive, format)
+	}
+	f.procsOnce.Do(func() {
+		if f.MaxProcs > 0 {
+			f.procs = make(chan struct{}, f.MaxProcs)
+		}
+	})
+	if f.procs != nil {
+		waitCtx := ctx
+		if f.Wait > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, f.Wait)
+			defer cancel()
+		}
+		select {
+		case f.procs <- struct{}{}:
+			defer func() { <-f.procs }()
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrBlastFormatterBusy
+		}
+	}
+	return FormatBlastArchive(ctx, archive, format)
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlastAligner_KeepsArchive(t *testing.T) {
+	blastArgs := fakeAligner(t, "blastp",
+		`while [ $# -gt 0 ]; do [ "$1" = -out ] && out="$2"; shift; done`,
+		`Blast4-archive ::= {}\n`)
+	formatterArgs := fakeAligner(t, "blast_formatter", `out=/dev/stdout`,
+		`q1\tG1//ctg1//G1_0001\t92.5\t40\t3\t0\t1\t40\t5\t44\t1e-20\t80.1\t40\t100\t100\n`)
+
+	a := BlastAligner{DBs: BlastDatabases{Prot: "/db/prot"}}
+	result, err := a.Search(context.Background(), AlignRequest{
+		Program:  "blastp",
+		Database: BlastDatabaseGenes,
+		Query:    ">q1\nMAKLVVTG\n",
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if got := string(result.Archive); got != "Blast4-archive ::= {}\n" {
+		t.Errorf("archive = %q", got)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].GeneID != "G1_0001" {
+		t.Errorf("hits = %+v", result.Hits)
+	}
+	if args := readArgs(t, blastArgs); !strings.Contains(args, "-outfmt 11 -out") {
+		t.Errorf("blastp args = %q", args)
+	}
+	if args := readArgs(t, formatterArgs); !strings.HasPrefix(args, "-archive ") || !strings.Contains(args, "-outfmt 6 ") {
+		t.Errorf("blast_formatter args = %q", args)
+	}
+}
+
+func TestFormatBlastArchive(t *testing.T) {
+	argsFile := fakeAligner(t, "blast_formatter", `out=/dev/stdout`, `<BlastOutput/>`)
+
+	xml, _ := LookupBlastReportFormat("xml")
+	report, err := FormatBlastArchive(context.Background(), []byte("archive"), xml)
+	if err != nil {
+		t.Fatalf("FormatBlastArchive: %v", err)
+	}
+	if string(report) != "<BlastOutput/>" {
+		t.Errorf("report = %q", report)
+	}
+	if args := readArgs(t, argsFile); !strings.HasSuffix(args, "-outfmt 5") {
+		t.Errorf("args = %q", args)
+	}
+
+	asn, _ := LookupBlastReportFormat("asn")
+	if report, err := FormatBlastArchive(context.Background(), []byte("archive"), asn); err != nil || string(report) != "archive" {
+		t.Errorf("asn = %q, %v", report, err)
+	}
+	if _, ok := LookupBlastReportFormat("html"); ok {
+		t.Error("html should not be a report format")
+	}
+}
+
+func TestBlastFormatter_Busy(t *testing.T) {
+	fakeAligner(t, "blast_formatter", `out=/dev/stdout`, `<BlastOutput/>`)
+
+	f := &BlastFormatter{MaxProcs: 1, Wait: 10 * time.Millisecond}
+	xml, _ := LookupBlastReportFormat("xml")
+	if report, err := f.Format(context.Background(), []byte("archive"), xml); err != nil || string(report) != "<BlastOutput/>" {
+		t.Fatalf("Format = %q, %v", report, err)
+	}
+
+	// Hold the only slot, as a running blast_formatter would.
+	f.procs <- struct{}{}
+	if _, err := f.Format(context.Background(), []byte("archive"), xml); !errors.Is(err, ErrBlastFormatterBusy) {
+		t.Errorf("busy Format error = %v, want ErrBlastFormatterBusy", err)
+	}
+	asn, _ := LookupBlastReportFormat("asn")
+	if report, err := f.Format(context.Background(), []byte("archive"), asn); err != nil || string(report) != "archive" {
+		t.Errorf("asn while busy = %q, %v", report, err)
+	}
+	<-f.procs
+
+	var unlimited *BlastFormatter
+	if _, err := unlimited.Format(context.Background(), []byte("archive"), xml); err != nil {
+		t.Errorf("nil BlastFormatter: %v", err)
+	}
+}
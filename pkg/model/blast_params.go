@@ -0,0 +1,192 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxTargetSeqs is the number of hits reported when a request does not set one.
+const DefaultMaxTargetSeqs = 500
+
+// MaxMaxTargetSeqs caps max_target_seqs; reports past this size are unusable in a browser.
+const MaxMaxTargetSeqs = 5000
+
+// BlastParams are the optional search settings a user may change. Zero values
+// leave the BLAST+ default in place. Every field is checked by Validate and
+// formatted by args, so nothing from the request reaches the command line verbatim.
+type BlastParams struct {
+	EValue        float64 `json:"evalue,omitempty"`
+	MaxTargetSeqs int     `json:"max_target_seqs,omitempty"`
+	WordSize      int     `json:"word_size,omitempty"`
+	Matrix        string  `json:"matrix,omitempty"`    // not for blastn
+	GapCosts      string  `json:"gap_costs,omitempty"` // "open,extend", e.g. "11,1"
+	Filter        *bool   `json:"filter,omitempty"`    // low-complexity filter: DUST for blastn, SEG otherwise
+	Task          string  `json:"task,omitempty"`
+}
+
+// blastTasks lists the -task values accepted for each program. tblastx has no -task.
+var blastTasks = map[string][]string{
+	"blastn":  {"blastn", "blastn-short", "megablast", "dc-megablast"},
+	"blastp":  {"blastp", "blastp-short", "blastp-fast"},
+	"blastx":  {"blastx", "blastx-fast"},
+	"tblastn": {"tblastn", "tblastn-fast"},
+	"tblastx": nil,
+}
+
+// proteinGapCosts lists the gap open/extend pairs BLAST+ supports for each
+// scoring matrix. Other pairs make BLAST+ exit with an error.
+var proteinGapCosts = map[string][][2]int{
+	"BLOSUM45": {{13, 3}, {12, 3}, {11, 3}, {10, 3}, {15, 2}, {14, 2}, {13, 2}, {12, 2}, {19, 1}, {18, 1}, {17, 1}, {16, 1}},
+	"BLOSUM50": {{13, 3}, {12, 3}, {11, 3}, {10, 3}, {9, 3}, {16, 2}, {15, 2}, {14, 2}, {13, 2}, {12, 2}, {19, 1}, {18, 1}, {17, 1}, {16, 1}, {15, 1}},
+	"BLOSUM62": {{11, 2}, {10, 2}, {9, 2}, {8, 2}, {7, 2}, {6, 2}, {13, 1}, {12, 1}, {11, 1}, {10, 1}, {9, 1}},
+	"BLOSUM80": {{25, 2}, {13, 2}, {9, 2}, {8, 2}, {7, 2}, {6, 2}, {11, 1}, {10, 1}, {9, 1}},
+	"BLOSUM90": {{9, 2}, {8, 2}, {7, 2}, {6, 2}, {11, 1}, {10, 1}, {9, 1}},
+	"PAM30":    {{7, 2}, {6, 2}, {5, 2}, {10, 1}, {9, 1}, {8, 1}},
+	"PAM70":    {{8, 2}, {7, 2}, {6, 2}, {11, 1}, {10, 1}, {9, 1}},
+	"PAM250":   {{15, 3}, {14, 3}, {13, 3}, {12, 3}, {11, 3}, {17, 2}, {16, 2}, {15, 2}, {14, 2}, {13, 2}, {21, 1}, {20, 1}, {19, 1}, {18, 1}, {17, 1}},
+}
+
+// usesScoringMatrix reports whether blastType aligns protein (or translated)
+// sequences, i.e. uses a scoring matrix and SEG. Only blastn compares nucleotides.
+func usesScoringMatrix(blastType string) bool {
+	return blastType != "blastn"
+}
+
+// Validate checks the parameters against what blastType accepts.
+func (p *BlastParams) Validate(blastType string) error {
+	tasks, ok := blastTasks[blastType]
+	if !ok {
+		return fmt.Errorf("invalid BLAST type %q", blastType)
+	}
+	protein := usesScoringMatrix(blastType)
+
+	if p.EValue < 0 || p.EValue > 1000 {
+		return fmt.Errorf("evalue must be between 0 and 1000, got %g", p.EValue)
+	}
+	if p.MaxTargetSeqs < 0 || p.MaxTargetSeqs > MaxMaxTargetSeqs {
+		return fmt.Errorf("max_target_seqs must be between 1 and %d, got %d", MaxMaxTargetSeqs, p.MaxTargetSeqs)
+	}
+
+	if p.Task != "" && len(tasks) == 0 {
+		return fmt.Errorf("task is not used by %s", blastType)
+	}
+	if p.Task != "" && !containsString(tasks, p.Task) {
+		return fmt.Errorf("task %q is not valid for %s (use one of %s)", p.Task, blastType, strings.Join(tasks, ", "))
+	}
+
+	if p.WordSize != 0 {
+		switch {
+		case protein && (p.WordSize < 2 || p.WordSize > 7):
+			return fmt.Errorf("word_size for %s must be between 2 and 7, got %d", blastType, p.WordSize)
+		case !protein && p.Task == "dc-megablast" && p.WordSize != 11 && p.WordSize != 12:
+			return fmt.Errorf("word_size for dc-megablast must be 11 or 12, got %d", p.WordSize)
+		case !protein && (p.WordSize < 4 || p.WordSize > 128):
+			return fmt.Errorf("word_size for %s must be between 4 and 128, got %d", blastType, p.WordSize)
+		}
+	}
+
+	if p.Matrix != "" {
+		if !protein {
+			return fmt.Errorf("matrix is not used by %s", blastType)
+		}
+		if _, ok := proteinGapCosts[p.Matrix]; !ok {
+			return fmt.Errorf("unknown matrix %q", p.Matrix)
+		}
+	}
+
+	if p.GapCosts != "" {
+		if blastType == "tblastx" {
+			return fmt.Errorf("gap costs are not used by tblastx, which only finds ungapped alignments")
+		}
+		open, extend, err := parseGapCosts(p.GapCosts)
+		if err != nil {
+			return err
+		}
+		if protein {
+			matrix := p.Matrix
+			if matrix == "" {
+				matrix = "BLOSUM62"
+			}
+			if !containsGapCosts(proteinGapCosts[matrix], open, extend) {
+				return fmt.Errorf("gap costs %d,%d are not supported with %s", open, extend, matrix)
+			}
+		}
+	}
+	return nil
+}
+
+// args returns the command-line flags for the parameters. Validate must have
+// passed; only formatted numbers and whitelisted names are emitted.
+func (p *BlastParams) args(blastType string) []string {
+	var args []string
+
+	if p.Task != "" {
+		args = append(args, "-task", p.Task)
+	}
+	if p.EValue > 0 {
+		args = append(args, "-evalue", strconv.FormatFloat(p.EValue, 'g', -1, 64))
+	}
+
+	maxTargets := p.MaxTargetSeqs
+	if maxTargets == 0 {
+		maxTargets = DefaultMaxTargetSeqs
+	}
+	args = append(args, "-max_target_seqs", strconv.Itoa(maxTargets))
+
+	if p.WordSize != 0 {
+		args = append(args, "-word_size", strconv.Itoa(p.WordSize))
+	}
+	if p.Matrix != "" {
+		args = append(args, "-matrix", p.Matrix)
+	}
+	if p.GapCosts != "" {
+		open, extend, _ := parseGapCosts(p.GapCosts)
+		args = append(args, "-gapopen", strconv.Itoa(open), "-gapextend", strconv.Itoa(extend))
+	}
+	if p.Filter != nil {
+		flag := "-dust"
+		if usesScoringMatrix(blastType) {
+			flag = "-seg"
+		}
+		value := "no"
+		if *p.Filter {
+			value = "yes"
+		}
+		args = append(args, flag, value)
+	}
+	return args
+}
+
+// parseGapCosts parses "open,extend".
+func parseGapCosts(s string) (open, extend int, err error) {
+	openStr, extendStr, ok := strings.Cut(s, ",")
+	if ok {
+		open, err = strconv.Atoi(strings.TrimSpace(openStr))
+	}
+	if ok && err == nil {
+		extend, err = strconv.Atoi(strings.TrimSpace(extendStr))
+	}
+	if !ok || err != nil || open < 0 || open > 100 || extend < 0 || extend > 100 {
+		return 0, 0, fmt.Errorf("gap_costs must be \"open,extend\" with small non-negative integers, got %q", s)
+	}
+	return open, extend, nil
+}
+
+func containsGapCosts(pairs [][2]int, open, extend int) bool {
+	for _, pair := range pairs {
+		if pair[0] == open && pair[1] == extend {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlastParamsValidate(t *testing.T) {
+	off := false
+	tests := []struct {
+		name      string
+		blastType string
+		params    BlastParams
+		wantErr   string
+	}{
+		{"defaults", "blastn", BlastParams{}, ""},
+		{"primer search", "blastn", BlastParams{Task: "blastn-short", WordSize: 7, EValue: 1000, Filter: &off}, ""},
+		{"divergent homologs", "blastp", BlastParams{Matrix: "BLOSUM45", GapCosts: "15,2", EValue: 1e-3}, ""},
+		{"default matrix gap costs", "blastp", BlastParams{GapCosts: "11,1"}, ""},
+		{"unknown type", "tblastz", BlastParams{}, "invalid BLAST type"},
+		{"negative evalue", "blastn", BlastParams{EValue: -1}, "evalue"},
+		{"too many targets", "blastp", BlastParams{MaxTargetSeqs: MaxMaxTargetSeqs + 1}, "max_target_seqs"},
+		{"task of other program", "blastp", BlastParams{Task: "megablast"}, "task"},
+		{"shell in task", "blastn", BlastParams{Task: "blastn; rm -rf /"}, "task"},
+		{"protein word size", "blastp", BlastParams{WordSize: 11}, "word_size"},
+		{"dc-megablast word size", "blastn", BlastParams{Task: "dc-megablast", WordSize: 16}, "dc-megablast"},
+		{"matrix for blastn", "blastn", BlastParams{Matrix: "BLOSUM62"}, "matrix is not used"},
+		{"unknown matrix", "blastp", BlastParams{Matrix: "-remote"}, "unknown matrix"},
+		{"unsupported gap costs", "blastp", BlastParams{Matrix: "PAM30", GapCosts: "11,1"}, "not supported with PAM30"},
+		{"malformed gap costs", "blastn", BlastParams{GapCosts: "5"}, "gap_costs"},
+		{"gap costs with flag", "blastn", BlastParams{GapCosts: "5,-remote"}, "gap_costs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate(tt.blastType)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlastParamsArgs(t *testing.T) {
+	on := true
+	tests := []struct {
+		blastType string
+		params    BlastParams
+		want      string
+	}{
+		{"blastn", BlastParams{}, "-max_target_seqs 500"},
+		{"blastn", BlastParams{Task: "blastn-short", EValue: 0.5, MaxTargetSeqs: 50, WordSize: 7, GapCosts: "5,2", Filter: &on},
+			"-task blastn-short -evalue 0.5 -max_target_seqs 50 -word_size 7 -gapopen 5 -gapextend 2 -dust yes"},
+		{"blastp", BlastParams{EValue: 1e-10, Matrix: "PAM70", Filter: new(bool)},
+			"-evalue 1e-10 -max_target_seqs 500 -matrix PAM70 -seg no"},
+	}
+
+	for _, tt := range tests {
+		if err := tt.params.Validate(tt.blastType); err != nil {
+			t.Fatalf("%+v is invalid: %v", tt.params, err)
+		}
+		if got := strings.Join(tt.params.args(tt.blastType), " "); got != tt.want {
+			t.Errorf("args(%s, %+v) = %q, want %q", tt.blastType, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestBlastSearchRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     BlastSearchRequest
+		wantDB  string
+		wantErr string
+	}{
+		{"default database", BlastSearchRequest{BlastType: "blastp", Sequence: "MKV"}, BlastDatabaseGenes, ""},
+		{"tblastn genomes", BlastSearchRequest{BlastType: "tblastn", Database: BlastDatabaseGenomes, Sequence: "MKV"}, BlastDatabaseGenomes, ""},
+		{"tblastx genomes", BlastSearchRequest{BlastType: "tblastx", Database: BlastDatabaseGenomes, Sequence: "ACGT"}, BlastDatabaseGenomes, ""},
+		{"blastx genes", BlastSearchRequest{BlastType: "blastx", Sequence: "ACGT", BlastParams: BlastParams{Task: "blastx-fast"}}, BlastDatabaseGenes, ""},
+		{"blastx genomes", BlastSearchRequest{BlastType: "blastx", Database: BlastDatabaseGenomes, Sequence: "ACGT"}, "", "nucleotide only"},
+		{"unknown database", BlastSearchRequest{BlastType: "blastn", Database: "contigs", Sequence: "ACGT"}, "", "invalid database"},
+		{"unknown program", BlastSearchRequest{BlastType: "psiblast", Sequence: "MKV"}, "", "invalid BLAST type"},
+		{"empty sequence", BlastSearchRequest{BlastType: "blastn", Sequence: " \n"}, "", "empty"},
+		{"tblastx gap costs", BlastSearchRequest{BlastType: "tblastx", Sequence: "ACGT", BlastParams: BlastParams{GapCosts: "11,1"}}, "", "ungapped"},
+		{"tblastx task", BlastSearchRequest{BlastType: "tblastx", Sequence: "ACGT", BlastParams: BlastParams{Task: "tblastx"}}, "", "task is not used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.req.Database != tt.wantDB {
+				t.Errorf("database = %q, want %q", tt.req.Database, tt.wantDB)
+			}
+		})
+	}
+}
+
+func TestBlastDatabasesPath(t *testing.T) {
+	dbs := BlastDatabases{Prot: "prot", Nucl: "nucl", Genome: "genome"}
+	tests := []struct {
+		blastType, database, want string
+	}{
+		{"blastn", BlastDatabaseGenes, "nucl"},
+		{"blastp", BlastDatabaseGenes, "prot"},
+		{"blastx", BlastDatabaseGenes, "prot"},
+		{"tblastn", BlastDatabaseGenes, "nucl"},
+		{"tblastn", BlastDatabaseGenomes, "genome"},
+		{"tblastx", BlastDatabaseGenomes, "genome"},
+	}
+	for _, tt := range tests {
+		got, err := dbs.Path(tt.blastType, tt.database)
+		if err != nil || got != tt.want {
+			t.Errorf("Path(%s, %s) = %q, %v; want %q", tt.blastType, tt.database, got, err, tt.want)
+		}
+	}
+	if _, err := dbs.Path("blastp", BlastDatabaseGenomes); err == nil {
+		t.Errorf("blastp against genomes should fail")
+	}
+}
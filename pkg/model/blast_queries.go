@@ -0,0 +1,121 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BlastQuery is one sequence of a (multi-)FASTA BLAST query.
+type BlastQuery struct {
+	ID     string `json:"id"`     // First word of the header, as BLAST reports it in qseqid
+	Length int    `json:"length"` // Residues
+}
+
+// ParseBlastQueries lists the sequences of a FASTA query in input order.
+// Sequences without a header are named Query_<n> like BLAST+ does. Query IDs
+// must be unique because hits are matched to queries by ID.
+func ParseBlastQueries(fasta string) ([]BlastQuery, error) {
+	records := scanFasta(fasta)
+	if len(records) == 0 {
+		return nil, fmt.Errorf("input FASTA string is empty")
+	}
+
+	queries := make([]BlastQuery, 0, len(records))
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		if seen[rec.ID] {
+			return nil, fmt.Errorf("duplicate query ID %q; give each sequence a unique name", rec.ID)
+		}
+		seen[rec.ID] = true
+		if rec.length() == 0 {
+			return nil, fmt.Errorf("query %s has no sequence", rec.ID)
+		}
+		queries = append(queries, BlastQuery{ID: rec.ID, Length: rec.length()})
+	}
+	return queries, nil
+}
+
+// PreviewBlastQuery returns the first query's ID and up to maxResidues of its
+// sequence, for listing a search, and the number of sequences in fasta.
+func PreviewBlastQuery(fasta string, maxResidues int) (preview string, count int) {
+	records := scanFasta(fasta)
+	if len(records) == 0 {
+		return "", 0
+	}
+
+	var seq strings.Builder
+	for _, line := range records[0].Lines {
+		seq.WriteString(strings.Join(strings.Fields(line.Text), ""))
+	}
+	residues := []rune(seq.String())
+	preview = records[0].ID + " " + string(residues[:min(len(residues), maxResidues)])
+	if len(residues) > maxResidues {
+		preview += "…"
+	}
+	return preview, len(records)
+}
+
+// BlastQuerySummary is the per-query overview of a multi-query search.
+type BlastQuerySummary struct {
+	QueryID     string    `json:"query_id"`
+	QueryLength int       `json:"query_length,omitempty"`
+	HitCount    int       `json:"hit_count"`
+	TopHit      *BlastHit `json:"top_hit,omitempty"` // Highest bit score
+	// ClusterIDs are the clusters of the top hit's gene; empty for genome hits.
+	ClusterIDs []string `json:"cluster_ids,omitempty"`
+}
+
+// SummarizeBlastQueries returns one summary per query, in input order. Queries
+// without hits are included; hits on queries missing from result.Queries (jobs
+// stored before queries were recorded) are appended in the order they appear.
+func SummarizeBlastQueries(result *BlastResult) []*BlastQuerySummary {
+	var out []*BlastQuerySummary
+	byID := make(map[string]*BlastQuerySummary)
+	for _, q := range result.Queries {
+		s := &BlastQuerySummary{QueryID: q.ID, QueryLength: q.Length}
+		byID[q.ID] = s
+		out = append(out, s)
+	}
+
+	for i := range result.Hits {
+		hit := &result.Hits[i]
+		s, ok := byID[hit.QueryID]
+		if !ok {
+			s = &BlastQuerySummary{QueryID: hit.QueryID, QueryLength: hit.QueryLength}
+			byID[hit.QueryID] = s
+			out = append(out, s)
+		}
+		s.HitCount++
+		if s.TopHit == nil || hit.BitScore > s.TopHit.BitScore {
+			s.TopHit = hit
+		}
+	}
+	return out
+}
+
+// AssignQueryClusters fills in the clusters of each summary's top gene hit.
+func AssignQueryClusters(db *sql.DB, summaries []*BlastQuerySummary) error {
+	var genes [][2]string
+	for _, s := range summaries {
+		if s.TopHit != nil && s.TopHit.GeneID != "" {
+			genes = append(genes, [2]string{s.TopHit.GenomeID, s.TopHit.GeneID})
+		}
+	}
+	if len(genes) == 0 {
+		return nil
+	}
+
+	clustersOf, err := lookupGeneClusters(db, genes)
+	if err != nil {
+		return err
+	}
+	for _, s := range summaries {
+		if s.TopHit != nil && s.TopHit.GeneID != "" {
+			s.ClusterIDs = clustersOf[BlastGeneKey(s.TopHit.GenomeID, s.TopHit.GeneID)]
+			sort.Strings(s.ClusterIDs)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBlastQueries(t *testing.T) {
+	queries, err := ParseBlastQueries(">lcl|vir1 adhesin\nMKV\nLLA\n\n>vir2\nMK VA\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queries) != 2 || queries[0] != (BlastQuery{"vir1", 6}) || queries[1] != (BlastQuery{"vir2", 4}) {
+		t.Errorf("queries = %+v", queries)
+	}
+
+	queries, err = ParseBlastQueries("ACGT\nACGT")
+	if err != nil || len(queries) != 1 || queries[0] != (BlastQuery{"Query_1", 8}) {
+		t.Errorf("headerless sequence: %+v, %v", queries, err)
+	}
+
+	for input, wantErr := range map[string]string{
+		">a\nMKV\n>a\nMKV": "duplicate query ID",
+		">a\n>b\nMKV":      "query a has no sequence",
+		" \n":              "empty",
+	} {
+		if _, err := ParseBlastQueries(input); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("ParseBlastQueries(%q) error = %v, want one mentioning %q", input, err, wantErr)
+		}
+	}
+}
+
+func TestSummarizeBlastQueries(t *testing.T) {
+	result := &BlastResult{
+		Queries: []BlastQuery{{"q1", 100}, {"q2", 50}, {"q3", 80}},
+		Hits: []BlastHit{
+			{QueryID: "q1", SubjectID: "a", BitScore: 50},
+			{QueryID: "q1", SubjectID: "b", BitScore: 90},
+			{QueryID: "q3", SubjectID: "c", BitScore: 10},
+			{QueryID: "old", SubjectID: "d", BitScore: 10, QueryLength: 30},
+		},
+	}
+
+	got := SummarizeBlastQueries(result)
+	if len(got) != 4 {
+		t.Fatalf("got %d summaries, want 4", len(got))
+	}
+	if got[0].HitCount != 2 || got[0].TopHit.SubjectID != "b" {
+		t.Errorf("q1 summary %+v", got[0])
+	}
+	if got[1].QueryID != "q2" || got[1].HitCount != 0 || got[1].TopHit != nil {
+		t.Errorf("q2 should be listed without hits: %+v", got[1])
+	}
+	if got[3].QueryID != "old" || got[3].QueryLength != 30 {
+		t.Errorf("query missing from the input list not appended: %+v", got[3])
+	}
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// blastOutputColumns are the -outfmt 6 columns requested from BLAST+, in the
+// order ParseBlastTabular reads them.
+var blastOutputColumns = []string{
+	"qseqid", "sseqid", "pident", "length", "mismatch", "gapopen",
+	"qstart", "qend", "sstart", "send", "evalue", "bitscore",
+	"qlen", "slen", "qcovhsp",
+}
+
+// blastOutfmt is the -outfmt argument matching blastOutputColumns.
+var blastOutfmt = "6 " + strings.Join(blastOutputColumns, " ")
+
+// BlastHit is one high-scoring pair from a BLAST search. Subjects in the gene
+// databases are named genome//contig//gene and those in the genome database
+// genome//contig; the parts are split out when the ID has that shape.
+type BlastHit struct {
+	QueryID         string  `json:"query_id"`
+	SubjectID       string  `json:"subject_id"`
+	GenomeID        string  `json:"genome_id,omitempty"`
+	GenomeName      string  `json:"genome_name,omitempty"`
+	ContigID        string  `json:"contig_id,omitempty"`
+	GeneID          string  `json:"gene_id,omitempty"`
+	Identity        float64 `json:"identity"` // Percent identical positions
+	AlignmentLength int     `json:"alignment_length"`
+	Mismatches      int     `json:"mismatches"`
+	GapOpens        int     `json:"gap_opens"`
+	QueryStart      int     `json:"query_start"`
+	QueryEnd        int     `json:"query_end"`
+	SubjectStart    int     `json:"subject_start"`
+	SubjectEnd      int     `json:"subject_end"`
+	EValue          float64 `json:"evalue"`
+	BitScore        float64 `json:"bitscore"`
+	QueryLength     int     `json:"query_length"`
+	SubjectLength   int     `json:"subject_length"`
+	QueryCoverage   float64 `json:"query_coverage"` // Percent of the query covered by this pair
+
+	// Annotation is set on genome database hits when the job completes.
+	Annotation *BlastHitAnnotation `json:"annotation,omitempty"`
+}
+
+// BlastResult is the parsed output of a BLAST search, in BLAST's order
+// (by query, then best hit first).
+type BlastResult struct {
+	Queries []BlastQuery `json:"queries,omitempty"` // Input order; missing for jobs run before multi-query support
+	Hits    []BlastHit   `json:"hits"`
+
+	// Archive is the BLAST archive (-outfmt 11) of BLAST+ searches, from which
+	// FormatBlastArchive produces other reports. It is stored separately.
+	Archive []byte `json:"-"`
+}
+
+// ParseBlastTabular reads -outfmt 6 output with blastOutputColumns.
+func ParseBlastTabular(r io.Reader) (*BlastResult, error) {
+	result := &BlastResult{Hits: []BlastHit{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hit, err := parseBlastHit(strings.Split(line, "\t"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func parseBlastHit(fields []string) (BlastHit, error) {
+	if len(fields) != len(blastOutputColumns) {
+		return BlastHit{}, fmt.Errorf("expected %d columns, got %d", len(blastOutputColumns), len(fields))
+	}
+
+	var (
+		hit      BlastHit
+		firstErr error
+	)
+	num := func(i int) float64 {
+		v, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("column %s: %w", blastOutputColumns[i], err)
+		}
+		return v
+	}
+	integer := func(i int) int {
+		v, err := strconv.Atoi(strings.TrimSpace(fields[i]))
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("column %s: %w", blastOutputColumns[i], err)
+		}
+		return v
+	}
+
+	hit.QueryID = strings.TrimPrefix(fields[0], "lcl|")
+	hit.SubjectID = strings.TrimPrefix(fields[1], "lcl|")
+	hit.Identity = num(2)
+	hit.AlignmentLength = integer(3)
+	hit.Mismatches = integer(4)
+	hit.GapOpens = integer(5)
+	hit.QueryStart = integer(6)
+	hit.QueryEnd = integer(7)
+	hit.SubjectStart = integer(8)
+	hit.SubjectEnd = integer(9)
+	hit.EValue = num(10)
+	hit.BitScore = num(11)
+	hit.QueryLength = integer(12)
+	hit.SubjectLength = integer(13)
+	hit.QueryCoverage = num(14)
+	if firstErr != nil {
+		return BlastHit{}, firstErr
+	}
+
+	parts := strings.Split(hit.SubjectID, "//")
+	switch len(parts) {
+	case 3:
+		hit.GenomeID, hit.ContigID, hit.GeneID = parts[0], parts[1], parts[2]
+	case 2:
+		hit.GenomeID, hit.ContigID = parts[0], parts[1]
+	}
+	if hit.GenomeID != "" {
+		hit.GenomeName = MAP_HEADER[hit.GenomeID]
+	}
+	return hit, nil
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBlastTabular(t *testing.T) {
+	saved := MAP_HEADER
+	MAP_HEADER = map[string]string{"KCB09": "Pythium test"}
+	t.Cleanup(func() { MAP_HEADER = saved })
+
+	out := strings.Join([]string{
+		"# BLASTN 2.15.0+",
+		"q1\tKCB09//ctg1//g0001\t98.50\t200\t3\t0\t1\t200\t51\t250\t1.2e-95\t350\t210\t900\t95",
+		"q1\tlcl|KCB09//ctg7\t81.0\t40\t7\t1\t5\t44\t1000\t961\t0.003\t41.5\t210\t50000\t19",
+		"",
+	}, "\n")
+
+	result, err := ParseBlastTabular(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(result.Hits) != 2 {
+		t.Fatalf("got %d hits, want 2", len(result.Hits))
+	}
+
+	gene := result.Hits[0]
+	if gene.GenomeID != "KCB09" || gene.GenomeName != "Pythium test" || gene.ContigID != "ctg1" || gene.GeneID != "g0001" {
+		t.Errorf("gene hit subject = %+v", gene)
+	}
+	if gene.Identity != 98.5 || gene.AlignmentLength != 200 || gene.EValue != 1.2e-95 || gene.BitScore != 350 || gene.QueryCoverage != 95 {
+		t.Errorf("gene hit scores = %+v", gene)
+	}
+
+	genome := result.Hits[1]
+	if genome.SubjectID != "KCB09//ctg7" || genome.ContigID != "ctg7" || genome.GeneID != "" {
+		t.Errorf("genome hit subject = %+v", genome)
+	}
+	if genome.SubjectStart != 1000 || genome.SubjectEnd != 961 {
+		t.Errorf("minus-strand hit coordinates = %d-%d", genome.SubjectStart, genome.SubjectEnd)
+	}
+}
+
+func TestParseBlastTabular_Errors(t *testing.T) {
+	for name, out := range map[string]string{
+		"missing columns": "q1\tKCB09//ctg1//g1\t98.5\n",
+		"bad number":      "q1\tKCB09//ctg1//g1\tabc\t200\t3\t0\t1\t200\t51\t250\t1e-5\t350\t210\t900\t95\n",
+	} {
+		if _, err := ParseBlastTabular(strings.NewReader(out)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%s: err = %v, want a line 1 error", name, err)
+		}
+	}
+
+	result, err := ParseBlastTabular(strings.NewReader(""))
+	if err != nil || result.Hits == nil || len(result.Hits) != 0 {
+		t.Errorf("empty output = %+v, %v; want no hits", result, err)
+	}
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"testing"
 )
 
@@ -43,7 +44,7 @@ func TestBLASTP(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Call the BLASTP function with the test case inputs
-			result, err := BLASTP(tt.mockDB, tt.inputfasta)
+			result, err := BLASTP(context.Background(), tt.mockDB, tt.inputfasta, BlastParams{}, 1)
 
 			// Check if an error was expected
 			if tt.shouldError {
@@ -52,16 +53,14 @@ func TestBLASTP(t *testing.T) {
 				}
 				return
 			}
+			if err != nil {
+				t.Fatalf("BLASTP failed: %v", err)
+			}
 
-			// Check if the result contains the expected substring
-			if !contains(result, tt.expected) {
-				t.Errorf("Expected result to contain %q, but it didn't. Got: %q", tt.expected, result)
+			// Check that the hits belong to the expected query
+			if len(result.Hits) == 0 || result.Hits[0].QueryID != tt.expected {
+				t.Errorf("Expected hits for query %q, got %+v", tt.expected, result.Hits)
 			}
 		})
 	}
 }
-
-// Helper function to check if a string contains a substring
-func contains(str, substr string) bool {
-	return len(str) >= len(substr) && str[0:len(substr)] == substr
-}
@@ -141,3 +141,16 @@ func getCluster(db *sql.DB, clusterID string) (*Cluster, error) {
 func GetCluster(db *sql.DB, clusterID string) (*Cluster, error) {
 	return getCluster(db, clusterID)
 }
+
+// GetClusters fetches clusters by ID, preserving the order of clusterIDs.
+func GetClusters(db *sql.DB, clusterIDs []string) ([]*Cluster, error) {
+	clusters := make([]*Cluster, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		cl, err := getCluster(db, id)
+		if err != nil {
+			return nil, fmt.Errorf("GetClusters %q: %w", id, err)
+		}
+		clusters = append(clusters, cl)
+	}
+	return clusters, nil
+}
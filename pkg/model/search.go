@@ -55,6 +55,17 @@ func ParseClusterField(field string) ClusterField {
 	}
 }
 
+// MarshalText encodes the field by name so JSON clients see "function" rather than 0.
+func (s ClusterField) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText accepts the field name; unknown names become ClusterFieldTODO.
+func (s *ClusterField) UnmarshalText(text []byte) error {
+	*s = ParseClusterField(string(text))
+	return nil
+}
+
 // Structure for querying
 type ClusterSearchRequest struct {
 	Search_For              string       `json:"search_for"`                 // Term or keyword to search
@@ -141,15 +152,19 @@ func CountSearchRow(db *sql.DB, req ClusterSearchRequest) (int, error) {
 			if err := buildTempGenomeIDs(tx, req.Genome_IDs); err != nil {
 				return err
 			}
+			if err := buildTempRequiredGenomeIDs(tx, req.RequireGenesFromGenomes); err != nil {
+				return err
+			}
 
-			const q = `
+			q := `
 				SELECT COUNT(DISTINCT gm.cluster_id)
 				FROM gene_matches gm
 				WHERE gm.gene_id = ?
 				AND (
 					NOT EXISTS (SELECT 1 FROM temp_genome_ids)
 					OR gm.genome_id IN (SELECT genome_id FROM temp_genome_ids)
-				);
+				)
+				AND ` + requiredGenomesFilter("gm.cluster_id") + `;
 			`
 			if err := tx.QueryRow(q, req.Search_For).Scan(&count); err != nil {
 				return fmt.Errorf("count gene-name unique clusters: %w", err)
@@ -161,7 +176,10 @@ func CountSearchRow(db *sql.DB, req ClusterSearchRequest) (int, error) {
 			if err != nil {
 				return err
 			}
-			sql := `SELECT COUNT(cluster_id) FROM gene_clusters AS gc WHERE (` + where + `)`
+			if err := buildTempRequiredGenomeIDs(tx, req.RequireGenesFromGenomes); err != nil {
+				return err
+			}
+			sql := `SELECT COUNT(cluster_id) FROM gene_clusters AS gc WHERE (` + where + `) AND ` + requiredGenomesFilter("gc.cluster_id")
 			like := "%" + req.Search_For + "%"
 
 			if err := tx.QueryRowContext(ctx, sql, like).Scan(&count); err != nil {
@@ -241,18 +259,23 @@ func mainPageScaffoldUniqueClusters(tx *sql.Tx, req ClusterSearchRequest) error
 	if err := buildTempGenomeIDs(tx, req.Genome_IDs); err != nil {
 		return err
 	}
+	if err := buildTempRequiredGenomeIDs(tx, req.RequireGenesFromGenomes); err != nil {
+		return err
+	}
 
 	const uniqueTpl = `
 		CREATE TEMPORARY TABLE unique_clusters AS
 		SELECT gc.cluster_id, gc.cog_id, gc.expected_length, gc.function_description, gc.representative_gene
 		FROM gene_clusters gc
+		WHERE %s
 		ORDER BY gc.cluster_id
 		LIMIT ? OFFSET ?;
 	`
+	sql := fmt.Sprintf(uniqueTpl, requiredGenomesFilter("gc.cluster_id"))
 	limit := req.Page_Size
 	offset := (req.Page - 1) * req.Page_Size
 
-	if _, err := tx.Exec(uniqueTpl, limit, offset); err != nil {
+	if _, err := tx.Exec(sql, limit, offset); err != nil {
 		return fmt.Errorf("create unique_clusters for main page: %w", err)
 	}
 	return nil
@@ -264,6 +287,9 @@ func geneNameScaffoldUniqueClusters(tx *sql.Tx, req ClusterSearchRequest) error
 	if err := buildTempGenomeIDs(tx, req.Genome_IDs); err != nil {
 		return err
 	}
+	if err := buildTempRequiredGenomeIDs(tx, req.RequireGenesFromGenomes); err != nil {
+		return err
+	}
 
 	geneID := req.Search_For
 
@@ -291,10 +317,11 @@ func geneNameScaffoldUniqueClusters(tx *sql.Tx, req ClusterSearchRequest) error
 		SELECT gc.cluster_id, gc.cog_id, gc.expected_length, gc.function_description, gc.representative_gene
 		FROM gene_clusters gc
 		JOIN matched_clusters mc ON mc.cluster_id = gc.cluster_id
+		WHERE %s
 		ORDER BY %s
 		LIMIT ? OFFSET ?;
 	`
-	sql := fmt.Sprintf(uniqueTpl, orderBy)
+	sql := fmt.Sprintf(uniqueTpl, requiredGenomesFilter("gc.cluster_id"), orderBy+orderDirExpr(req.Order_Dir))
 	limit := req.Page_Size
 	offset := (req.Page - 1) * req.Page_Size
 
@@ -310,6 +337,9 @@ func propScaffoldUniqueClusters(tx *sql.Tx, req ClusterSearchRequest) error {
 	if err := buildTempGenomeIDs(tx, req.Genome_IDs); err != nil {
 		return err
 	}
+	if err := buildTempRequiredGenomeIDs(tx, req.RequireGenesFromGenomes); err != nil {
+		return err
+	}
 
 	// building sql query
 	where, err := whereFilterExpr(req.Search_Field)
@@ -328,11 +358,11 @@ func propScaffoldUniqueClusters(tx *sql.Tx, req ClusterSearchRequest) error {
 		CREATE TEMPORARY TABLE unique_clusters AS
 			SELECT gc.cluster_id, gc.cog_id, gc.expected_length, gc.function_description, gc.representative_gene
 			FROM gene_clusters gc
-			WHERE (%s)
+			WHERE (%s) AND %s
 			ORDER BY %s
 			LIMIT ? OFFSET ?;
 	`
-	sql := fmt.Sprintf(tpl, where, orderBy)
+	sql := fmt.Sprintf(tpl, where, requiredGenomesFilter("gc.cluster_id"), orderBy+orderDirExpr(req.Order_Dir))
 
 	if _, err := tx.Exec(sql, like, limit, offset); err != nil {
 		return fmt.Errorf("create unique_clusters: %w", err)
@@ -363,6 +393,44 @@ func buildTempGenomeIDs(tx *sql.Tx, ids []string) error {
 	return nil
 }
 
+// buildTempRequiredGenomeIDs creates and (optionally) populates temp_required_genome_ids,
+// the genomes that must all contribute at least one gene to a cluster.
+func buildTempRequiredGenomeIDs(tx *sql.Tx, ids []string) error {
+	ddl := `CREATE TEMPORARY TABLE IF NOT EXISTS temp_required_genome_ids (genome_id TEXT);`
+	if _, err := tx.Exec(ddl); err != nil {
+		return fmt.Errorf("create temp_required_genome_ids: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT INTO temp_required_genome_ids (genome_id) VALUES (?);`)
+	if err != nil {
+		return fmt.Errorf("prepare insert required genome_id: %w", err)
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		if _, err := stmt.Exec(id); err != nil {
+			return fmt.Errorf("insert required genome_id %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// requiredGenomesFilter returns a condition on clusterCol that holds when the
+// cluster has genes from every genome in temp_required_genome_ids (or the table is empty).
+func requiredGenomesFilter(clusterCol string) string {
+	return `(
+			NOT EXISTS (SELECT 1 FROM temp_required_genome_ids)
+			OR ` + clusterCol + ` IN (
+				SELECT rgm.cluster_id
+				FROM gene_matches rgm
+				WHERE rgm.genome_id IN (SELECT genome_id FROM temp_required_genome_ids)
+				GROUP BY rgm.cluster_id
+				HAVING COUNT(DISTINCT rgm.genome_id) = (SELECT COUNT(DISTINCT genome_id) FROM temp_required_genome_ids)
+			)
+		)`
+}
+
 // whereFilterExpr returns the SQL WHERE clause for property searches.
 func whereFilterExpr(field ClusterField) (string, error) {
 	switch field {
@@ -393,6 +461,14 @@ func orderByExpr(field ClusterField) (string, error) {
 	}
 }
 
+// orderDirExpr returns the SQL sort direction suffix; anything but "desc" sorts ascending.
+func orderDirExpr(dir string) string {
+	if dir == "desc" {
+		return " DESC"
+	}
+	return " ASC"
+}
+
 /********************************
  * HYDRATION (POPULATING RESULTS)
  ********************************/
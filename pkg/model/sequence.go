@@ -65,7 +65,123 @@ func GetGenomes(db *sql.DB) (map[string]string, error) {
 	return results, nil
 }
 
-func GetGeneSequence(seqdb *ggdb.SequenceDB, req GeneGetRequest) (string, error) {
+// GenomeSummary is a genome with its gene and cluster counts.
+type GenomeSummary struct {
+	GenomeID     string `json:"genome_id"`
+	FullName     string `json:"genome_fullname"`
+	GeneCount    int    `json:"gene_count"`
+	ClusterCount int    `json:"cluster_count"`
+}
+
+// ListGenomes returns every genome in genome_info with the number of clustered
+// genes and distinct clusters it contributes to.
+func ListGenomes(db *sql.DB) ([]*GenomeSummary, error) {
+	ctx := context.TODO()
+
+	const q = `
+		SELECT
+			g.genome_id,
+			g.genome_fullname,
+			COUNT(DISTINCT gm.gene_id),
+			COUNT(DISTINCT gm.cluster_id)
+		FROM genome_info g
+		LEFT JOIN gene_matches gm ON gm.genome_id = g.genome_id
+		GROUP BY g.genome_id, g.genome_fullname
+		ORDER BY g.genome_id;
+	`
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("ListGenomes: query failed: %w", err)
+	}
+	defer rows.Close()
+
+	results := []*GenomeSummary{}
+	for rows.Next() {
+		var gs GenomeSummary
+		if err := rows.Scan(&gs.GenomeID, &gs.FullName, &gs.GeneCount, &gs.ClusterCount); err != nil {
+			return nil, fmt.Errorf("ListGenomes: scan failed: %w", err)
+		}
+		results = append(results, &gs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListGenomes: rows err: %w", err)
+	}
+	return results, nil
+}
+
+// GeneClusterMembership is one cluster a gene belongs to.
+type GeneClusterMembership struct {
+	ClusterID           string  `json:"cluster_id"`
+	CogID               string  `json:"cog_id"`
+	ExpectedLength      string  `json:"expected_length"`
+	FunctionDescription string  `json:"function_description"`
+	Completeness        float64 `json:"completeness"` // Gene length relative to the cluster's expected length (%)
+}
+
+// GeneDetail is a single annotated gene and the clusters it is a member of.
+type GeneDetail struct {
+	GenomeID    string                   `json:"genome_id"`
+	GenomeName  string                   `json:"genome_fullname"`
+	ContigID    string                   `json:"contig_id"`
+	GeneID      string                   `json:"gene_id"`
+	Start       int                      `json:"start"`
+	End         int                      `json:"end"`
+	Length      int                      `json:"length"`
+	Description string                   `json:"description"`
+	Clusters    []*GeneClusterMembership `json:"clusters"`
+}
+
+// GetGene looks up a gene by genome and gene ID. Returns sql.ErrNoRows if the gene is unknown.
+func GetGene(db *sql.DB, genomeID, geneID string) (*GeneDetail, error) {
+	ctx := context.TODO()
+
+	const geneQ = `
+		SELECT gi.genome_id, COALESCE(g.genome_fullname, ''), gi.gene_id,
+			gi.start_location, gi.end_location, gi.gene_length, COALESCE(gi.description, '')
+		FROM gene_info gi
+		LEFT JOIN genome_info g ON g.genome_id = gi.genome_id
+		WHERE gi.genome_id = ? AND gi.gene_id = ?
+		LIMIT 1;
+	`
+	var gd GeneDetail
+	if err := db.QueryRowContext(ctx, geneQ, genomeID, geneID).
+		Scan(&gd.GenomeID, &gd.GenomeName, &gd.GeneID, &gd.Start, &gd.End, &gd.Length, &gd.Description); err != nil {
+		return nil, err // returns sql.ErrNoRows if not found
+	}
+
+	const clusterQ = `
+		SELECT gm.contig_id, gc.cluster_id, COALESCE(gc.cog_id, ''), gc.expected_length,
+			COALESCE(gc.function_description, ''),
+			COALESCE(ROUND(100.0 * ? / gc.expected_length, 2), 0)
+		FROM gene_matches gm
+		JOIN gene_clusters gc ON gc.cluster_id = gm.cluster_id
+		WHERE gm.genome_id = ? AND gm.gene_id = ?
+		ORDER BY gc.cluster_id;
+	`
+	rows, err := db.QueryContext(ctx, clusterQ, gd.Length, genomeID, geneID)
+	if err != nil {
+		return nil, fmt.Errorf("GetGene: cluster query failed: %w", err)
+	}
+	defer rows.Close()
+
+	gd.Clusters = []*GeneClusterMembership{}
+	for rows.Next() {
+		var m GeneClusterMembership
+		var contigID string
+		if err := rows.Scan(&contigID, &m.ClusterID, &m.CogID, &m.ExpectedLength, &m.FunctionDescription, &m.Completeness); err != nil {
+			return nil, fmt.Errorf("GetGene: scan failed: %w", err)
+		}
+		gd.ContigID = contigID
+		gd.Clusters = append(gd.Clusters, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetGene: rows err: %w", err)
+	}
+
+	return &gd, nil
+}
+
+func GetGeneSequence(seqdb ggdb.SequenceStore, req GeneGetRequest) (string, error) {
 
 	raw_response, err := seqdb.GetGeneSequence(req.Genome_ID, req.Contig_ID, req.Gene_ID, req.Is_Prot)
 
@@ -78,7 +194,7 @@ func GetGeneSequence(seqdb *ggdb.SequenceDB, req GeneGetRequest) (string, error)
 	return ret, nil
 }
 
-func GetRegionSequence(seqdb *ggdb.SequenceDB, req RegionGetRequest) (string, error) {
+func GetRegionSequence(seqdb ggdb.SequenceStore, req RegionGetRequest) (string, error) {
 
 	raw_response, err := seqdb.GetRegionSequence(req.Genome_ID, req.Contig_ID, req.Start, req.End)
 
@@ -91,7 +207,7 @@ func GetRegionSequence(seqdb *ggdb.SequenceDB, req RegionGetRequest) (string, er
 	return ret, nil
 }
 
-func GetMultipleGenes(seqdb *ggdb.SequenceDB, req []*GeneGetRequest, is_prot bool) (string, error) {
+func GetMultipleGenes(seqdb ggdb.SequenceStore, req []*GeneGetRequest, is_prot bool) (string, error) {
 
 	geneNames := make([]string, 0, len(req))
 	for _, r := range req {
@@ -109,7 +225,7 @@ func GetMultipleGenes(seqdb *ggdb.SequenceDB, req []*GeneGetRequest, is_prot boo
 	return ret, nil
 }
 
-func GetMultipleRegions(seqdb *ggdb.SequenceDB, req []*RegionGetRequest) (string, error) {
+func GetMultipleRegions(seqdb ggdb.SequenceStore, req []*RegionGetRequest) (string, error) {
 
 	regionNames := make([]string, 0, len(req))
 	for _, r := range req {
@@ -0,0 +1,248 @@
+// Model for fetching many gene/region sequences in one request
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	ggdb "github.com/yumyai/ggtable/pkg/db"
+)
+
+// MaxSequenceBatchEntries caps the number of entries in a single batch request.
+const MaxSequenceBatchEntries = 10000
+
+// MaxSequenceBatchBases caps the total length of the regions in a single
+// batch request.
+const MaxSequenceBatchBases = 50_000_000
+
+// SequenceBatchRequest lists the genes and regions to fetch. Genes may mix
+// protein and nucleotide; regions are always nucleotide.
+type SequenceBatchRequest struct {
+	Genes   []*GeneGetRequest   `json:"genes"`
+	Regions []*RegionGetRequest `json:"regions"`
+}
+
+// Len is the number of entries in the batch.
+func (req *SequenceBatchRequest) Len() int {
+	return len(req.Genes) + len(req.Regions)
+}
+
+// RegionBases is the total length of the regions in the batch.
+func (req *SequenceBatchRequest) RegionBases() uint64 {
+	var total uint64
+	for _, r := range req.Regions {
+		total += r.End - r.Start + 1
+	}
+	return total
+}
+
+// SequenceBatchError reports an entry that could not be parsed or fetched.
+type SequenceBatchError struct {
+	Entry string `json:"entry"`
+	Line  int    `json:"line,omitempty"` // Input line for plain-text requests
+	Error string `json:"error"`
+}
+
+// ParseSequenceBatchText reads one entry per line:
+//
+//	genome//contig//gene          gene, molecule from defaultProt
+//	genome//contig//gene prot     gene, explicit molecule (prot|nucl)
+//	genome//contig:start-end      region (nucleotide)
+//
+// Blank lines and lines starting with '#' are skipped. Unparseable lines are
+// returned as errors rather than failing the whole batch.
+func ParseSequenceBatchText(r io.Reader, defaultProt bool) (*SequenceBatchRequest, []SequenceBatchError, error) {
+	req := &SequenceBatchRequest{}
+	var errs []SequenceBatchError
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		entry := fields[0]
+		parts := strings.Split(entry, "//")
+
+		switch {
+		case len(parts) == 3 && len(fields) <= 2:
+			isProt := defaultProt
+			if len(fields) == 2 {
+				switch strings.ToLower(fields[1]) {
+				case "prot", "protein", "p", "aa":
+					isProt = true
+				case "nucl", "nucleotide", "n", "nt":
+					isProt = false
+				default:
+					errs = append(errs, SequenceBatchError{Entry: line, Line: lineNum, Error: "molecule type must be prot or nucl"})
+					continue
+				}
+			}
+			if parts[0] == "" || parts[1] == "" || parts[2] == "" {
+				errs = append(errs, SequenceBatchError{Entry: line, Line: lineNum, Error: "empty genome, contig or gene ID"})
+				continue
+			}
+			req.Genes = append(req.Genes, &GeneGetRequest{Genome_ID: parts[0], Contig_ID: parts[1], Gene_ID: parts[2], Is_Prot: isProt})
+
+		case len(parts) == 2 && len(fields) == 1:
+			region, err := parseRegionEntry(parts[0], parts[1])
+			if err != nil {
+				errs = append(errs, SequenceBatchError{Entry: line, Line: lineNum, Error: err.Error()})
+				continue
+			}
+			req.Regions = append(req.Regions, region)
+
+		default:
+			errs = append(errs, SequenceBatchError{Entry: line, Line: lineNum, Error: "expected genome//contig//gene or genome//contig:start-end"})
+		}
+
+		if req.Len() > MaxSequenceBatchEntries {
+			return nil, nil, fmt.Errorf("too many entries (maximum %d)", MaxSequenceBatchEntries)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return req, errs, nil
+}
+
+// parseRegionEntry parses the "contig:start-end" half of a region entry.
+func parseRegionEntry(genomeID, contigRange string) (*RegionGetRequest, error) {
+	contigID, rng, ok := strings.Cut(contigRange, ":")
+	if !ok {
+		return nil, fmt.Errorf("region must include a range (contig:start-end)")
+	}
+	startStr, endStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return nil, fmt.Errorf("range must be start-end")
+	}
+	start, errStart := strconv.ParseUint(startStr, 10, 64)
+	end, errEnd := strconv.ParseUint(endStr, 10, 64)
+	if errStart != nil || errEnd != nil || start == 0 || end < start {
+		return nil, fmt.Errorf("invalid range %q", rng)
+	}
+	if genomeID == "" || contigID == "" {
+		return nil, fmt.Errorf("empty genome or contig ID")
+	}
+	return &RegionGetRequest{Genome_ID: genomeID, Contig_ID: contigID, Start: start, End: end}, nil
+}
+
+// ValidateSequenceBatch checks JSON-submitted entries the same way the text parser does.
+func ValidateSequenceBatch(req *SequenceBatchRequest) []SequenceBatchError {
+	var errs []SequenceBatchError
+	genes := req.Genes[:0]
+	for _, g := range req.Genes {
+		if g == nil || g.Genome_ID == "" || g.Contig_ID == "" || g.Gene_ID == "" {
+			errs = append(errs, SequenceBatchError{Entry: geneEntryName(g), Error: "genome_id, contig_id and gene_id are required"})
+			continue
+		}
+		genes = append(genes, g)
+	}
+	req.Genes = genes
+
+	regions := req.Regions[:0]
+	for _, r := range req.Regions {
+		if r == nil || r.Genome_ID == "" || r.Contig_ID == "" || r.Start == 0 || r.End < r.Start {
+			errs = append(errs, SequenceBatchError{Entry: regionEntryName(r), Error: "genome_id, contig_id and a valid start-end range are required"})
+			continue
+		}
+		regions = append(regions, r)
+	}
+	req.Regions = regions
+	return errs
+}
+
+func geneEntryName(g *GeneGetRequest) string {
+	if g == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s//%s//%s", g.Genome_ID, g.Contig_ID, g.Gene_ID)
+}
+
+func regionEntryName(r *RegionGetRequest) string {
+	if r == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s//%s:%d-%d", r.Genome_ID, r.Contig_ID, r.Start, r.End)
+}
+
+// FetchSequenceBatch writes the FASTA for every entry to w, one group at a time
+// (nucleotide genes, protein genes, regions). Entries that are not found are
+// reported instead of failing the batch.
+func FetchSequenceBatch(seqdb ggdb.SequenceStore, req *SequenceBatchRequest, w io.Writer) ([]SequenceBatchError, error) {
+	var (
+		nuclGenes []string
+		protGenes []string
+		regions   []string
+	)
+	for _, g := range req.Genes {
+		if g.Is_Prot {
+			protGenes = append(protGenes, geneEntryName(g))
+		} else {
+			nuclGenes = append(nuclGenes, geneEntryName(g))
+		}
+	}
+	for _, r := range req.Regions {
+		regions = append(regions, regionEntryName(r))
+	}
+
+	groups := []struct {
+		names []string
+		fetch func([]string) ([]byte, error)
+	}{
+		{nuclGenes, func(names []string) ([]byte, error) { return seqdb.GetMultipleGene(names, false) }},
+		{protGenes, func(names []string) ([]byte, error) { return seqdb.GetMultipleGene(names, true) }},
+		{regions, seqdb.GetMultipleRegion},
+	}
+
+	var errs []SequenceBatchError
+	for _, group := range groups {
+		if len(group.names) == 0 {
+			continue
+		}
+		out, groupErrs, err := fetchSequenceGroup(group.names, group.fetch)
+		if err != nil {
+			return errs, err
+		}
+		errs = append(errs, groupErrs...)
+		if len(out) == 0 {
+			continue
+		}
+		if _, err := supplyFastaHeader(out, MAP_HEADER).WriteTo(w); err != nil {
+			return errs, err
+		}
+	}
+	return errs, nil
+}
+
+// fetchSequenceGroup fetches names in one batch and reports the entries
+// whose record did not come back.
+func fetchSequenceGroup(names []string, fetch func([]string) ([]byte, error)) ([]byte, []SequenceBatchError, error) {
+	out, err := fetch(names)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		buf  bytes.Buffer
+		errs []SequenceBatchError
+	)
+	for i, record := range ggdb.MatchFastaRecords(names, out) {
+		if record == nil {
+			errs = append(errs, SequenceBatchError{Entry: names[i], Error: "sequence not found"})
+			continue
+		}
+		buf.Write(record)
+	}
+	return buf.Bytes(), errs, nil
+}
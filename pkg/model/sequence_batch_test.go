@@ -0,0 +1,80 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSequenceBatchText(t *testing.T) {
+	input := strings.Join([]string{
+		"# header comment",
+		"G1//ctg1//gene1",
+		"G1//ctg1//gene2 prot",
+		"",
+		"G2//ctg9:10-20",
+		"G2//ctg9:20-10",
+		"G2//ctg9",
+		"G1//ctg1//gene3 rna",
+	}, "\n")
+
+	req, errs, err := ParseSequenceBatchText(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if len(req.Genes) != 2 || req.Genes[0].Is_Prot || !req.Genes[1].Is_Prot {
+		t.Fatalf("unexpected genes: %+v", req.Genes)
+	}
+	if len(req.Regions) != 1 || req.Regions[0].Start != 10 || req.Regions[0].End != 20 {
+		t.Fatalf("unexpected regions: %+v", req.Regions)
+	}
+
+	wantLines := []int{6, 7, 8}
+	if len(errs) != len(wantLines) {
+		t.Fatalf("expected %d errors, got %+v", len(wantLines), errs)
+	}
+	for i, line := range wantLines {
+		if errs[i].Line != line {
+			t.Errorf("error %d: line %d, want %d", i, errs[i].Line, line)
+		}
+	}
+}
+
+func TestParseSequenceBatchTextDefaultProt(t *testing.T) {
+	req, _, err := ParseSequenceBatchText(strings.NewReader("G1//ctg1//gene1\nG1//ctg1//gene2 nucl\n"), true)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !req.Genes[0].Is_Prot || req.Genes[1].Is_Prot {
+		t.Fatalf("molecule type not applied: %+v", req.Genes)
+	}
+}
+
+func TestFetchSequenceGroupMissingEntry(t *testing.T) {
+	calls := 0
+	fetch := func(names []string) ([]byte, error) {
+		calls++
+		var out strings.Builder
+		for _, name := range names {
+			// Like blastdbcmd, leave out what is missing.
+			if name != "G1//ctg1//gone" {
+				out.WriteString(">" + name + "\nACGT\n")
+			}
+		}
+		return []byte(out.String()), nil
+	}
+
+	out, errs, err := fetchSequenceGroup([]string{"G1//ctg1//gene1", "G1//ctg1//gone", "G1//ctg1//gene2"}, fetch)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want one batch", calls)
+	}
+	if string(out) != ">G1//ctg1//gene1\nACGT\n>G1//ctg1//gene2\nACGT\n" {
+		t.Errorf("unexpected FASTA: %q", out)
+	}
+	if len(errs) != 1 || errs[0].Entry != "G1//ctg1//gone" {
+		t.Errorf("unexpected errors: %+v", errs)
+	}
+}
@@ -1,10 +1,13 @@
 package render
 
 import (
+	"fmt"
+	"html/template"
 	"io"
-	"text/template"
+	"net/url"
 
 	"github.com/yumyai/ggtable/logger"
+	"github.com/yumyai/ggtable/pkg/model"
 	"go.uber.org/zap"
 )
 
@@ -14,13 +17,26 @@ var blast_page_template *template.Template
 type BlastPageData struct {
 	JobID                  string
 	BlastType              string
-	BlastReport            string
+	Database               string
+	Aligner                string                     // model.AlignerBLAST, AlignerDIAMOND or AlignerMMseqs
+	Reused                 bool                       // Answered with the result of an identical earlier search
+	Downloads              []BlastDownload            // Reports derived from the BLAST archive; empty without one
+	Result                 *model.BlastResult         // nil until the job has completed
+	Queries                []*model.BlastQuerySummary // Per query, in input order
+	Overviews              []BlastOverview            // Graphic summary per query with hits
 	Status                 string
+	QueuePosition          int // 1-based position while queued, 0 otherwise
 	ErrorMessage           string
 	ShouldRefresh          bool
 	RefreshIntervalSeconds int
 }
 
+// BlastDownload links to a report of a finished job.
+type BlastDownload struct {
+	Label string
+	URL   string
+}
+
 // init initializes the templates used for rendering the HTML page.
 func init() {
 	mainTmpl := `
@@ -33,32 +49,341 @@ func init() {
             white-space: pre-wrap;
             word-wrap: break-word;
         }
+        .blast-filters { margin: 12px 0; display: flex; gap: 12px; flex-wrap: wrap; align-items: center; }
+        table.blast-hits { border-collapse: collapse; font-size: 13px; }
+        table.blast-hits th, table.blast-hits td { border: 1px solid #d1d5db; padding: 3px 6px; }
+        table.blast-hits th { background: #e5e7eb; cursor: pointer; user-select: none; white-space: nowrap; }
+        table.blast-hits th[data-dir="asc"]::after { content: " \25B2"; }
+        table.blast-hits th[data-dir="desc"]::after { content: " \25BC"; }
+        table.blast-hits td.num { text-align: right; font-variant-numeric: tabular-nums; }
+        table.blast-hits tbody tr:nth-child(even) { background: #f9fafb; }
+        table.blast-queries { border-collapse: collapse; font-size: 13px; margin-bottom: 16px; }
+        table.blast-queries th, table.blast-queries td { border: 1px solid #d1d5db; padding: 3px 6px; }
+        table.blast-queries th { background: #e5e7eb; }
+        table.blast-queries td.num { text-align: right; font-variant-numeric: tabular-nums; }
+        table.blast-hits tbody tr:target { background: #FEF9C3; }
+        .blast-overview { margin: 12px 0; overflow-x: auto; }
+        .blast-overview a.hit-bar { cursor: pointer; }
+        .blast-intergenic { background: #FEF3C7; color: #92400E; padding: 0 4px; border-radius: 3px; }
    		</style>
-		{{ if .ShouldRefresh }}
-        <script>
-	        setTimeout(function () { window.location.reload(); }, {{ mul .RefreshIntervalSeconds 1000 }});
-        </script>
-		{{ end }}
 	</head>
 	<body>
 		<h1>Gene Table V3</h1>
-		<p><strong>Job ID:</strong> {{ .JobID }}</p>
-		<p><strong>BLAST type:</strong> {{ .BlastType}}</p>
-		<p><strong>Status:</strong> {{ .Status }}</p>
+		<p><strong>Job ID:</strong> {{ .JobID }} <a href="/blast">(your BLAST jobs)</a></p>
+		<p><strong>BLAST type:</strong> {{ .BlastType}}{{ if .Database }} against {{ .Database }}{{ end }}{{ if and .Aligner (ne .Aligner "blast") }} using {{ .Aligner }}{{ end }}</p>
+		{{ if .Reused }}
+		<p>An identical search was run recently, so its result is shown without searching again.</p>
+		{{ end }}
+		<p><strong>Status:</strong> <span id="job-status">{{ .Status }}</span><span id="job-queue">{{ if .QueuePosition }} (position {{ .QueuePosition }} in queue){{ end }}</span></p>
+		{{ if .ShouldRefresh }}
+		<form method="post" action="/blast/{{ .JobID }}/cancel" onsubmit="return confirm('Cancel this BLAST search?');">
+			<button type="submit">Cancel search</button>
+		</form>
+		{{ end }}
 		{{ if .ErrorMessage }}
 			<p style="color: red;">{{ .ErrorMessage }}</p>
-		{{ else if .BlastReport }}
-    		<pre>{{ .BlastReport }}</pre>
+		{{ else if .Result }}
+			{{ if and .Result.Hits (eq .Database "genes") }}
+			<p><a href="/blast/{{ .JobID }}/clusters">View hits by cluster</a> (heatmap of the clusters containing the hit genes)</p>
+			{{ end }}
+			{{ if .Downloads }}
+			<p>Download: {{ range $i, $d := .Downloads }}{{ if $i }} | {{ end }}<a href="{{ $d.URL }}">{{ $d.Label }}</a>{{ end }}</p>
+			{{ end }}
+			{{ if gt (len .Queries) 1 }}
+				{{ template "querySummary" . }}
+			{{ end }}
+			{{ template "hitOverview" . }}
+			{{ template "hitTable" . }}
 		{{ else }}
-			<p>Your BLAST search is still running. This page refreshes every {{ .RefreshIntervalSeconds }} seconds.</p>
+			<p><span id="job-waiting">{{ if .QueuePosition }}Your BLAST search is waiting for a free slot.{{ else }}Your BLAST search is still running.{{ end }}</span>
+			This page updates by itself and shows the results when the search finishes.</p>
+		{{ end }}
+		{{ if .ShouldRefresh }}
+		<script>
+		// Follow the job over Server-Sent Events; reload once it has finished to show
+		// the results. Without EventSource, or if the stream fails, poll by reloading.
+		(function () {
+			const finished = ['completed', 'failed', 'cancelled', 'timed_out'];
+			const poll = () => setTimeout(() => window.location.reload(), {{ mul .RefreshIntervalSeconds 1000 }});
+			if (!window.EventSource) {
+				poll();
+				return;
+			}
+			const events = new EventSource('/blast/' + encodeURIComponent({{ .JobID }}) + '/events');
+			events.addEventListener('status', ev => {
+				const job = JSON.parse(ev.data);
+				if (finished.includes(job.status)) {
+					events.close();
+					window.location.reload();
+					return;
+				}
+				document.getElementById('job-status').textContent = job.status;
+				document.getElementById('job-queue').textContent = job.queue_position ? ' (position ' + job.queue_position + ' in queue)' : '';
+				const waiting = document.getElementById('job-waiting');
+				if (waiting) {
+					waiting.textContent = job.queue_position ? 'Your BLAST search is waiting for a free slot.' : 'Your BLAST search is still running.';
+				}
+			});
+			events.onerror = () => {
+				if (events.readyState === EventSource.CLOSED) poll();
+			};
+		})();
+		</script>
 		{{ end }}
 	</body>
 	</html>`
 
+	hitTableTmpl := `
+	{{ define "hitTable" }}
+		{{ if not .Result.Hits }}
+			<p>No hits found.</p>
+		{{ else }}
+		<div class="blast-filters">
+			{{ if gt (len .Queries) 1 }}
+			<label>Query:
+				<select id="hit-query">
+					<option value="">All queries</option>
+					{{ range .Queries }}<option value="{{ .QueryID }}">{{ .QueryID }} ({{ .HitCount }})</option>{{ end }}
+				</select>
+			</label>
+			<button type="button" id="hit-query-prev">&laquo; Previous query</button>
+			<button type="button" id="hit-query-next">Next query &raquo;</button>
+			{{ end }}
+			<label>Filter: <input type="search" id="hit-filter" placeholder="query, genome, contig or gene"></label>
+			<label>Min. identity (%): <input type="number" id="hit-min-identity" min="0" max="100" step="any"></label>
+			<label>Min. query cover (%): <input type="number" id="hit-min-coverage" min="0" max="100" step="any"></label>
+			<label>Max. e-value: <input type="number" id="hit-max-evalue" min="0" step="any"></label>
+			{{ if eq .Database "genomes" }}
+			<label>Location:
+				<select id="hit-location">
+					<option value="">All hits</option>
+					<option value="gene">In annotated genes</option>
+					<option value="intergenic">Intergenic</option>
+				</select>
+			</label>
+			{{ end }}
+			<span id="hit-count">{{ len .Result.Hits }} hits</span>
+		</div>
+		<table class="blast-hits" id="blast-hits">
+			<thead>
+				<tr>
+					<th data-type="text">Query</th>
+					<th data-type="text">Genome</th>
+					<th data-type="text">Subject</th>
+					<th data-type="num">Identity (%)</th>
+					<th data-type="num">Query cover (%)</th>
+					<th data-type="num">Alignment length</th>
+					<th data-type="num">E-value</th>
+					<th data-type="num">Bit score</th>
+					<th data-type="text">Query range</th>
+					<th data-type="text">Subject range</th>
+					{{ if eq .Database "genomes" }}<th data-type="text">Overlapping genes and clusters</th>{{ end }}
+				</tr>
+			</thead>
+			<tbody>
+			{{ range $i, $hit := .Result.Hits }}
+				<tr id="hit-{{ $i }}" data-query="{{ .QueryID }}" data-identity="{{ .Identity }}" data-coverage="{{ .QueryCoverage }}" data-evalue="{{ .EValue }}"{{ with .Annotation }} data-location="{{ if .Intergenic }}intergenic{{ else }}gene{{ end }}"{{ end }}>
+					<td>{{ .QueryID }}</td>
+					<td>{{ if .GenomeName }}{{ .GenomeName }} ({{ .GenomeID }}){{ else }}{{ .GenomeID }}{{ end }}</td>
+					<td>
+						{{ if .GeneID }}<a href="{{ geneHeatmapURL .GenomeID .ContigID .GeneID }}" title="View in gene table">{{ .ContigID }}//{{ .GeneID }}</a>
+						{{ else if .ContigID }}{{ .ContigID }}
+						{{ else }}{{ .SubjectID }}{{ end }}
+					</td>
+					<td class="num" data-value="{{ .Identity }}">{{ printf "%.1f" .Identity }}</td>
+					<td class="num" data-value="{{ .QueryCoverage }}">{{ printf "%.0f" .QueryCoverage }}</td>
+					<td class="num" data-value="{{ .AlignmentLength }}">{{ .AlignmentLength }}</td>
+					<td class="num" data-value="{{ .EValue }}">{{ evalue .EValue }}</td>
+					<td class="num" data-value="{{ .BitScore }}">{{ printf "%.1f" .BitScore }}</td>
+					<td>{{ .QueryStart }}-{{ .QueryEnd }}</td>
+					<td>{{ .SubjectStart }}-{{ .SubjectEnd }}</td>
+					{{ if eq $.Database "genomes" }}<td>{{ with .Annotation }}{{ template "hitAnnotation" . }}{{ end }}</td>{{ end }}
+				</tr>
+			{{ end }}
+			</tbody>
+		</table>
+		<script>
+		(function () {
+			const table = document.getElementById('blast-hits');
+			const tbody = table.tBodies[0];
+			const rows = Array.from(tbody.rows);
+			const input = id => document.getElementById(id);
+
+			// Sort on header click; numeric columns compare data-value.
+			table.tHead.querySelectorAll('th').forEach((th, col) => {
+				th.addEventListener('click', () => {
+					const dir = th.dataset.dir === 'asc' ? 'desc' : 'asc';
+					table.tHead.querySelectorAll('th').forEach(h => delete h.dataset.dir);
+					th.dataset.dir = dir;
+					const numeric = th.dataset.type === 'num';
+					const key = row => numeric ? parseFloat(row.cells[col].dataset.value) : row.cells[col].textContent.trim();
+					rows.sort((a, b) => {
+						const x = key(a), y = key(b);
+						const cmp = numeric ? x - y : x.localeCompare(y);
+						return dir === 'asc' ? cmp : -cmp;
+					});
+					rows.forEach(row => tbody.appendChild(row));
+				});
+			});
+
+			// Multi-query searches: show one query at a time.
+			const querySelect = input('hit-query');
+			function stepQuery(delta) {
+				const n = querySelect.options.length;
+				querySelect.selectedIndex = (querySelect.selectedIndex + delta + n) % n;
+				applyFilters();
+			}
+			if (querySelect) {
+				querySelect.addEventListener('change', applyFilters);
+				input('hit-query-prev').addEventListener('click', () => stepQuery(-1));
+				input('hit-query-next').addEventListener('click', () => stepQuery(1));
+				document.querySelectorAll('a.query-link').forEach(a => a.addEventListener('click', ev => {
+					ev.preventDefault();
+					querySelect.value = a.dataset.query;
+					applyFilters();
+					table.scrollIntoView();
+				}));
+			}
+
+			const locationSelect = input('hit-location');
+			if (locationSelect) locationSelect.addEventListener('change', applyFilters);
+
+			// A bar of the graphic summary links to its row; make sure the row is shown.
+			const overviews = Array.from(document.querySelectorAll('.blast-overview'));
+			document.querySelectorAll('.blast-overview a.hit-bar').forEach(a => a.addEventListener('click', () => {
+				const row = document.getElementById(a.getAttribute('href').slice(1));
+				if (querySelect) querySelect.value = a.dataset.query;
+				applyFilters();
+				if (row.hidden) {
+					if (locationSelect) locationSelect.value = '';
+					['hit-filter', 'hit-min-identity', 'hit-min-coverage', 'hit-max-evalue'].forEach(id => input(id).value = '');
+					applyFilters();
+				}
+			}));
+
+			function applyFilters() {
+				const query = querySelect ? querySelect.value : '';
+				const location = locationSelect ? locationSelect.value : '';
+				const text = input('hit-filter').value.trim().toLowerCase();
+				const minIdentity = parseFloat(input('hit-min-identity').value);
+				const minCoverage = parseFloat(input('hit-min-coverage').value);
+				const maxEvalue = parseFloat(input('hit-max-evalue').value);
+				let shown = 0;
+				rows.forEach(row => {
+					const visible = (!query || row.dataset.query === query) &&
+						(!location || row.dataset.location === location) &&
+						(!text || row.textContent.toLowerCase().includes(text)) &&
+						(isNaN(minIdentity) || parseFloat(row.dataset.identity) >= minIdentity) &&
+						(isNaN(minCoverage) || parseFloat(row.dataset.coverage) >= minCoverage) &&
+						(isNaN(maxEvalue) || parseFloat(row.dataset.evalue) <= maxEvalue);
+					row.hidden = !visible;
+					if (visible) shown++;
+				});
+				input('hit-count').textContent = shown === rows.length ? rows.length + ' hits' : shown + ' of ' + rows.length + ' hits';
+				// With several queries the graphic summary shows the selected one.
+				if (querySelect) {
+					overviews.forEach(div => div.hidden = div.dataset.query !== query);
+					input('hit-overview-hint').hidden = query !== '';
+				}
+			}
+			['hit-filter', 'hit-min-identity', 'hit-min-coverage', 'hit-max-evalue'].forEach(id => input(id).addEventListener('input', applyFilters));
+		})();
+		</script>
+		{{ end }}
+	{{ end }}`
+
+	// hitOverview draws the hits of each query over the query, like NCBI's graphic summary.
+	hitOverviewTmpl := `
+	{{ define "hitOverview" }}
+		{{ if .Overviews }}
+		<h2>Graphic summary</h2>
+		{{ if gt (len .Queries) 1 }}<p id="hit-overview-hint">Pick a query to see where its hits align.</p>{{ end }}
+		{{ range .Overviews }}
+			<div class="blast-overview" data-query="{{ .QueryID }}"{{ if gt (len $.Queries) 1 }} hidden{{ end }}>
+				{{ .SVG }}
+				{{ if .Omitted }}<p>{{ .Omitted }} more subjects are only listed in the table.</p>{{ end }}
+			</div>
+		{{ end }}
+		{{ end }}
+	{{ end }}`
+
+	// hitAnnotation shows where a genome hit lies among the annotated genes.
+	hitAnnotationTmpl := `
+	{{ define "hitAnnotation" }}
+		{{ range .Genes }}
+			<div>{{ .GeneID }}{{ with .Description }} ({{ . }}){{ end }}, {{ .Overlap }} bp overlap{{ range .ClusterIDs }} <a href="/cluster/heatmap/{{ . }}" title="View cluster heatmap">{{ . }}</a>{{ end }}</div>
+		{{ end }}
+		{{ if .Intergenic }}<div><span class="blast-intergenic">Intergenic</span></div>{{ end }}
+		{{ range .Regions }}
+			<div>Cluster region {{ .Start }}-{{ .End }}, {{ .Overlap }} bp overlap <a href="/cluster/heatmap/{{ .ClusterID }}" title="View cluster heatmap">{{ .ClusterID }}</a></div>
+		{{ end }}
+	{{ end }}`
+
+	querySummaryTmpl := `
+	{{ define "querySummary" }}
+		<h2>Queries</h2>
+		<p>{{ len .Queries }} query sequences. [<a href="/blast/{{ .JobID }}/best-hits.tsv">Download best hits (TSV)</a>]</p>
+		<table class="blast-queries">
+			<thead>
+				<tr>
+					<th>Query</th>
+					<th>Length</th>
+					<th>Hits</th>
+					<th>Top hit</th>
+					<th>Identity (%)</th>
+					<th>E-value</th>
+					<th>Cluster</th>
+				</tr>
+			</thead>
+			<tbody>
+			{{ range .Queries }}
+				<tr>
+					<td>{{ if .HitCount }}<a href="#blast-hits" class="query-link" data-query="{{ .QueryID }}">{{ .QueryID }}</a>{{ else }}{{ .QueryID }}{{ end }}</td>
+					<td class="num">{{ if .QueryLength }}{{ .QueryLength }}{{ end }}</td>
+					<td class="num">{{ .HitCount }}</td>
+					{{ with .TopHit }}
+					<td>{{ .SubjectID }}{{ if .GenomeName }} ({{ .GenomeName }}){{ end }}</td>
+					<td class="num">{{ printf "%.1f" .Identity }}</td>
+					<td class="num">{{ evalue .EValue }}</td>
+					{{ else }}
+					<td colspan="3">No hits</td>
+					{{ end }}
+					<td>{{ range $i, $id := .ClusterIDs }}{{ if $i }}, {{ end }}<a href="/cluster/table/{{ $id }}">{{ $id }}</a>{{ end }}</td>
+				</tr>
+			{{ end }}
+			</tbody>
+		</table>
+	{{ end }}`
+
 	blast_page_template = template.New("blast_page").Funcs(template.FuncMap{
-		"mul": func(a, b int) int { return a * b },
+		"mul":            func(a, b int) int { return a * b },
+		"evalue":         formatEValue,
+		"geneHeatmapURL": geneHeatmapURL,
 	})
 	blast_page_template = template.Must(blast_page_template.Parse(mainTmpl))
+	blast_page_template = template.Must(blast_page_template.Parse(hitTableTmpl))
+	blast_page_template = template.Must(blast_page_template.Parse(hitOverviewTmpl))
+	blast_page_template = template.Must(blast_page_template.Parse(hitAnnotationTmpl))
+	blast_page_template = template.Must(blast_page_template.Parse(querySummaryTmpl))
+}
+
+// formatEValue prints e-values the way BLAST reports do: 0.0 for exact zero,
+// scientific notation for small values.
+func formatEValue(v float64) string {
+	switch {
+	case v == 0:
+		return "0.0"
+	case v < 0.001:
+		return fmt.Sprintf("%.1e", v)
+	default:
+		return fmt.Sprintf("%.3g", v)
+	}
+}
+
+// geneHeatmapURL links a gene hit to its cluster heatmap.
+func geneHeatmapURL(genomeID, contigID, geneID string) string {
+	return fmt.Sprintf("/cluster/heatmap/%s/%s/%s",
+		url.PathEscape(genomeID), url.PathEscape(contigID), url.PathEscape(geneID))
 }
 
 // Function to render an HTML page with a table
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+// BlastHeatmapOverlay marks the genes hit by a BLAST job on the cluster heatmap.
+type BlastHeatmapOverlay struct {
+	JobID        string
+	BlastType    string
+	ClusterCount int // Clusters with at least one hit, across all pages
+	// GeneIdentity is the best identity per hit gene, keyed by model.BlastGeneKey.
+	GeneIdentity map[string]float64
+}
+
+// calculateColorByIdentity maps a percent identity from 0 to 100 onto a light
+// to dark blue gradient (#DEEBF7 to #08519C).
+func calculateColorByIdentity(value float64) string {
+	t := math.Max(0, math.Min(value, 100)) / 100
+	r := int(math.Round(lerp(222, 8, t)))
+	g := int(math.Round(lerp(235, 81, t)))
+	b := int(math.Round(lerp(247, 156, t)))
+	return fmt.Sprintf("#%02X%02X%02X", r, g, b)
+}
+
+// arrangeGenomeWithHits arranges genomes like arrangeGenomeWithColor and marks
+// the genes hit by BLAST. With colorFn nil, cells are colored by the best hit
+// identity in the genome and cells without a hit are left white.
+func arrangeGenomeWithHits(geneIdentity map[string]float64, colorFn CellColorFunc) func(map[string]*model.Genome, []string) []Cell {
+	byIdentity := colorFn == nil
+	if byIdentity {
+		colorFn = func([]*model.Gene, []*model.Region) string { return "#FFFFFF" }
+	}
+	return func(genomes map[string]*model.Genome, genomeIDs []string) []Cell {
+		cells := arrangeGenomeWithColor(genomes, genomeIDs, colorFn)
+		for i, genomeID := range genomeIDs {
+			cell := &cells[i]
+			for _, gene := range cell.Genes {
+				identity, ok := geneIdentity[model.BlastGeneKey(genomeID, gene.GeneID)]
+				if !ok {
+					continue
+				}
+				if cell.HitGenes == nil {
+					cell.HitGenes = make(map[string]float64)
+				}
+				cell.HitGenes[gene.GeneID] = identity
+				cell.HitIdentity = max(cell.HitIdentity, identity)
+			}
+			if byIdentity && cell.HitGenes != nil {
+				cell.Color = calculateColorByIdentity(cell.HitIdentity)
+			}
+		}
+		return cells
+	}
+}
+
+// RenderBlastClusterHeatmapPage renders the search heatmap for the clusters hit
+// by a BLAST job, with hit cells outlined. Color_By "best_identity" colors each
+// cell by the best identity of a hit in that genome.
+func RenderBlastClusterHeatmapPage(w io.Writer, rows []*model.Cluster, overlay BlastHeatmapOverlay, searchRequest model.ClusterSearchRequest, totalPage int) error {
+	colorBy := searchRequest.Color_By
+	data := buildClusterHeatmapPageData(rows, searchRequest, totalPage)
+	data.Blast = &overlay
+
+	// The image export has no BLAST overlay; pin the clusters shown instead.
+	exportRequest := model.ClusterSearchRequest{Genome_IDs: searchRequest.Genome_IDs, Color_By: data.ColorBy}
+	data.ExportQuery = heatmapExportQuery(rows, exportRequest, true)
+
+	switch colorBy {
+	case "best_identity":
+		data.ColorBy = colorBy
+		data.ArrangeGenome = arrangeGenomeWithHits(overlay.GeneIdentity, nil)
+	case "max_gene_completeness":
+		data.ArrangeGenome = arrangeGenomeWithHits(overlay.GeneIdentity, colorByMaxCompleteness)
+	default:
+		data.ArrangeGenome = arrangeGenomeWithHits(overlay.GeneIdentity, colorByCopyNumber)
+	}
+	return searchPageTemplate.Execute(w, data)
+}
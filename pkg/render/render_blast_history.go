@@ -0,0 +1,72 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// BlastHistoryJob is one row of the BLAST job history.
+type BlastHistoryJob struct {
+	JobID         string
+	BlastType     string
+	Database      string
+	Aligner       string
+	Status        string
+	QueuePosition int
+	CreatedAt     time.Time
+	QueryCount    int
+	QueryPreview  string
+}
+
+// BlastHistoryPageData lists a user's recent BLAST jobs, newest first.
+type BlastHistoryPageData struct {
+	Jobs []BlastHistoryJob
+}
+
+var blastHistoryTemplate = template.Must(template.New("blast_history").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+}).Parse(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+	    <title>Your BLAST jobs</title>
+	    <style>
+        table.blast-history { border-collapse: collapse; font-size: 13px; }
+        table.blast-history th, table.blast-history td { border: 1px solid #d1d5db; padding: 3px 6px; text-align: left; }
+        table.blast-history th { background: #e5e7eb; }
+        table.blast-history tbody tr:nth-child(even) { background: #f9fafb; }
+        table.blast-history td.query { font-family: monospace; max-width: 40rem; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+   		</style>
+	</head>
+	<body>
+		<h1>Your BLAST jobs</h1>
+		<p>Searches submitted from this browser, newest first. Finished jobs are removed after a while.</p>
+		{{ if .Jobs }}
+		<table class="blast-history">
+			<thead>
+				<tr><th>Submitted</th><th>Program</th><th>Database</th><th>Status</th><th>Query</th></tr>
+			</thead>
+			<tbody>
+				{{ range .Jobs }}
+				<tr>
+					<td><a href="/blast/{{ .JobID }}">{{ formatTime .CreatedAt }}</a></td>
+					<td>{{ .BlastType }}{{ if and .Aligner (ne .Aligner "blast") }} ({{ .Aligner }}){{ end }}</td>
+					<td>{{ .Database }}</td>
+					<td>{{ .Status }}{{ if .QueuePosition }} (position {{ .QueuePosition }}){{ end }}</td>
+					<td class="query" title="{{ .QueryPreview }}">{{ .QueryPreview }}{{ if gt .QueryCount 1 }} <em>({{ .QueryCount }} sequences)</em>{{ end }}</td>
+				</tr>
+				{{ end }}
+			</tbody>
+		</table>
+		{{ else }}
+		<p>No BLAST jobs yet. <a href="/">Start a search</a>.</p>
+		{{ end }}
+	</body>
+	</html>
+`))
+
+// RenderBlastHistoryPage renders the list of a user's BLAST jobs.
+func RenderBlastHistoryPage(w io.Writer, data BlastHistoryPageData) error {
+	return blastHistoryTemplate.Execute(w, data)
+}
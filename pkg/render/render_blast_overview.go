@@ -0,0 +1,246 @@
+// Render the graphic summary of BLAST hits: the query as a ruler with the
+// aligned part of every hit drawn beneath it, grouped by genome.
+
+package render
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+const (
+	overviewWidth       = 800
+	overviewLabelWidth  = 200 // Subject labels left of the plot
+	overviewPadding     = 10
+	overviewRowHeight   = 14
+	overviewBarHeight   = 9
+	overviewMaxSubjects = 100 // Subjects drawn per query; the rest are only in the table
+	overviewMaxLabel    = 30
+)
+
+// overviewScoreBins colors hits by bitscore with the bins of NCBI's graphic summary.
+var overviewScoreBins = []struct {
+	Min   float64
+	Color string
+	Label string
+}{
+	{200, "#E2001A", ">= 200"},
+	{80, "#D100D1", "80 - 200"},
+	{50, "#00A100", "50 - 80"},
+	{40, "#0000E0", "40 - 50"},
+	{math.Inf(-1), "#000000", "< 40"},
+}
+
+func overviewScoreColor(bitscore float64) string {
+	for _, bin := range overviewScoreBins {
+		if bitscore >= bin.Min {
+			return bin.Color
+		}
+	}
+	return overviewScoreBins[len(overviewScoreBins)-1].Color
+}
+
+// BlastOverview is the graphic summary of the hits of one query.
+type BlastOverview struct {
+	QueryID string
+	SVG     template.HTML
+	Omitted int // Subjects left out beyond overviewMaxSubjects
+}
+
+// overviewSubject is a row of the overview: the HSPs of one subject.
+type overviewSubject struct {
+	label    string
+	best     float64
+	hitIndex []int // Into BlastResult.Hits
+}
+
+// overviewGenome groups the subjects of one genome.
+type overviewGenome struct {
+	label    string
+	subjects []*overviewSubject
+}
+
+// BlastOverviews draws a graphic summary for each query with hits, in the
+// order of queries. Bars link to the hit table rows, whose IDs are "hit-"
+// followed by the index of the hit in result.Hits.
+func BlastOverviews(result *model.BlastResult, queries []*model.BlastQuerySummary) []BlastOverview {
+	if result == nil {
+		return nil
+	}
+	byQuery := make(map[string][]int)
+	for i, hit := range result.Hits {
+		byQuery[hit.QueryID] = append(byQuery[hit.QueryID], i)
+	}
+
+	var overviews []BlastOverview
+	for _, q := range queries {
+		indexes := byQuery[q.QueryID]
+		if len(indexes) == 0 {
+			continue
+		}
+		overviews = append(overviews, blastOverview(q.QueryID, q.QueryLength, result.Hits, indexes))
+	}
+	return overviews
+}
+
+func blastOverview(queryID string, queryLength int, hits []model.BlastHit, indexes []int) BlastOverview {
+	// Jobs run before query lengths were recorded fall back to the hits.
+	for _, i := range indexes {
+		queryLength = max(queryLength, hits[i].QueryLength, hits[i].QueryStart, hits[i].QueryEnd, 1)
+	}
+
+	genomes, omitted := groupOverviewHits(hits, indexes)
+	rows := 0
+	for _, g := range genomes {
+		rows += 1 + len(g.subjects)
+	}
+
+	plotX := overviewPadding + overviewLabelWidth
+	plotWidth := overviewWidth - plotX - overviewPadding
+	xOf := func(pos int) float64 {
+		return float64(plotX) + float64(pos-1)*float64(plotWidth)/float64(queryLength)
+	}
+
+	legendY := overviewPadding
+	rulerY := legendY + 30
+	rowsY := rulerY + 40
+	height := rowsY + rows*overviewRowHeight + overviewPadding
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="blast-overview-svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="11">`,
+		overviewWidth, height, overviewWidth, height, DefaultHeatmapFontFamily)
+
+	// Color key
+	fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">Color key for bitscores</text>`, overviewPadding, legendY+6)
+	x := plotX
+	for i := len(overviewScoreBins) - 1; i >= 0; i-- {
+		bin := overviewScoreBins[i]
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="12" fill="%s"/>`, x, legendY, plotWidth/len(overviewScoreBins), bin.Color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#FFFFFF" text-anchor="middle" dominant-baseline="middle">%s</text>`,
+			x+plotWidth/len(overviewScoreBins)/2, legendY+7, html.EscapeString(bin.Label))
+		x += plotWidth / len(overviewScoreBins)
+	}
+
+	// Query ruler
+	fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">Query %s</text>`, overviewPadding, rulerY+6, html.EscapeString(truncateLabel(queryID, overviewMaxLabel-6)))
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="12" fill="#9CA3AF"/>`, plotX, rulerY, plotWidth)
+	step := rulerStep(queryLength)
+	for pos := step; pos <= queryLength; pos += step {
+		tx := xOf(pos) + float64(plotWidth)/float64(queryLength)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#374151"/>`, tx, rulerY+12, tx, rulerY+17)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" font-size="10">%d</text>`, tx, rulerY+28, pos)
+	}
+
+	y := rowsY
+	for _, g := range genomes {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-weight="bold" dominant-baseline="middle">%s</text>`,
+			overviewPadding, y+overviewRowHeight/2, html.EscapeString(g.label))
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#E5E7EB"/>`, plotX, y+overviewRowHeight/2, plotX+plotWidth, y+overviewRowHeight/2)
+		y += overviewRowHeight
+		for _, s := range g.subjects {
+			fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle"><title>%s</title>%s</text>`,
+				overviewPadding+10, y+overviewRowHeight/2, html.EscapeString(s.label), html.EscapeString(truncateLabel(s.label, overviewMaxLabel)))
+			for _, i := range s.hitIndex {
+				hit := hits[i]
+				start, end := min(hit.QueryStart, hit.QueryEnd), max(hit.QueryStart, hit.QueryEnd)
+				x1, x2 := xOf(start), xOf(end+1)
+				fmt.Fprintf(&b, `<a href="#hit-%d" class="hit-bar" data-query="%s"><rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s: query %d-%d, %.1f%% identity, bitscore %.1f, e-value %s</title></rect></a>`,
+					i, html.EscapeString(hit.QueryID), x1, y+(overviewRowHeight-overviewBarHeight)/2, max(x2-x1, 1), overviewBarHeight,
+					overviewScoreColor(hit.BitScore), html.EscapeString(s.label), start, end, hit.Identity, hit.BitScore, formatEValue(hit.EValue))
+			}
+			y += overviewRowHeight
+		}
+	}
+	b.WriteString(`</svg>`)
+
+	// The SVG is built from escaped values only.
+	return BlastOverview{QueryID: queryID, SVG: template.HTML(b.String()), Omitted: omitted}
+}
+
+// groupOverviewHits puts the hits of a query on one row per subject, keeps
+// the overviewMaxSubjects best subjects and groups them by genome. Genomes
+// and their subjects are ordered by their best bitscore.
+func groupOverviewHits(hits []model.BlastHit, indexes []int) (genomes []*overviewGenome, omitted int) {
+	var subjects []*overviewSubject
+	bySubject := make(map[string]*overviewSubject)
+	genomeOf := make(map[*overviewSubject]string)
+	for _, i := range indexes {
+		hit := hits[i]
+		s, ok := bySubject[hit.SubjectID]
+		if !ok {
+			s = &overviewSubject{label: overviewSubjectLabel(hit), best: hit.BitScore}
+			bySubject[hit.SubjectID] = s
+			genomeOf[s] = overviewGenomeLabel(hit)
+			subjects = append(subjects, s)
+		}
+		s.hitIndex = append(s.hitIndex, i)
+		s.best = max(s.best, hit.BitScore)
+	}
+	slices.SortStableFunc(subjects, func(a, b *overviewSubject) int { return cmp.Compare(b.best, a.best) })
+	if len(subjects) > overviewMaxSubjects {
+		omitted = len(subjects) - overviewMaxSubjects
+		subjects = subjects[:overviewMaxSubjects]
+	}
+
+	byGenome := make(map[string]*overviewGenome)
+	for _, s := range subjects {
+		label := genomeOf[s]
+		g, ok := byGenome[label]
+		if !ok {
+			// Subjects are sorted, so genomes come in the order of their best subject.
+			g = &overviewGenome{label: label}
+			byGenome[label] = g
+			genomes = append(genomes, g)
+		}
+		g.subjects = append(g.subjects, s)
+	}
+	return genomes, omitted
+}
+
+func overviewGenomeLabel(hit model.BlastHit) string {
+	switch {
+	case hit.GenomeName != "" && hit.GenomeID != "":
+		return fmt.Sprintf("%s (%s)", hit.GenomeName, hit.GenomeID)
+	case hit.GenomeID != "":
+		return hit.GenomeID
+	default:
+		return "Unknown genome"
+	}
+}
+
+func overviewSubjectLabel(hit model.BlastHit) string {
+	switch {
+	case hit.GeneID != "":
+		return hit.GeneID
+	case hit.ContigID != "":
+		return hit.ContigID
+	default:
+		return hit.SubjectID
+	}
+}
+
+func truncateLabel(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// rulerStep picks a tick interval of 1, 2 or 5 times a power of ten that
+// puts at most ten ticks on a ruler of length positions.
+func rulerStep(length int) int {
+	for step := 1; ; step *= 10 {
+		for _, m := range []int{1, 2, 5} {
+			if length/(step*m) <= 10 {
+				return step * m
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+func TestBlastOverviews(t *testing.T) {
+	result := &model.BlastResult{Hits: []model.BlastHit{
+		{QueryID: "q1", SubjectID: "G1//c1//g1", GenomeID: "G1", GenomeName: "Genome <one>", GeneID: "g1", QueryStart: 1, QueryEnd: 100, BitScore: 250},
+		{QueryID: "q1", SubjectID: "G2//c2//g2", GenomeID: "G2", GenomeName: "Genome two", GeneID: "g2", QueryStart: 20, QueryEnd: 60, BitScore: 45},
+		{QueryID: "q1", SubjectID: "G1//c1//g3", GenomeID: "G1", GenomeName: "Genome <one>", GeneID: "g3", QueryStart: 150, QueryEnd: 200, BitScore: 90},
+		{QueryID: "q1", SubjectID: "G1//c1//g1", GenomeID: "G1", GenomeName: "Genome <one>", GeneID: "g1", QueryStart: 120, QueryEnd: 180, BitScore: 30},
+		{QueryID: "q2", SubjectID: "G2//c2//g2", GenomeID: "G2", GeneID: "g2", QueryStart: 1, QueryEnd: 10, BitScore: 20},
+	}}
+	queries := []*model.BlastQuerySummary{{QueryID: "q1", QueryLength: 200}, {QueryID: "q2", QueryLength: 10}, {QueryID: "q3", QueryLength: 50}}
+
+	overviews := BlastOverviews(result, queries)
+	if len(overviews) != 2 || overviews[0].QueryID != "q1" || overviews[1].QueryID != "q2" {
+		t.Fatalf("overviews = %+v, want q1 and q2", overviews)
+	}
+	svg := string(overviews[0].SVG)
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Fatalf("SVG is not well-formed: %v\n%s", err, svg)
+	}
+
+	// G1 holds the best subject, so it comes first, with both of its subjects.
+	g1, g2 := strings.Index(svg, "Genome &lt;one&gt; (G1)"), strings.Index(svg, "Genome two (G2)")
+	if g1 < 0 || g2 < 0 || g1 > g2 || strings.Index(svg, ">g3<") > g2 {
+		t.Errorf("genomes are not grouped by best hit:\n%s", svg)
+	}
+	for _, want := range []string{`href="#hit-0"`, `href="#hit-3"`, `fill="#E2001A"`, `fill="#0000E0"`, `fill="#D100D1"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG lacks %s", want)
+		}
+	}
+	// The first bar spans half of the plot.
+	plotWidth := overviewWidth - 2*overviewPadding - overviewLabelWidth
+	if want := fmt.Sprintf(`width="%.1f"`, float64(plotWidth)/2); !strings.Contains(svg, want) {
+		t.Errorf("first bar does not span half the query (%s)", want)
+	}
+
+	var b bytes.Buffer
+	err := blast_page_template.Execute(&b, BlastPageData{JobID: "j1", Status: "completed", Database: "genes", Result: result, Queries: queries, Overviews: overviews})
+	if err != nil {
+		t.Fatalf("render page: %v", err)
+	}
+	if page := b.String(); !strings.Contains(page, `<tr id="hit-3"`) || !strings.Contains(page, `<div class="blast-overview" data-query="q2" hidden>`) {
+		t.Errorf("page lacks overview or row anchors")
+	}
+}
+
+func TestRulerStep(t *testing.T) {
+	for length, want := range map[int]int{5: 1, 10: 1, 11: 2, 100: 10, 250: 50, 1200: 200, 9000: 1000} {
+		if got := rulerStep(length); got != want {
+			t.Errorf("rulerStep(%d) = %d, want %d", length, got, want)
+		}
+	}
+}
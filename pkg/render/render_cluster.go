@@ -89,7 +89,8 @@ func init() {
 					<td>
 						[<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=false" target="_blank">FNA</a>]
 						[<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=true" target="_blank">FAA</a>]
-						[<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank">BLASTP</a>]
+						[{{ template "blastGeneButton" $gene }}]{{ if ncbiBlast }}
+						[<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
 					</td>
 				</tr>
 			{{ end }}
@@ -105,7 +106,8 @@ func init() {
 					<td> N/A </td>
 					<td>
 						[<a href="/sequence/by-region?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank">FNA</a>]
-						[<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank">BLASTN</a>]
+						[{{ template "blastRegionButton" . }}]{{ if ncbiBlast }}
+						[<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
 					</td>
 				</tr>
 			{{ end }}
@@ -124,6 +126,7 @@ func init() {
 			_, ok := m[k]
 			return ok
 		},
+		"ncbiBlast":           ncbiBlast,
 		"calculateGeneLength": func(a, b int) int { return int(math.Abs(float64(a - b + 1))) },
 		"genomeLabel": func(genomeID string, names map[string]string) string {
 			if names == nil {
@@ -140,6 +143,7 @@ func init() {
 	cluster_page_template = template.Must(cluster_page_template.Parse(mainTmpl))
 	cluster_page_template = template.Must(cluster_page_template.Parse(clusterSummaryTempl))
 	cluster_page_template = template.Must(cluster_page_template.Parse(clusterInfoTmpl))
+	cluster_page_template = template.Must(cluster_page_template.Parse(localBlastTmpl))
 
 }
 
@@ -40,6 +40,11 @@ func init() {
 				<div class="form-column legend-column">
 					<h3>Legend</h3>
 					{{template "legend" .}}
+					<div class="export-image">
+						Export heatmap:
+						[<a href="/image/heatmap.svg?{{.ExportQuery}}" target="_blank">SVG</a>]
+						[<a href="/image/heatmap.png?{{.ExportQuery}}" target="_blank">PNG</a>]
+					</div>
 				</div>
 			</div>
 		</div>
@@ -176,14 +181,16 @@ func init() {
                         <div>{{$gene.GeneID}} - 
                             [<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=false" target="_blank">N</a>]
                             [<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=true" target="_blank">P</a>]
-                            [<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank">BLASTP</a>]
+                            [{{ template "blastGeneButton" $gene }}]{{ if ncbiBlast }}
+                            [<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
                         </div>
                     {{end}}
                     {{range $index, $region := .Regions}}
                         <div>
                             Region - {{ $region }}
                                 [<a href="/sequence/by-region?genome_id={{$region.GenomeID}}&contig_id={{$region.ContigID}}&start={{$region.Start}}&end={{$region.End}}" target="_blank">N</a>]
-                                [<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank">BLASTN</a>]
+                                [{{ template "blastRegionButton" . }}]{{ if ncbiBlast }}
+                                [<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
                         </div>
                     {{end}}
                 {{end}}
@@ -198,10 +205,15 @@ func init() {
 	clusterPageTemplate = template.Must(clusterPageTemplate.Parse(filterByGenome))
 	clusterPageTemplate = template.Must(clusterPageTemplate.Parse(tableTmpl))
 	clusterPageTemplate = template.Must(clusterPageTemplate.Parse(cellTmpl))
+	clusterPageTemplate = template.Must(clusterPageTemplate.Parse(localBlastTmpl))
 }
 
 // RenderClusterStandaloneHeatmapPage renders the cluster heatmap without search/BLAST controls.
 func RenderClusterStandaloneHeatmapPage(w io.Writer, rows []*model.Cluster, searchRequest model.ClusterSearchRequest, totalPage int) error {
 	data := buildClusterHeatmapPageData(rows, searchRequest, totalPage)
+	data.ExportQuery = heatmapExportQuery(rows, model.ClusterSearchRequest{
+		Genome_IDs: searchRequest.Genome_IDs,
+		Color_By:   data.ColorBy,
+	}, true)
 	return clusterPageTemplate.Execute(w, data)
 }
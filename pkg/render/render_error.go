@@ -0,0 +1,67 @@
+// Render HTML error pages
+
+package render
+
+import (
+	"html/template"
+	"io"
+)
+
+var error_page_template *template.Template
+
+// ErrorPageData describes a failed request for rendering.
+type ErrorPageData struct {
+	Status    int
+	Title     string
+	Detail    string
+	RequestID string
+}
+
+// init initializes the template used for rendering error pages.
+func init() {
+	mainTmpl := `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>{{ .Status }} {{ .Title }} - Gene Table</title>
+	<style>
+		body {
+			font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+			background: #f5f6f8;
+			color: #333333;
+			margin: 0;
+		}
+		.error-box {
+			max-width: 560px;
+			margin: 80px auto;
+			padding: 24px 32px;
+			background: #ffffff;
+			border-top: 4px solid {{ if ge .Status 500 }}#c0392b{{ else }}#e67e22{{ end }};
+			border-radius: 4px;
+			box-shadow: 0 1px 4px rgba(0, 0, 0, 0.12);
+		}
+		.error-status { font-size: 48px; font-weight: bold; margin: 0; color: #555555; }
+		.error-title { margin: 4px 0 16px; }
+		.error-request-id { font-size: 12px; color: #888888; }
+		code { background: #f0f0f0; padding: 1px 4px; }
+	</style>
+</head>
+<body>
+	<div class="error-box">
+		<p class="error-status">{{ .Status }}</p>
+		<h1 class="error-title">{{ .Title }}</h1>
+		{{ if .Detail }}<p>{{ .Detail }}</p>{{ end }}
+		<p><a href="/">Back to the gene table</a></p>
+		{{ if .RequestID }}<p class="error-request-id">Request ID: <code>{{ .RequestID }}</code></p>{{ end }}
+	</div>
+</body>
+</html>
+`
+
+	error_page_template = template.Must(template.New("error_page").Parse(mainTmpl))
+}
+
+// RenderErrorPage writes a styled HTML page for a failed request.
+func RenderErrorPage(w io.Writer, data ErrorPageData) error {
+	return error_page_template.Execute(w, data)
+}
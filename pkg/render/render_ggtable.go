@@ -5,6 +5,8 @@ import (
 	"html/template"
 	"io"
 	"math"
+	"net/url"
+	"strconv"
 
 	"github.com/yumyai/ggtable/pkg/model"
 )
@@ -92,6 +94,9 @@ type Cell struct {
 	Regions []*model.Region
 	Color   string
 	Blank   bool
+	// BLAST overlay only: identity of the hit genes and the best of them.
+	HitGenes    map[string]float64
+	HitIdentity float64
 }
 
 // arrangeGenomeWithColor arranges genomes according to genome IDs and uses
@@ -158,6 +163,20 @@ func arrangeGenomeColorByCopyNumber(genomes map[string]*model.Genome, genomeIDs
 	return arrangeGenomeWithColor(genomes, genomeIDs, colorByCopyNumber)
 }
 
+// NCBIBlastLinks adds links that send gene and region sequences to NCBI BLAST
+// next to the local BLAST links.
+var NCBIBlastLinks = true
+
+func ncbiBlast() bool { return NCBIBlastLinks }
+
+// localBlastTmpl defines the buttons that BLAST a gene or region against the
+// local databases. They post forms rather than link, because following them
+// starts a search.
+const localBlastTmpl = `
+{{ define "blastGeneButton" }}<form class="link-form" method="post" action="/blast/gene" target="_blank"><input type="hidden" name="genome_id" value="{{ .Region.GenomeID }}"><input type="hidden" name="contig_id" value="{{ .Region.ContigID }}"><input type="hidden" name="gene_id" value="{{ .GeneID }}"><button type="submit" title="BLAST against the local gene proteins">BLASTP</button></form>{{ end }}
+{{ define "blastRegionButton" }}<form class="link-form" method="post" action="/blast/region" target="_blank"><input type="hidden" name="genome_id" value="{{ .GenomeID }}"><input type="hidden" name="contig_id" value="{{ .ContigID }}"><input type="hidden" name="start" value="{{ .Start }}"><input type="hidden" name="end" value="{{ .End }}"><button type="submit" title="BLAST against the local genome assemblies">BLASTN</button></form>{{ end }}
+`
+
 var (
 	templateFuncMap = template.FuncMap{
 		"add": func(a, b int) int { return a + b },
@@ -168,6 +187,7 @@ var (
 			_, ok := m[k]
 			return ok
 		},
+		"ncbiBlast": ncbiBlast,
 	}
 	searchPageTemplate *template.Template
 )
@@ -214,6 +234,7 @@ func init() {
 			<div class="form-column legend-column">
 				<h3>Legend</h3>
 				{{template "legend" .}}
+				{{template "exportImage" .}}
 			</div>
 		</div>
 	{{end}}
@@ -221,7 +242,13 @@ func init() {
 
 	searchForm1 := `
 	{{ define "searchForm1"}}
-  <form id="searchForm" action="/search" method="GET">
+  <form id="searchForm" action="{{if .Blast}}/blast/{{.Blast.JobID}}/clusters{{else}}/search{{end}}" method="GET">
+    {{if .Blast}}
+    <div class="form-row">
+      {{.Blast.ClusterCount}} cluster(s) hit by {{.Blast.BlastType}} job <a href="/blast/{{.Blast.JobID}}">{{.Blast.JobID}}</a>
+      [<a href="/search">Back to search</a>]
+    </div>
+    {{else}}
     <label for="search"></label>
     <div class="form-row">
       <label>Search by:<select name="search_by" id="search_by">
@@ -233,6 +260,7 @@ func init() {
 	  <input type="text" name="search" placeholder="Search goes here"value="{{.SearchText}}"></input>
 	    <input type="submit" value="Search"></input>
     </div>
+    {{end}}
 	<div>
 	<label>Page Size:
 	<select name="page_size" id="page_size">
@@ -250,6 +278,7 @@ func init() {
 	<select name="color_by" id="color_by" onchange="this.form.submit()" title="Choose how to color each cell">
 	  <option value="gene_copy_number" {{if eq .ColorBy "gene_copy_number"}}selected{{end}}>Gene copy number</option>
 	  <option value="max_gene_completeness" {{if eq .ColorBy "max_gene_completeness"}}selected{{end}}>Max gene completeness</option>
+	  {{if .Blast}}<option value="best_identity" {{if eq .ColorBy "best_identity"}}selected{{end}}>Best BLAST identity</option>{{end}}
 	</select>
 	</label>
 	</div>
@@ -271,17 +300,91 @@ func init() {
 			<div class="form-row">
 				<label>BLAST Type:
 					<select name="blast_type" id="blast_type">
-						<option value=blastn>BLASTN</option>
-						<option value=blastp>BLASTP</option>
+						<option value=auto>Auto (from the query sequence)</option>
+						<option value=blastn data-aligner="blast mmseqs">BLASTN (nucleotide vs nucleotide)</option>
+						<option value=blastp>BLASTP (protein vs protein)</option>
+						<option value=blastx>BLASTX (translated nucleotide vs protein)</option>
+						<option value=tblastn data-aligner="blast mmseqs">TBLASTN (protein vs translated nucleotide)</option>
+						<option value=tblastx data-aligner="blast mmseqs">TBLASTX (translated nucleotide vs translated nucleotide)</option>
+					</select>
+				</label>
+				<label>Database:
+					<select name="database" id="blast_database">
+						<option value="genes">Genes</option>
+						<!-- The genome database is nucleotide only, and DIAMOND searches proteins only -->
+						<option value="genomes" data-blast-type="auto blastn tblastn tblastx" data-aligner="blast mmseqs">Genomes (unannotated assemblies)</option>
+					</select>
+				</label>
+				<label>Aligner:
+					<select name="aligner" id="blast_aligner">
+						<option value="blast">BLAST+</option>
+						<option value="diamond">DIAMOND (fast protein search)</option>
+						<option value="mmseqs">MMseqs2</option>
 					</select>
 				</label>
 			</div>
 			<div class="form-row">
 				<label>Sequence:</label>
-				<textarea name="sequence" rows="4" cols="50" placeholder="Enter sequence here"></textarea>
+				<textarea name="sequence" rows="4" cols="50" placeholder="Enter a sequence, or several in FASTA format"></textarea>
+			</div>
+			<!-- Filled in by the query check as the sequence is typed -->
+			<div id="blast-query-check" class="blast-query-check" aria-live="polite"></div>
+			<div class="collapsible">
+				<div class="collapse-header">Search parameters</div>
+				<div class="collapse-content">
+					<!-- Empty fields keep the BLAST+ default. Elements with data-blast-type only apply to the listed programs, and those with data-aligner to the listed aligners. -->
+					<div class="form-row" data-aligner="blast">
+						<label>Task:
+							<select name="task">
+								<option value="">Default</option>
+								<option value="megablast" data-blast-type="blastn">megablast (highly similar)</option>
+								<option value="dc-megablast" data-blast-type="blastn">dc-megablast (somewhat similar)</option>
+								<option value="blastn" data-blast-type="blastn">blastn (somewhat similar)</option>
+								<option value="blastn-short" data-blast-type="blastn">blastn-short (primers, &lt; 50 bp)</option>
+								<option value="blastp" data-blast-type="blastp">blastp</option>
+								<option value="blastp-short" data-blast-type="blastp">blastp-short (peptides, &lt; 30 aa)</option>
+								<option value="blastp-fast" data-blast-type="blastp">blastp-fast</option>
+								<option value="blastx" data-blast-type="blastx">blastx</option>
+								<option value="blastx-fast" data-blast-type="blastx">blastx-fast</option>
+								<option value="tblastn" data-blast-type="tblastn">tblastn</option>
+								<option value="tblastn-fast" data-blast-type="tblastn">tblastn-fast</option>
+							</select>
+						</label>
+					</div>
+					<div class="form-row">
+						<label>E-value: <input type="number" name="evalue" min="0" max="1000" step="any" placeholder="10"></label>
+						<label>Max target sequences: <input type="number" name="max_target_seqs" min="1" max="5000" placeholder="500"></label>
+						<label data-aligner="blast">Word size: <input type="number" name="word_size" min="2" max="128" placeholder="default"></label>
+					</div>
+					<div class="form-row" data-blast-type="blastp blastx tblastn tblastx" data-aligner="blast diamond">
+						<label>Matrix:
+							<select name="matrix">
+								<option value="">BLOSUM62 (default)</option>
+								<option value="BLOSUM45">BLOSUM45</option>
+								<option value="BLOSUM50">BLOSUM50</option>
+								<option value="BLOSUM80">BLOSUM80</option>
+								<option value="BLOSUM90">BLOSUM90</option>
+								<option value="PAM30">PAM30</option>
+								<option value="PAM70">PAM70</option>
+								<option value="PAM250">PAM250</option>
+							</select>
+						</label>
+					</div>
+					<div class="form-row">
+						<label data-blast-type="blastn blastp blastx tblastn" data-aligner="blast diamond">Gap costs (open,extend): <input type="text" name="gap_costs" size="6" pattern="\d+,\d+" placeholder="default"></label>
+						<label>Low-complexity filter:
+							<select name="filter">
+								<option value="">Default</option>
+								<option value="true">On</option>
+								<option value="false">Off</option>
+							</select>
+						</label>
+					</div>
+				</div>
 			</div>
 			<div class="form-row">
 				<input type="submit" formaction="/blast" formmethod="POST" value="BLAST Search">
+				<a href="/blast">Your BLAST jobs</a>
 			</div>
 		</form>
 	{{end}}
@@ -303,6 +406,13 @@ func init() {
         <span class="legend-item"><span class="legend-swatch legend-swatch--wide" style="background: -webkit-linear-gradient(left,#BD0026,#800000); background: linear-gradient(90deg,#BD0026,#800000);"></span><span>6+ copies (darker = more)</span></span>
       </div>
     </div>
+  {{else if eq .ColorBy "best_identity"}}
+    <div class="legend">
+      <div class="legend-row">
+        <span class="legend-item"><span class="legend-swatch" style="background:#FFFFFF"></span><span>No hit</span></span>
+        <span class="legend-item"><span class="legend-swatch legend-swatch--wide" style="background: -webkit-linear-gradient(left,#DEEBF7,#08519C); background: linear-gradient(90deg,#DEEBF7,#08519C);"></span><span>Best identity 0%–100%</span></span>
+      </div>
+    </div>
   {{else}}
     <div class="legend">
       <div class="legend-row">
@@ -311,6 +421,13 @@ func init() {
         <span class="legend-item"><span class="legend-swatch legend-swatch--wide" style="background: -webkit-linear-gradient(left,#FF0000,#FFFF00,#00FF00); background: linear-gradient(90deg,#FF0000,#FFFF00,#00FF00);"></span><span>70%–100%</span></span>
       </div>
     </div>
+  {{end}}
+  {{if .Blast}}
+    <div class="legend">
+      <div class="legend-row">
+        <span class="legend-item"><span class="legend-swatch blast-hit" style="background:#FFFFFF"></span><span>Genome with a BLAST hit</span></span>
+      </div>
+    </div>
   {{end}}
 	{{end}}`
 
@@ -341,6 +458,15 @@ func init() {
 		</div>
 	{{end}}
 	`
+	exportImageTmpl := `
+	{{define "exportImage"}}
+		<div class="export-image">
+			Export heatmap:
+			[<a href="/image/heatmap.svg?{{.ExportQuery}}" target="_blank">SVG</a>]
+			[<a href="/image/heatmap.png?{{.ExportQuery}}" target="_blank">PNG</a>]
+		</div>
+	{{end}}
+	`
 	filterByGene := `
 	{{define "filterByGene"}}
 	{{end}}
@@ -385,24 +511,26 @@ func init() {
 
 	cellTmpl := `
     {{define "cellContent"}}
-        <td bgcolor={{.Color}}>
+        <td bgcolor="{{.Color}}"{{if .HitGenes}} class="blast-hit"{{end}}>
             <div class="menu">
                 <a href="#" class="close-menu">[close]</a>
                 {{if .Blank}}
                     <div>No information</div>
                 {{else}}
                     {{range $index, $gene := .Genes}}
-                        <div>{{$gene.GeneID}} - 
+                        <div>{{$gene.GeneID}} - {{with index $.HitGenes $gene.GeneID}}<strong>BLAST hit, {{printf "%.1f" .}}% identity</strong> - {{end}}
                             [<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=false" target="_blank">N</a>]
                             [<a href="/sequence/by-gene?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}&is_prot=true" target="_blank">P</a>]
-                            [<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank">BLASTP</a>]
+                            [{{ template "blastGeneButton" $gene }}]{{ if ncbiBlast }}
+                            [<a href="/redirect/blastp?genome_id={{$gene.Region.GenomeID}}&contig_id={{$gene.Region.ContigID}}&gene_id={{$gene.GeneID}}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
                         </div>
                     {{end}}
                     {{range $index, $region := .Regions}}
                         <div>
                             Region - {{ $region }}
                                 [<a href="/sequence/by-region?genome_id={{$region.GenomeID}}&contig_id={{$region.ContigID}}&start={{$region.Start}}&end={{$region.End}}" target="_blank">N</a>]
-                                [<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank">BLASTN</a>]
+                                [{{ template "blastRegionButton" . }}]{{ if ncbiBlast }}
+                                [<a href="/redirect/blastn?genome_id={{ .GenomeID }}&contig_id={{ .ContigID }}&start={{ .Start }}&end={{ .End }}" target="_blank" title="BLAST at NCBI">NCBI</a>]{{ end }}
                         </div>
                     {{end}}
                 {{end}}
@@ -434,9 +562,11 @@ func init() {
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(legendTmpl))
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(filterByGenome))
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(filterByGene))
+	searchPageTemplate = template.Must(searchPageTemplate.Parse(exportImageTmpl))
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(tableTmpl))
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(cellTmpl))
 	searchPageTemplate = template.Must(searchPageTemplate.Parse(paginationTmpl))
+	searchPageTemplate = template.Must(searchPageTemplate.Parse(localBlastTmpl))
 }
 
 type clusterHeatmapPageData struct {
@@ -454,6 +584,31 @@ type clusterHeatmapPageData struct {
 	PageSize          int
 	ArrangeGenome     func(map[string]*model.Genome, []string) []Cell
 	ColorBy           string
+	ExportQuery       template.URL
+	Blast             *BlastHeatmapOverlay // Set when showing the clusters hit by a BLAST job
+}
+
+// heatmapExportQuery encodes the current view as query parameters for /image/heatmap.*.
+// Single-cluster pages pin the cluster IDs; search pages replay the search.
+func heatmapExportQuery(rows []*model.Cluster, searchRequest model.ClusterSearchRequest, pinClusters bool) template.URL {
+	q := url.Values{}
+	if pinClusters {
+		for _, cl := range rows {
+			q.Add("cluster_id", cl.ClusterProperty.ClusterID)
+		}
+	} else {
+		q.Set("search", searchRequest.Search_For)
+		q.Set("search_by", searchRequest.Search_Field.String())
+		q.Set("order_by", searchRequest.Order_By.String())
+		q.Set("order_dir", searchRequest.Order_Dir)
+		q.Set("page", strconv.Itoa(searchRequest.Page))
+		q.Set("page_size", strconv.Itoa(searchRequest.Page_Size))
+	}
+	q.Set("color_by", searchRequest.Color_By)
+	for _, id := range searchRequest.Genome_IDs {
+		q.Set("gm_"+id, "y")
+	}
+	return template.URL(q.Encode())
 }
 
 func buildClusterHeatmapPageData(rows []*model.Cluster, searchRequest model.ClusterSearchRequest, totalPage int) clusterHeatmapPageData {
@@ -504,6 +659,9 @@ func buildClusterHeatmapPageData(rows []*model.Cluster, searchRequest model.Clus
 		data.ArrangeGenome = arrangeGenomeColorByCopyNumber
 	}
 
+	searchRequest.Color_By = data.ColorBy
+	data.ExportQuery = heatmapExportQuery(rows, searchRequest, false)
+
 	return data
 }
 
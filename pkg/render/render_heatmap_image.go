@@ -0,0 +1,379 @@
+// Render the cluster heatmap as a standalone image (SVG or PNG) for figures.
+
+package render
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+const (
+	DefaultHeatmapCellSize   = 14
+	DefaultHeatmapFontSize   = 10
+	DefaultHeatmapFontFamily = "Helvetica, Arial, sans-serif"
+
+	heatmapImagePadding   = 10
+	heatmapMaxFuncLabel   = 60
+	heatmapLegendSwatchPx = 12
+)
+
+// HeatmapImageOptions controls the geometry and labelling of a heatmap image.
+type HeatmapImageOptions struct {
+	CellSize     int     // Width and height of a single cell in pixels
+	FontSize     float64 // Label font size in pixels
+	FontFamily   string  // CSS font-family for SVG output; PNG always uses Go Regular
+	ColorBy      string  // "gene_copy_number" or "max_gene_completeness"
+	ShowFunction bool    // Append the function description to cluster labels
+}
+
+// legendEntry is a single swatch in the image legend.
+type legendEntry struct {
+	Color string
+	Label string
+}
+
+// heatmapImageLayout holds everything needed to draw a heatmap, independent of output format.
+type heatmapImageLayout struct {
+	opts         HeatmapImageOptions
+	genomeLabels []string
+	rowLabels    []string
+	cells        [][]Cell
+	legendTitle  string
+	legend       []legendEntry
+
+	rowLabelWidth int
+	colLabelSpan  int
+	width         int
+	height        int
+	gridX         int
+	gridY         int
+	legendY       int
+}
+
+// normalizeHeatmapImageOptions fills defaults and clamps values to a sane range.
+func normalizeHeatmapImageOptions(opts HeatmapImageOptions) HeatmapImageOptions {
+	if opts.CellSize <= 0 {
+		opts.CellSize = DefaultHeatmapCellSize
+	}
+	opts.CellSize = min(max(opts.CellSize, 4), 64)
+
+	if opts.FontSize <= 0 {
+		opts.FontSize = DefaultHeatmapFontSize
+	}
+	opts.FontSize = min(max(opts.FontSize, 6), 32)
+
+	if strings.TrimSpace(opts.FontFamily) == "" {
+		opts.FontFamily = DefaultHeatmapFontFamily
+	}
+
+	if opts.ColorBy != "max_gene_completeness" {
+		opts.ColorBy = "gene_copy_number"
+	}
+	return opts
+}
+
+// estimateTextWidth approximates the rendered width of s; good enough for sizing an SVG canvas.
+func estimateTextWidth(s string, fontSize float64) int {
+	return int(float64(len([]rune(s)))*fontSize*0.6 + 0.5)
+}
+
+func buildHeatmapImageLayout(rows []*model.Cluster, genomeIDs []string, opts HeatmapImageOptions) *heatmapImageLayout {
+	opts = normalizeHeatmapImageOptions(opts)
+
+	colorFn := CellColorFunc(colorByCopyNumber)
+	legendTitle := "Gene copy number"
+	legend := []legendEntry{
+		{"#CCCCCC", "0 (region-only)"},
+		{"#FFFFB2", "1"},
+		{"#FECC5C", "2"},
+		{"#FD8D3C", "3"},
+		{"#F03B20", "4"},
+		{"#BD0026", "5"},
+		{calculateByCopyNumber(15), "6+"},
+		{"#000000", "absent"},
+	}
+	if opts.ColorBy == "max_gene_completeness" {
+		colorFn = colorByMaxCompleteness
+		legendTitle = "Max gene completeness"
+		legend = []legendEntry{
+			{"#CCCCCC", "region-only"},
+			{"#8B8989", "< 70%"},
+			{calculateColorByCompleteness(70), "70%"},
+			{calculateColorByCompleteness(85), "85%"},
+			{calculateColorByCompleteness(100), "100%"},
+			{"#000000", "absent"},
+		}
+	}
+
+	l := &heatmapImageLayout{
+		opts:        opts,
+		legendTitle: legendTitle,
+		legend:      legend,
+	}
+
+	for _, id := range genomeIDs {
+		label := id
+		if name, ok := model.MAP_HEADER[id]; ok && name != "" {
+			label = name
+		}
+		l.genomeLabels = append(l.genomeLabels, label)
+	}
+
+	for _, cl := range rows {
+		label := cl.ClusterProperty.ClusterID
+		if opts.ShowFunction && cl.ClusterProperty.FunctionDescription != "" {
+			desc := []rune(cl.ClusterProperty.FunctionDescription)
+			if len(desc) > heatmapMaxFuncLabel {
+				desc = append(desc[:heatmapMaxFuncLabel-1], '…')
+			}
+			label = fmt.Sprintf("%s %s", label, string(desc))
+		}
+		l.rowLabels = append(l.rowLabels, label)
+		l.cells = append(l.cells, arrangeGenomeWithColor(cl.Genomes, genomeIDs, colorFn))
+	}
+
+	for _, s := range l.rowLabels {
+		l.rowLabelWidth = max(l.rowLabelWidth, estimateTextWidth(s, opts.FontSize))
+	}
+	for _, s := range l.genomeLabels {
+		l.colLabelSpan = max(l.colLabelSpan, estimateTextWidth(s, opts.FontSize))
+	}
+
+	fontPx := int(opts.FontSize + 0.5)
+	legendWidth := estimateTextWidth(legendTitle, opts.FontSize)
+	for _, e := range legend {
+		legendWidth += heatmapLegendSwatchPx + 4 + estimateTextWidth(e.Label, opts.FontSize) + 12
+	}
+
+	l.gridX = heatmapImagePadding + l.rowLabelWidth + 6
+	l.gridY = heatmapImagePadding + l.colLabelSpan + 6
+	gridW := len(genomeIDs) * opts.CellSize
+	gridH := len(rows) * opts.CellSize
+	l.legendY = l.gridY + gridH + fontPx + 8
+
+	l.width = max(l.gridX+gridW, heatmapImagePadding+legendWidth) + heatmapImagePadding
+	l.height = l.legendY + max(fontPx, heatmapLegendSwatchPx) + heatmapImagePadding
+	return l
+}
+
+/*************************
+ * SVG
+ *************************/
+
+// RenderClusterHeatmapSVG writes the heatmap for rows (one per cluster) and
+// genomeIDs (one per column) as a standalone SVG document.
+func RenderClusterHeatmapSVG(w io.Writer, rows []*model.Cluster, genomeIDs []string, opts HeatmapImageOptions) error {
+	l := buildHeatmapImageLayout(rows, genomeIDs, opts)
+	cs := l.opts.CellSize
+	fs := strconv.FormatFloat(l.opts.FontSize, 'f', -1, 64)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="%s">`+"\n",
+		l.width, l.height, l.width, l.height, html.EscapeString(l.opts.FontFamily), fs)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+
+	// Genome labels, rotated so they read bottom-to-top above each column.
+	b.WriteString(`<g class="genome-labels">` + "\n")
+	for i, label := range l.genomeLabels {
+		x := l.gridX + i*cs + cs/2
+		y := l.gridY - 4
+		fmt.Fprintf(&b, `<text transform="translate(%d,%d) rotate(-90)" dominant-baseline="middle">%s</text>`+"\n",
+			x, y, html.EscapeString(label))
+	}
+	b.WriteString("</g>\n")
+
+	// Cluster labels, right-aligned against the grid.
+	b.WriteString(`<g class="cluster-labels">` + "\n")
+	for i, label := range l.rowLabels {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n",
+			l.gridX-6, l.gridY+i*cs+cs/2, html.EscapeString(label))
+	}
+	b.WriteString("</g>\n")
+
+	// Cells
+	b.WriteString(`<g class="cells" stroke="#FFFFFF" stroke-width="0.5">` + "\n")
+	for i, row := range l.cells {
+		for j, cell := range row {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s</title></rect>`+"\n",
+				l.gridX+j*cs, l.gridY+i*cs, cs, cs, cell.Color,
+				html.EscapeString(cellTitle(l.rowLabels[i], l.genomeLabels[j], cell)))
+		}
+	}
+	b.WriteString("</g>\n")
+
+	// Legend
+	x := heatmapImagePadding
+	y := l.legendY
+	fmt.Fprintf(&b, `<g class="legend"><text x="%d" y="%d" dominant-baseline="middle" font-weight="bold">%s</text>`+"\n",
+		x, y, html.EscapeString(l.legendTitle))
+	x += estimateTextWidth(l.legendTitle, l.opts.FontSize) + 12
+	for _, e := range l.legend {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#666666" stroke-width="0.5"/>`,
+			x, y-heatmapLegendSwatchPx/2, heatmapLegendSwatchPx, heatmapLegendSwatchPx, e.Color)
+		x += heatmapLegendSwatchPx + 4
+		fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`+"\n", x, y, html.EscapeString(e.Label))
+		x += estimateTextWidth(e.Label, l.opts.FontSize) + 12
+	}
+	b.WriteString("</g>\n</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cellTitle is the hover text of an SVG cell.
+func cellTitle(cluster, genome string, cell Cell) string {
+	if cell.Blank {
+		return fmt.Sprintf("%s / %s: absent", cluster, genome)
+	}
+	return fmt.Sprintf("%s / %s: %d gene(s), %d region(s)", cluster, genome, len(cell.Genes), len(cell.Regions))
+}
+
+/*************************
+ * PNG
+ *************************/
+
+// RenderClusterHeatmapPNG rasterises the same layout as RenderClusterHeatmapSVG into a PNG.
+// Text is drawn with the embedded Go Regular font so no system fonts are needed.
+func RenderClusterHeatmapPNG(w io.Writer, rows []*model.Cluster, genomeIDs []string, opts HeatmapImageOptions) error {
+	l := buildHeatmapImageLayout(rows, genomeIDs, opts)
+	cs := l.opts.CellSize
+
+	face, err := newGoRegularFace(l.opts.FontSize)
+	if err != nil {
+		return fmt.Errorf("load font: %w", err)
+	}
+	defer face.Close()
+
+	// Measure real label widths now that we have a font, so nothing is clipped.
+	for _, s := range l.rowLabels {
+		l.rowLabelWidth = max(l.rowLabelWidth, font.MeasureString(face, s).Ceil())
+	}
+	for _, s := range l.genomeLabels {
+		l.colLabelSpan = max(l.colLabelSpan, font.MeasureString(face, s).Ceil())
+	}
+	shiftX := heatmapImagePadding + l.rowLabelWidth + 6 - l.gridX
+	shiftY := heatmapImagePadding + l.colLabelSpan + 6 - l.gridY
+	l.gridX += shiftX
+	l.gridY += shiftY
+	l.legendY += shiftY
+	l.width += shiftX
+	l.height += shiftY
+
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	ascent := face.Metrics().Ascent.Ceil()
+	textH := (face.Metrics().Ascent + face.Metrics().Descent).Ceil()
+
+	// Genome labels: draw horizontally onto a scratch image, then rotate 90° counter-clockwise.
+	for i, label := range l.genomeLabels {
+		tw := font.MeasureString(face, label).Ceil()
+		scratch := image.NewRGBA(image.Rect(0, 0, tw, textH))
+		drawText(scratch, face, label, 0, ascent)
+		x0 := l.gridX + i*cs + cs/2 - textH/2
+		y1 := l.gridY - 4
+		for sy := 0; sy < textH; sy++ {
+			for sx := 0; sx < tw; sx++ {
+				c := scratch.RGBAAt(sx, sy)
+				if c.A == 0 {
+					continue
+				}
+				blendPixel(img, x0+sy, y1-sx, c)
+			}
+		}
+	}
+
+	// Cluster labels, right-aligned.
+	for i, label := range l.rowLabels {
+		tw := font.MeasureString(face, label).Ceil()
+		y := l.gridY + i*cs + cs/2 + ascent/2 - 1
+		drawText(img, face, label, l.gridX-6-tw, y)
+	}
+
+	// Cells, with a 1px white gutter like the SVG stroke.
+	for i, row := range l.cells {
+		for j, cell := range row {
+			r := image.Rect(l.gridX+j*cs, l.gridY+i*cs, l.gridX+(j+1)*cs-1, l.gridY+(i+1)*cs-1)
+			draw.Draw(img, r, image.NewUniform(parseHexColor(cell.Color)), image.Point{}, draw.Src)
+		}
+	}
+
+	// Legend
+	x := heatmapImagePadding
+	baseline := l.legendY + ascent/2 - 1
+	drawText(img, face, l.legendTitle, x, baseline)
+	x += font.MeasureString(face, l.legendTitle).Ceil() + 12
+	border := image.NewUniform(color.RGBA{0x66, 0x66, 0x66, 0xFF})
+	for _, e := range l.legend {
+		sw := image.Rect(x, l.legendY-heatmapLegendSwatchPx/2, x+heatmapLegendSwatchPx, l.legendY+heatmapLegendSwatchPx/2)
+		draw.Draw(img, sw, border, image.Point{}, draw.Src)
+		draw.Draw(img, sw.Inset(1), image.NewUniform(parseHexColor(e.Color)), image.Point{}, draw.Src)
+		x += heatmapLegendSwatchPx + 4
+		drawText(img, face, e.Label, x, baseline)
+		x += font.MeasureString(face, e.Label).Ceil() + 12
+	}
+
+	return png.Encode(w, img)
+}
+
+func newGoRegularFace(size float64) (font.Face, error) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72, // 1pt == 1px, matching the SVG font-size
+		Hinting: font.HintingFull,
+	})
+}
+
+func drawText(dst draw.Image, face font.Face, s string, x, y int) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+// blendPixel composites a premultiplied colour over img at (x, y).
+func blendPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return
+	}
+	bg := img.RGBAAt(x, y)
+	inv := 255 - uint32(c.A)
+	img.SetRGBA(x, y, color.RGBA{
+		R: uint8(uint32(c.R) + uint32(bg.R)*inv/255),
+		G: uint8(uint32(c.G) + uint32(bg.G)*inv/255),
+		B: uint8(uint32(c.B) + uint32(bg.B)*inv/255),
+		A: 0xFF,
+	})
+}
+
+// parseHexColor converts "#RRGGBB" (as produced by the palette helpers) to a color.
+func parseHexColor(s string) color.RGBA {
+	s = strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF}
+}
@@ -0,0 +1,66 @@
+package render
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/yumyai/ggtable/pkg/model"
+)
+
+func heatmapImageFixture() []*model.Cluster {
+	model.MAP_HEADER = map[string]string{"G1": "Genome <one>", "G2": "Genome two"}
+	return []*model.Cluster{
+		{
+			ClusterProperty: model.ClusterProperty{ClusterID: "C1", FunctionDescription: "ABC transporter"},
+			Genomes: map[string]*model.Genome{
+				"G1": {Genes: []*model.Gene{{GeneID: "g1", Completeness: 95}}},
+			},
+		},
+		{
+			ClusterProperty: model.ClusterProperty{ClusterID: "C2"},
+			Genomes: map[string]*model.Genome{
+				"G2": {Regions: []*model.Region{{GenomeID: "G2", ContigID: "c", Start: 1, End: 10}}},
+			},
+		},
+	}
+}
+
+func TestRenderClusterHeatmapSVG(t *testing.T) {
+	var buf bytes.Buffer
+	err := RenderClusterHeatmapSVG(&buf, heatmapImageFixture(), []string{"G1", "G2"}, HeatmapImageOptions{ShowFunction: true})
+	if err != nil {
+		t.Fatalf("render svg: %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"<svg",
+		"Genome &lt;one&gt;", // labels are escaped
+		"C1 ABC transporter",
+		`fill="#FFFFB2"`, // one gene copy
+		`fill="#000000"`, // absent
+		"Gene copy number",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("svg missing %q", want)
+		}
+	}
+}
+
+func TestRenderClusterHeatmapPNG(t *testing.T) {
+	var buf bytes.Buffer
+	opts := HeatmapImageOptions{CellSize: 20, ColorBy: "max_gene_completeness"}
+	if err := RenderClusterHeatmapPNG(&buf, heatmapImageFixture(), []string{"G1", "G2"}, opts); err != nil {
+		t.Fatalf("render png: %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() < 2*20 || b.Dy() < 2*20 {
+		t.Fatalf("image too small for a 2x2 grid: %v", b)
+	}
+}
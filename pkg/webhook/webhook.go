@@ -0,0 +1,265 @@
+// Package webhook delivers signed JSON notifications to URLs given by clients,
+// such as the callback_url of a BLAST search.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yumyai/ggtable/logger"
+	"go.uber.org/zap"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Ggtable-Event"     // Event name, e.g. "blast.job.finished"
+	HeaderDelivery  = "X-Ggtable-Delivery"  // Random ID, the same for every attempt
+	HeaderSignature = "X-Ggtable-Signature" // "sha256=" and the hex HMAC-SHA256 of the body
+)
+
+// Defaults of a new Sender.
+const (
+	DefaultMaxAttempts = 6
+	DefaultBackoff     = 2 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// ErrPrivateAddress is returned for receivers on loopback, private,
+// link-local and other non-public addresses.
+var ErrPrivateAddress = errors.New("webhook receiver has a non-public address")
+
+// Sender posts payloads signed with a shared secret. Failed deliveries are
+// retried with exponential backoff: Backoff, twice that, and so on.
+//
+// Callback URLs come from anyone who can submit a job, so by default a
+// Sender only connects to public addresses, checked when it dials so that
+// host names cannot resolve around the check, and does not follow redirects.
+type Sender struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+
+	// AllowPrivate lets deliveries reach loopback, private and link-local
+	// addresses, for receivers on the server's own network.
+	AllowPrivate bool
+
+	secret []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSender constructs a Sender that signs payloads with secret.
+func NewSender(secret string) *Sender {
+	s := &Sender{
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		secret:      []byte(secret),
+	}
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: s.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Deliveries go direct, so the address checked is the receiver's.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	s.Client = &http.Client{
+		Transport: transport,
+		Timeout:   DefaultTimeout,
+		// A redirect is the receiver's answer; it is not followed.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// checkDial refuses connections to non-public addresses unless AllowPrivate is set.
+func (s *Sender) checkDial(network, address string, _ syscall.RawConn) error {
+	if s.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// nonPublicPrefixes are the special-purpose ranges that netip does not classify.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can reach IPv4 private ranges
+}
+
+// isPublic reports whether ip is a global unicast address outside the
+// private and special-purpose ranges.
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body, for receivers.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// ValidateURL checks that raw is an absolute http or https URL.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback URL %q must be an absolute http or https URL", raw)
+	}
+	if u.User != nil {
+		return errors.New("callback URL must not contain credentials")
+	}
+	return nil
+}
+
+// CheckURL checks raw with ValidateURL and, unless AllowPrivate is set,
+// rejects hosts that are non-public IP addresses or localhost. Host names are
+// checked again when a delivery connects.
+func (s *Sender) CheckURL(raw string) error {
+	if err := ValidateURL(raw); err != nil {
+		return err
+	}
+	if s.AllowPrivate {
+		return nil
+	}
+	u, _ := url.Parse(raw) // Parsed by ValidateURL
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("callback URL %q: %w", raw, ErrPrivateAddress)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !isPublic(ip) {
+		return fmt.Errorf("callback URL %q: %w", raw, ErrPrivateAddress)
+	}
+	return nil
+}
+
+// Deliver sends payload to target in the background, retrying failures, and
+// logs the outcome. Close stops pending deliveries.
+func (s *Sender) Deliver(target, event string, payload interface{}) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.Send(s.ctx, target, event, payload); err != nil {
+			logger.Warn("Webhook delivery failed", zap.String("url", target), zap.String("event", event), zap.Error(err))
+			return
+		}
+		logger.Info("Webhook delivered", zap.String("url", target), zap.String("event", event))
+	}()
+}
+
+// Send posts payload as JSON to target and waits for a 2xx answer. Network
+// errors, 429 and 5xx answers are retried; other answers are final.
+func (s *Sender) Send(ctx context.Context, target, event string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	delivery := deliveryID()
+
+	attempts := max(s.MaxAttempts, 1)
+	wait := s.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, target, event, delivery, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == attempts {
+			return fmt.Errorf("attempt %d of %d: %w", attempt, attempts, err)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after attempt %d: %w", attempt, ctx.Err())
+		}
+		wait *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying.
+func (s *Sender) post(ctx context.Context, target, event, delivery string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ggtable-webhook")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, delivery)
+	req.Header.Set(HeaderSignature, Sign(s.secret, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, ErrPrivateAddress), err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Let the connection be reused
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+}
+
+// Close cancels pending deliveries and waits for them to stop.
+func (s *Sender) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func deliveryID() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf[:])
+}
@@ -58,60 +58,193 @@ function attachCellMenus() {
   });
 }
 
+// blastFormToJSON builds the /blast request body. Empty parameters are left
+// out so the server uses BLAST+ defaults; numbers and the filter switch are
+// sent as JSON numbers/booleans.
+function blastFormToJSON(form) {
+  const jsonData = {};
+  new FormData(form).forEach((value, key) => {
+    if (value === '') return;
+    const input = form.elements[key];
+    if (input && input.type === 'number') {
+      jsonData[key] = Number(value);
+    } else if (key === 'filter') {
+      jsonData[key] = value === 'true';
+    } else {
+      jsonData[key] = value;
+    }
+  });
+  return jsonData;
+}
+
+// Show only the parameters that apply to the selected BLAST program and aligner.
+function updateBlastParamFields(form) {
+  const blastType = form.elements['blast_type'].value;
+  const aligner = form.elements['aligner'].value;
+  const listed = (list, value) => !list || list.split(' ').includes(value);
+  form.querySelectorAll('[data-blast-type], [data-aligner]').forEach(el => {
+    const applies = listed(el.dataset.blastType, blastType) && listed(el.dataset.aligner, aligner);
+    el.hidden = !applies;
+    if (el.tagName === 'OPTION') {
+      el.disabled = !applies;
+    } else {
+      el.querySelectorAll('select, input').forEach(input => { input.disabled = !applies; });
+    }
+  });
+  ['blast_type', 'task', 'database'].forEach(name => {
+    const select = form.elements[name];
+    if (select.selectedOptions[0] && select.selectedOptions[0].disabled) {
+      select.value = select.options[0].value;
+    }
+  });
+}
+
+// checkBlastQuery asks the server to check the form's query without queuing a
+// job. Resolves to the check: { valid, molecule_type, blast_type, errors, ... }.
+function checkBlastQuery(form) {
+  return fetch('/api/v1/blast/validate', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', 'Accept': 'application/json' },
+    body: JSON.stringify(blastFormToJSON(form)),
+  }).then(response => {
+    if (!response.ok) throw new Error(`query check failed: ${response.status}`);
+    return response.json();
+  });
+}
+
+// Show the query check under the sequence box: errors and warnings with their
+// line numbers, or the detected molecule type and the program that will run.
+function showBlastQueryCheck(form, check) {
+  const box = document.getElementById('blast-query-check');
+  if (!box) return;
+  box.replaceChildren();
+  if (!check) return;
+
+  const addList = (issues, className) => {
+    if (!issues || !issues.length) return;
+    const list = document.createElement('ul');
+    list.className = className;
+    issues.forEach(issue => {
+      const item = document.createElement('li');
+      item.textContent = issue.line ? `Line ${issue.line}: ${issue.message}` : issue.message;
+      list.appendChild(item);
+    });
+    if (className === 'errors' && check.more_errors) {
+      const item = document.createElement('li');
+      item.textContent = `${check.more_errors} more problems not shown`;
+      list.appendChild(item);
+    }
+    box.appendChild(list);
+  };
+  addList(check.errors, 'errors');
+  addList(check.warnings, 'warnings');
+
+  if (check.valid && check.molecule_type) {
+    const note = document.createElement('p');
+    const queries = check.queries ? check.queries.length : 0;
+    note.textContent = `${queries} ${check.molecule_type} ${queries === 1 ? 'query' : 'queries'}`;
+    if (form.elements['blast_type'].value === 'auto') {
+      note.textContent += `; searching with ${check.blast_type}`;
+    }
+    box.appendChild(note);
+  }
+}
+
 function attachBlastFormHandler() {
   const form = document.getElementById('searchBLAST');
   if (!form) return;
 
+  updateBlastParamFields(form);
+  ['blast_type', 'aligner'].forEach(name => form.elements[name].addEventListener('change', () => updateBlastParamFields(form)));
+
+  // Check the query while it is typed, once the user pauses.
+  let checkTimer;
+  const scheduleCheck = () => {
+    clearTimeout(checkTimer);
+    if (form.elements['sequence'].value.trim() === '') {
+      showBlastQueryCheck(form, null);
+      return;
+    }
+    checkTimer = setTimeout(() => {
+      checkBlastQuery(form)
+        .then(check => showBlastQueryCheck(form, check))
+        .catch(error => console.error('Error:', error));
+    }, 500);
+  };
+  form.elements['sequence'].addEventListener('input', scheduleCheck);
+  ['blast_type', 'database', 'task', 'aligner'].forEach(name => form.elements[name].addEventListener('change', scheduleCheck));
+
   form.addEventListener('submit', function (e) {
     e.preventDefault();
+    clearTimeout(checkTimer);
 
-    const formData = new FormData(form);
-    const jsonData = {};
-    formData.forEach((value, key) => {
-      jsonData[key] = value;
-    });
+    const jsonData = blastFormToJSON(form);
 
+    // Opened before any request so popup blockers allow it.
     const newWindow = window.open('', '_blank');
 
-    fetch('/blast', {
-      method: 'POST',
-      headers: {
-        'Content-Type': 'application/json',
-        'Accept': 'application/json',
-        'X-Requested-With': 'XMLHttpRequest',
-      },
-      body: JSON.stringify(jsonData),
-    })
-    .then(response => {
-      if (!response.ok) {
-        throw new Error('Network response was not ok');
-      }
-      return response.json();
-    })
-    .then(data => {
-      const jobId = data.job_id;
-      if (!jobId) {
-        throw new Error('Missing job ID in response');
-      }
-      const targetUrl = `/blast/${encodeURIComponent(jobId)}`;
-      if (newWindow) {
-        newWindow.location = targetUrl;
-      } else {
-        window.open(targetUrl, '_blank');
-      }
-    })
-    .catch((error) => {
-      console.error('Error:', error);
-
-      const errorMessage = '<h1>Error</h1><p>Unable to start BLAST search. Please try again later.</p>';
-      if (newWindow) {
-        newWindow.document.open();
-        newWindow.document.write(errorMessage);
-        newWindow.document.close();
-      } else {
-        alert('Unable to start BLAST search. Please try again later.');
-      }
-    });
+    checkBlastQuery(form)
+      .catch(() => null) // The search itself reports anything the check would have
+      .then(check => {
+        showBlastQueryCheck(form, check);
+        if (check && !check.valid) {
+          if (newWindow) newWindow.close();
+          form.elements['sequence'].focus();
+          return;
+        }
+        return submitBlastSearch(jsonData, newWindow);
+      });
+  });
+}
+
+// submitBlastSearch queues the search and opens its status page in newWindow.
+function submitBlastSearch(jsonData, newWindow) {
+  return fetch('/blast', {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      'Accept': 'application/json',
+      'X-Requested-With': 'XMLHttpRequest',
+    },
+    body: JSON.stringify(jsonData),
+  })
+  .then(response => {
+    if (!response.ok) {
+      // Validation failures come back as problem+json with a readable detail.
+      return response.json()
+        .catch(() => ({}))
+        .then(problem => {
+          const err = new Error(problem.detail || 'Network response was not ok');
+          err.userMessage = response.status === 400 ? problem.detail : '';
+          throw err;
+        });
+    }
+    return response.json();
+  })
+  .then(data => {
+    const jobId = data.job_id;
+    if (!jobId) {
+      throw new Error('Missing job ID in response');
+    }
+    const targetUrl = `/blast/${encodeURIComponent(jobId)}`;
+    if (newWindow) {
+      newWindow.location = targetUrl;
+    } else {
+      window.open(targetUrl, '_blank');
+    }
+  })
+  .catch((error) => {
+    console.error('Error:', error);
+
+    const message = error.userMessage || 'Unable to start BLAST search. Please try again later.';
+    if (newWindow) {
+      newWindow.document.open();
+      newWindow.document.write('<h1>Error</h1><p></p>');
+      newWindow.document.close();
+      newWindow.document.querySelector('p').textContent = message;
+    } else {
+      alert(message);
+    }
   });
 }
 